@@ -18,11 +18,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/conduitio/conduit-commons/csync"
 	"github.com/conduitio/conduit-connector-postgres/source"
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl"
+	"github.com/conduitio/conduit-connector-postgres/source/snapshot"
+	"github.com/conduitio/conduit-connector-postgres/source/types"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -63,7 +66,21 @@ func (s *Source) Configure(_ context.Context, cfg map[string]string) error {
 }
 
 func (s *Source) Open(ctx context.Context, pos sdk.Position) error {
-	pool, err := pgxpool.New(ctx, s.config.URL)
+	poolConfig, err := pgxpool.ParseConfig(s.config.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse connection pool config: %w", err)
+	}
+	logrepl.SetTLSServerName(&poolConfig.ConnConfig.Config, s.config.TLSServerName)
+	logrepl.SetChannelBinding(&poolConfig.ConnConfig.Config, s.config.TLSChannelBinding)
+	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		types.RegisterTypes(conn.TypeMap())
+		if err := types.LoadExtensionTypes(ctx, conn.PgConn(), conn.TypeMap()); err != nil {
+			return err
+		}
+		return types.LoadUserTypes(ctx, conn.PgConn(), conn.TypeMap())
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create a connection pool to database: %w", err)
 	}
@@ -80,29 +97,139 @@ func (s *Source) Open(ctx context.Context, pos sdk.Position) error {
 			Strs("tables", s.config.Tables).
 			Int("count", len(s.config.Tables)).
 			Msg("Successfully detected tables")
+
+		// keys could only be validated against the wildcard so far
+		if err := s.config.ValidateKeyTables(); err != nil {
+			return fmt.Errorf("invalid keys for detected tables: %w", err)
+		}
 	}
 
 	// ensure we have keys for all tables
 	for _, tableName := range s.config.Tables {
+		if keyColumn, ok := s.config.KeyColumns[tableName]; ok {
+			if err := s.validateKeyColumn(ctx, tableName, keyColumn); err != nil {
+				return fmt.Errorf("failed to validate key column for table %s: %w", tableName, err)
+			}
+			s.tableKeys[tableName] = keyColumn
+			continue
+		}
+		if index, ok := s.config.KeyIndexes[tableName]; ok {
+			s.tableKeys[tableName], err = s.getIndexKey(ctx, tableName, index)
+			if err != nil {
+				return fmt.Errorf("failed to get key from index %s for table %s: %w", index, tableName, err)
+			}
+			continue
+		}
+
 		s.tableKeys[tableName], err = s.getPrimaryKey(ctx, tableName)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// tables without a primary key can still have an identity column
+			s.tableKeys[tableName], err = s.getIdentityColumn(ctx, tableName)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to find primary key for table %s: %w", tableName, err)
 		}
 	}
 
+	skipTransactions, err := s.config.SkipTransactionIDs()
+	if err != nil {
+		// shouldn't happen, config was validated
+		return err
+	}
+	columnRenames, err := s.config.ColumnRenameMap()
+	if err != nil {
+		// shouldn't happen, config was validated
+		return err
+	}
+
+	if s.config.SnapshotMode == source.SnapshotModeOnly {
+		i, err := snapshot.NewStandaloneIterator(ctx, s.pool, snapshot.Config{
+			Position:           pos,
+			Tables:             s.config.Tables,
+			TableKeys:          s.tableKeys,
+			ColumnRenames:      columnRenames,
+			IntervalComponents: s.config.IntervalMode == source.IntervalModeComponents,
+			FloatSpecials:      s.config.FloatSpecials.Replacement(),
+			WithKeyHash:        s.config.KeyHash,
+			MetadataPrefix:     s.config.LogreplMetadataPrefix,
+			FetchSize:          s.config.SnapshotFetchSize,
+			WithSequences:      s.config.SnapshotSequences,
+			Parallelism:        s.config.SnapshotParallelism,
+			StaticMetadata:     s.config.StaticMetadata,
+			OverwriteMetadata:  s.config.StaticMetadataOverwrite,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot iterator: %w", err)
+		}
+		s.iterator = i
+		return nil
+	}
+
 	switch s.config.CDCMode {
 	case source.CDCModeAuto:
-		// TODO add logic that checks if the DB supports logical replication (since that's the only thing we support at the moment)
+		// logical replication is the only supported mode, the CDC iterator
+		// checks that the server supports it (see internal.CheckWALLevel)
 		fallthrough
 	case source.CDCModeLogrepl:
 		i, err := logrepl.NewCombinedIterator(ctx, s.pool, logrepl.Config{
-			Position:          pos,
-			SlotName:          s.config.LogreplSlotName,
-			PublicationName:   s.config.LogreplPublicationName,
-			Tables:            s.config.Tables,
-			TableKeys:         s.tableKeys,
-			WithSnapshot:      s.config.SnapshotMode == source.SnapshotModeInitial,
-			SnapshotFetchSize: s.config.SnapshotFetchSize,
+			Position:             pos,
+			SlotName:             s.config.LogreplSlotName,
+			PublicationName:      s.config.LogreplPublicationName,
+			ExtraPublications:    s.config.LogreplExtraPublications,
+			Tables:               s.config.Tables,
+			TableKeys:            s.tableKeys,
+			ColumnRenames:        columnRenames,
+			IntervalComponents:   s.config.IntervalMode == source.IntervalModeComponents,
+			FloatSpecials:        s.config.FloatSpecials.Replacement(),
+			WithKeyHash:          s.config.KeyHash,
+			WithSnapshot:         s.config.SnapshotMode == source.SnapshotModeInitial,
+			SnapshotFetchSize:    s.config.SnapshotFetchSize,
+			WithSequences:        s.config.SnapshotSequences,
+			SnapshotParallelism:  s.config.SnapshotParallelism,
+			WithDebeziumSchema:   s.config.LogreplDebeziumSchema,
+			SchemaRecords:        s.config.LogreplSchemaRecords,
+			WithColumnDefaults:   s.config.LogreplColumnDefaults,
+			WithGeneratedColumns: s.config.LogreplGeneratedColumns,
+			WarnExcludedColumns:  s.config.LogreplWarnExcludedColumns,
+			SkipDroppedTables:    s.config.LogreplSkipDroppedTables,
+			QuarantineChanges:    s.config.LogreplQuarantineChanges,
+			DropNoopUpdates:      s.config.LogreplDropNoopUpdates,
+			RequireBeforeImage:   s.config.LogreplRequireBeforeImage,
+			PartialBeforeImage:   s.config.LogreplPartialBeforeImage,
+			NullKeys:             s.config.LogreplNullKeys,
+			NullKeySentinel:      s.config.LogreplNullKeySentinel,
+			KeylessDeletes:       s.config.LogreplKeylessDeletes,
+			RelationChanges:      s.config.LogreplRelationChanges,
+			ReplayedChanges:      s.config.LogreplReplayedChanges,
+			CoalesceUpdates:      s.config.LogreplCoalesceUpdates,
+			ExplicitInsertBefore: s.config.LogreplExplicitInsertBefore,
+			CommitMarkers:        s.config.LogreplCommitMarkers,
+			WithPrevLSN:          s.config.LogreplPrevLSN,
+			WithCommitTime:       s.config.LogreplCommitTime,
+			WithReceivedAt:       s.config.LogreplReceivedAt,
+			WithRelationID:       s.config.LogreplRelationID,
+			WithPublication:      s.config.LogreplPublicationMetadata,
+			WithApproxSize:       s.config.LogreplApproxSize,
+			SendRetries:          s.config.LogreplSendRetries,
+			SendRetryBackoff:     s.config.LogreplSendRetryBackoff,
+			MaxRecordsPerSecond:  s.config.LogreplMaxRecordsPerSecond,
+			StaticMetadata:       s.config.StaticMetadata,
+			OverwriteMetadata:    s.config.StaticMetadataOverwrite,
+			SkipTransactions:     skipTransactions,
+			BufferTransactions:   s.config.LogreplBufferTransactions,
+			TxSpillThreshold:     s.config.LogreplTransactionSpillThreshold,
+			TxSpillDir:           s.config.LogreplTransactionSpillDir,
+			UnsupportedTypes:     s.config.LogreplUnsupportedTypes,
+			DefaultNamespace:     s.config.LogreplDefaultSchema,
+			MetadataPrefix:       s.config.LogreplMetadataPrefix,
+			StartupTimeout:       s.config.LogreplStartupTimeout,
+			StatementTimeout:     s.config.LogreplStatementTimeout,
+			StatusInterval:       s.config.LogreplStatusInterval,
+			Keepalive: logrepl.KeepaliveConfig{
+				Idle:     s.config.LogreplKeepaliveIdle,
+				Interval: s.config.LogreplKeepaliveInterval,
+				Count:    s.config.LogreplKeepaliveCount,
+			},
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create logical replication iterator: %w", err)
@@ -165,6 +292,11 @@ func (s *Source) LifecycleOnDeleted(ctx context.Context, cfg map[string]string)
 		s.config.LogreplPublicationName = params["logrepl.publicationName"].Default
 	}
 
+	if s.config.SnapshotMode == source.SnapshotModeOnly {
+		// no replication slot or publication was created
+		return nil
+	}
+
 	switch s.config.CDCMode {
 	case source.CDCModeAuto:
 		fallthrough // TODO: Adjust as `auto` changes.
@@ -175,9 +307,12 @@ func (s *Source) LifecycleOnDeleted(ctx context.Context, cfg map[string]string)
 		}
 
 		return logrepl.Cleanup(ctx, logrepl.CleanupConfig{
-			URL:             s.config.URL,
-			SlotName:        s.config.LogreplSlotName,
-			PublicationName: s.config.LogreplPublicationName,
+			URL:              s.config.URL,
+			SlotName:         s.config.LogreplSlotName,
+			PublicationName:  s.config.LogreplPublicationName,
+			TLSServerName:    s.config.TLSServerName,
+			ChannelBinding:   s.config.TLSChannelBinding,
+			StatementTimeout: s.config.LogreplStatementTimeout,
 		})
 	default:
 		sdk.Logger(ctx).Warn().Msgf("cannot handle CDC mode %q", s.config.CDCMode)
@@ -245,3 +380,101 @@ func (s *Source) getPrimaryKey(ctx context.Context, tableName string) (string, e
 
 	return colName, nil
 }
+
+// getIdentityColumn queries the db for the name of the identity column (i.e.
+// GENERATED ... AS IDENTITY) for a given table, which is used as the key of
+// tables without a primary key.
+func (s *Source) getIdentityColumn(ctx context.Context, tableName string) (string, error) {
+	query := `SELECT a.attname FROM pg_attribute a
+			WHERE a.attrelid = $1::regclass AND a.attidentity <> '' AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY a.attnum`
+
+	rows, err := s.pool.Query(ctx, query, tableName)
+	if err != nil {
+		return "", fmt.Errorf("failed to query identity columns: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if rows.Err() != nil {
+			return "", fmt.Errorf("query failed: %w", rows.Err())
+		}
+		return "", fmt.Errorf("no table keys or identity columns found: %w", pgx.ErrNoRows)
+	}
+
+	var colName string
+	err = rows.Scan(&colName)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	if rows.Next() {
+		// the key would be ambiguous
+		return "", errors.New("multiple identity columns found, configure the key column")
+	}
+
+	return colName, nil
+}
+
+// getIndexKey queries the db for the name of the column in the index, which
+// has to be a unique index on the table and not partial.
+func (s *Source) getIndexKey(ctx context.Context, tableName, index string) (string, error) {
+	query := `SELECT i.indisunique, i.indpred IS NOT NULL, array_agg(a.attname::text ORDER BY k.n)
+			FROM pg_index i
+			CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, n)
+			LEFT JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+			WHERE i.indexrelid = to_regclass($2) AND i.indrelid = $1::regclass
+			  AND k.n <= i.indnkeyatts -- columns added with INCLUDE are not part of the key
+			GROUP BY i.indisunique, i.indpred`
+
+	var (
+		unique  bool
+		partial bool
+		cols    []*string
+	)
+	err := s.pool.QueryRow(ctx, query, tableName, index).Scan(&unique, &partial, &cols)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("index %q does not exist on the table", index)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query index: %w", err)
+	}
+
+	switch {
+	case !unique:
+		return "", fmt.Errorf("index %q is not unique", index)
+	case partial:
+		return "", fmt.Errorf("index %q is partial", index)
+	}
+
+	// columns of composite indexes are joined with a comma, like configured
+	// composite keys, see validateKeyColumn
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		if col == nil {
+			return "", fmt.Errorf("index %q is on an expression, not a column", index)
+		}
+		names[i] = *col
+	}
+	return strings.Join(names, ","), nil
+}
+
+// validateKeyColumn checks that the configured key columns exist in the table.
+// The columns of a composite key are separated by a comma.
+func (s *Source) validateKeyColumn(ctx context.Context, tableName, keyColumn string) error {
+	query := `SELECT EXISTS(SELECT a.attname FROM pg_attribute a
+			WHERE a.attrelid = $1::regclass AND a.attname = $2 AND a.attnum > 0 AND NOT a.attisdropped)`
+
+	for _, column := range strings.Split(keyColumn, ",") {
+		var exists bool
+		if err := s.pool.QueryRow(ctx, query, tableName, column).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to query table columns: %w", err)
+		}
+
+		if !exists {
+			return fmt.Errorf("column %q does not exist", column)
+		}
+	}
+
+	return nil
+}
@@ -19,6 +19,10 @@ package source
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/conduitio/conduit-commons/config"
 	"github.com/jackc/pgx/v5"
@@ -31,8 +35,51 @@ const (
 	SnapshotModeInitial SnapshotMode = "initial"
 	// SnapshotModeNever skips snapshot creation altogether.
 	SnapshotModeNever SnapshotMode = "never"
+	// SnapshotModeOnly takes a snapshot without logical replication, no
+	// replication slot or publication is created. Changes after the snapshot
+	// are not read.
+	SnapshotModeOnly SnapshotMode = "only"
 )
 
+type IntervalMode string
+
+const (
+	// IntervalModeRaw writes intervals in payloads as decoded.
+	IntervalModeRaw IntervalMode = "raw"
+	// IntervalModeComponents writes intervals in payloads as structured values
+	// with the fields months, days and microseconds.
+	IntervalModeComponents IntervalMode = "components"
+)
+
+// FloatSpecialsMode determines how the special values NaN, Infinity and
+// -Infinity of float4 and float8 columns are written in payloads.
+type FloatSpecialsMode string
+
+const (
+	// FloatSpecialsString writes special values as the strings "NaN",
+	// "Infinity" and "-Infinity", like special numeric values.
+	FloatSpecialsString FloatSpecialsMode = "string"
+	// FloatSpecialsNull writes special values as null.
+	FloatSpecialsNull FloatSpecialsMode = "null"
+	// FloatSpecialsFloat writes special values as floats, which can't be
+	// encoded as JSON.
+	FloatSpecialsFloat FloatSpecialsMode = "float"
+)
+
+// Replacement returns the function replacing special float values in
+// payloads, see types.FloatFormatter.ReplaceSpecials. It returns nil if the
+// values are kept as floats.
+func (m FloatSpecialsMode) Replacement() func(name string) any {
+	switch m {
+	case FloatSpecialsString:
+		return func(name string) any { return name }
+	case FloatSpecialsNull:
+		return func(string) any { return nil }
+	default:
+		return nil
+	}
+}
+
 type CDCMode string
 
 const (
@@ -49,17 +96,65 @@ const (
 type Config struct {
 	// URL is the connection string for the Postgres database.
 	URL string `json:"url" validate:"required"`
+	// TLSServerName overrides the server name sent in the TLS handshake
+	// (SNI) and used to verify the certificate of the server, which some
+	// providers use to route connections. Defaults to the host in the URL,
+	// it's only used if the URL enables TLS.
+	TLSServerName string `json:"tls.serverName"`
+	// TLSChannelBinding overrides the channel_binding parameter of the URL,
+	// which controls SCRAM channel binding on TLS connections. One of
+	// "disable", "prefer" or "require", the URL is used as it is if empty.
+	TLSChannelBinding string `json:"tls.channelBinding"`
 	// Tables is a List of table names to read from, separated by a comma, e.g.:"table1,table2".
 	// Use "*" if you'd like to listen to all tables.
 	Tables []string `json:"tables"`
 	// Deprecated: use `tables` instead.
 	Table []string `json:"table"`
+	// KeyColumns maps table names to the column that should be used as the
+	// record key, e.g.: "keyColumns.orders": "order_no". The columns of a
+	// composite key are separated by a comma. Tables without an entry use
+	// their primary key.
+	KeyColumns map[string]string `json:"keyColumns"`
+	// KeyIndexes maps table names to a unique index whose columns should be
+	// used as the record key, e.g.: "keyIndexes.orders": "orders_order_no_key".
+	// The index can't be partial or contain expressions.
+	KeyIndexes map[string]string `json:"keyIndexes"`
+	// ColumnRenames maps columns in the form "table.column" to the name they
+	// get in records, e.g.: "columnRenames.orders.created_at": "createdAt".
+	// Tables can be qualified with their schema, e.g.
+	// "columnRenames.sales.orders.created_at".
+	ColumnRenames map[string]string `json:"columnRenames"`
+	// IntervalMode determines how interval values are written in payloads,
+	// either as decoded or as their months, days and microseconds.
+	IntervalMode IntervalMode `json:"intervalMode" validate:"inclusion=raw|components" default:"raw"`
+	// FloatSpecials determines how the special values NaN, Infinity and
+	// -Infinity of float4 and float8 columns are written in payloads, as
+	// strings, as null or as floats, which can't be encoded as JSON.
+	FloatSpecials FloatSpecialsMode `json:"floatSpecials" validate:"inclusion=string|null|float" default:"string"`
+	// KeyHash determines if records should contain a stable hash of their
+	// key in the metadata field postgres.keyHash, e.g. for sinks sharding
+	// records by a fixed-width value.
+	KeyHash bool `json:"keyHash" default:"false"`
+
+	// StaticMetadata is added to the metadata of every record, e.g.:
+	// "staticMetadata.environment": "production".
+	StaticMetadata map[string]string `json:"staticMetadata"`
+	// StaticMetadataOverwrite determines if StaticMetadata takes precedence
+	// over metadata set by the connector with the same key.
+	StaticMetadataOverwrite bool `json:"staticMetadataOverwrite" default:"false"`
 
 	// SnapshotMode is whether the plugin will take a snapshot of the entire table before starting cdc mode.
-	SnapshotMode SnapshotMode `json:"snapshotMode" validate:"inclusion=initial|never" default:"initial"`
+	SnapshotMode SnapshotMode `json:"snapshotMode" validate:"inclusion=initial|never|only" default:"initial"`
 
 	// Snapshot fetcher size determines the number of rows to retrieve at a time.
 	SnapshotFetchSize int `json:"snapshot.fetchSize" default:"50000"`
+	// SnapshotSequences emits the latest values of sequences owned by the
+	// tables (e.g. of serial columns) as records before the snapshot rows.
+	SnapshotSequences bool `json:"snapshot.sequences" default:"false"`
+	// SnapshotParallelism is the maximum number of tables read concurrently
+	// in the snapshot. All tables are read from the same snapshot. 0 reads all
+	// tables at once.
+	SnapshotParallelism int `json:"snapshot.parallelism" validate:"gt=-1" default:"0"`
 
 	// CDCMode determines how the connector should listen to changes.
 	CDCMode CDCMode `json:"cdcMode" validate:"inclusion=auto|logrepl" default:"auto"`
@@ -67,6 +162,10 @@ type Config struct {
 	// LogreplPublicationName determines the publication name in case the
 	// connector uses logical replication to listen to changes (see CDCMode).
 	LogreplPublicationName string `json:"logrepl.publicationName" default:"conduitpub"`
+	// LogreplExtraPublications is a list of existing publications which
+	// are streamed together with the publication in logrepl.publicationName.
+	// Only changes in tables listed in tables are emitted.
+	LogreplExtraPublications []string `json:"logrepl.extraPublications"`
 	// LogreplSlotName determines the replication slot name in case the
 	// connector uses logical replication to listen to changes (see CDCMode).
 	LogreplSlotName string `json:"logrepl.slotName" default:"conduitslot"`
@@ -74,6 +173,177 @@ type Config struct {
 	// LogreplAutoCleanup determines if the replication slot and publication should be
 	// removed when the connector is deleted.
 	LogreplAutoCleanup bool `json:"logrepl.autoCleanup" default:"true"`
+
+	// LogreplDebeziumSchema determines if a Debezium-style schema describing
+	// the payload should be attached to each record in metadata.
+	LogreplDebeziumSchema bool `json:"logrepl.debeziumSchema" default:"false"`
+	// LogreplSchemaRecords determines if the Debezium-style schema should be
+	// emitted in a separate record whenever the layout of a table is first
+	// seen or changes. CDC records then only reference the schema by its ID
+	// in the metadata field postgres.schemaId, instead of containing it.
+	// Schema records are emitted in the collection "_schemas", with the table
+	// in the metadata field postgres.table.
+	LogreplSchemaRecords bool `json:"logrepl.schemaRecords" default:"false"`
+	// LogreplColumnDefaults determines if the default value expressions of
+	// columns should be included in the Debezium-style schema. Requires
+	// LogreplDebeziumSchema or LogreplSchemaRecords to be enabled.
+	LogreplColumnDefaults bool `json:"logrepl.columnDefaults" default:"false"`
+	// LogreplUnsupportedTypes determines how values of types unknown to the
+	// connector are handled: "fail" stops the connector, "raw" passes the value
+	// through as a string and "skip" leaves the column out of the payload.
+	LogreplUnsupportedTypes string `json:"logrepl.unsupportedTypes" validate:"inclusion=fail|raw|skip" default:"raw"`
+	// LogreplGeneratedColumns determines if generated columns should be
+	// detected and listed in the metadata of CDC records, so sinks know not to
+	// write them back.
+	LogreplGeneratedColumns bool `json:"logrepl.generatedColumns" default:"false"`
+	// LogreplWarnExcludedColumns determines if a warning should be logged for
+	// columns which are not replicated, e.g. columns added to a table after
+	// the publication was created with a column list. The columns are listed
+	// in the metadata field postgres.excludedColumns of CDC records.
+	LogreplWarnExcludedColumns bool `json:"logrepl.warnExcludedColumns" default:"false"`
+	// LogreplSkipDroppedTables determines if changes which can't be decoded
+	// because their table was dropped in the meantime should be skipped,
+	// instead of stopping the connector.
+	LogreplSkipDroppedTables bool `json:"logrepl.skipDroppedTables" default:"false"`
+	// LogreplQuarantineChanges determines if changes which can't be decoded
+	// should be logged with the error and skipped, instead of stopping the
+	// connector.
+	LogreplQuarantineChanges bool `json:"logrepl.quarantineChanges" default:"false"`
+	// LogreplDropNoopUpdates determines if updates which did not change any
+	// value should be dropped. Requires tables with REPLICA IDENTITY FULL,
+	// updates of other tables are always emitted.
+	LogreplDropNoopUpdates bool `json:"logrepl.dropNoopUpdates" default:"false"`
+	// LogreplRequireBeforeImage determines if updates without the old values
+	// of all columns should stop the connector, instead of being emitted
+	// without a before image. Requires tables with REPLICA IDENTITY FULL.
+	LogreplRequireBeforeImage bool `json:"logrepl.requireBeforeImage" default:"false"`
+	// LogreplPartialBeforeImage determines what happens with before images of
+	// updates which only contain some of the old values, e.g. only the key
+	// columns. They are either included and flagged in the metadata field
+	// postgres.partialBeforeImage, or dropped.
+	LogreplPartialBeforeImage string `json:"logrepl.partialBeforeImage" validate:"inclusion=include|drop" default:"include"`
+	// LogreplNullKeys determines how NULL values in key columns of CDC records
+	// are handled, which are possible if the key column is not the primary
+	// key. The record either fails, gets the value of logrepl.nullKeySentinel
+	// or an explicit null in the key.
+	LogreplNullKeys string `json:"logrepl.nullKeys" validate:"inclusion=fail|sentinel|null" default:"fail"`
+	// LogreplNullKeySentinel is written to keys instead of NULL values, if
+	// logrepl.nullKeys is set to sentinel.
+	LogreplNullKeySentinel string `json:"logrepl.nullKeySentinel" default:"__null__"`
+	// LogreplKeylessDeletes determines what happens with deletes which don't
+	// contain the old tuple, so the key of the deleted row is unknown. They
+	// either fail, are skipped with a warning or are emitted without a key.
+	LogreplKeylessDeletes string `json:"logrepl.keylessDeletes" validate:"inclusion=fail|skip|tombstone" default:"fail"`
+	// LogreplRelationChanges determines what happens if the column layout of
+	// a table changes while its relation is cached, e.g. after reconnecting
+	// to an altered table. The relation is either replaced after emitting
+	// pending changes or the connector fails.
+	LogreplRelationChanges string `json:"logrepl.relationChanges" validate:"inclusion=replace|fail" default:"replace"`
+	// LogreplReplayedChanges determines what happens with changes which were
+	// already emitted before a restart. Postgres resends the transaction of
+	// the last position and transactions committed before it, changes up to
+	// the last position are either kept, dropped or marked with the metadata
+	// field postgres.replayed. Positions written by older versions of the
+	// connector don't contain the commit LSN, no changes are detected as
+	// replayed after resuming from them.
+	LogreplReplayedChanges string `json:"logrepl.replayedChanges" validate:"inclusion=keep|drop|mark" default:"keep"`
+	// LogreplCoalesceUpdates is the window for which updates are held back, so
+	// that only the latest update per key is emitted. Updates are not
+	// coalesced if set to 0.
+	LogreplCoalesceUpdates time.Duration `json:"logrepl.coalesceUpdates" default:"0s"`
+	// LogreplExplicitInsertBefore determines if inserts should contain an
+	// explicit null before image, so that all CDC records have the same
+	// payload structure as updates.
+	LogreplExplicitInsertBefore bool `json:"logrepl.explicitInsertBefore" default:"false"`
+	// LogreplCommitMarkers determines if a record marking the commit of each
+	// transaction should be emitted after its changes. Commit markers have no
+	// key and payload and contain the metadata fields postgres.commitLSN and
+	// postgres.commitTime.
+	LogreplCommitMarkers bool `json:"logrepl.commitMarkers" default:"false"`
+	// LogreplPrevLSN determines if the LSN of the previously emitted record is
+	// added to the metadata field postgres.prevLSN of each CDC record, so gaps
+	// can be detected.
+	LogreplPrevLSN bool `json:"logrepl.prevLSN" default:"false"`
+	// LogreplCommitTime determines if the commit time of the transaction is
+	// added to the metadata field postgres.commitTime of each CDC record.
+	LogreplCommitTime bool `json:"logrepl.commitTime" default:"false"`
+	// LogreplReceivedAt determines if the time the connector received the
+	// change is added to the metadata field postgres.receivedAt of each CDC
+	// record.
+	LogreplReceivedAt bool `json:"logrepl.receivedAt" default:"false"`
+	// LogreplRelationID determines if the OID of the table is added to the
+	// metadata field postgres.relationID of each CDC record, so records can
+	// be correlated with pg_class.
+	LogreplRelationID bool `json:"logrepl.relationID" default:"false"`
+	// LogreplPublicationMetadata determines if the name of the publication a
+	// table is streamed from is added to the metadata field
+	// postgres.publication of each CDC record. Tables in multiple publications
+	// are attributed to the first one, in the order of publicationName and
+	// extraPublications.
+	LogreplPublicationMetadata bool `json:"logrepl.publicationMetadata" default:"false"`
+	// LogreplApproxSize determines if the approximate size of the payload
+	// serialized as JSON is added to the metadata field postgres.approxSize of
+	// each CDC record.
+	LogreplApproxSize bool `json:"logrepl.approxSize" default:"false"`
+	// LogreplSendRetries is the number of times handing a record over to
+	// Conduit is retried while records are not consumed, before the connector
+	// fails. The wait starts with LogreplSendRetryBackoff and doubles with
+	// each attempt. If 0, the connector waits for as long as it takes.
+	LogreplSendRetries int `json:"logrepl.sendRetries" validate:"gt=-1" default:"0"`
+	// LogreplSendRetryBackoff is the time the first attempt to hand a record
+	// over to Conduit waits, see LogreplSendRetries.
+	LogreplSendRetryBackoff time.Duration `json:"logrepl.sendRetryBackoff" default:"1s"`
+	// LogreplMaxRecordsPerSecond caps the number of CDC records emitted per
+	// second across all tables, to protect downstream systems. If 0, the rate
+	// is not limited.
+	LogreplMaxRecordsPerSecond int `json:"logrepl.maxRecordsPerSecond" validate:"gt=-1" default:"0"`
+	// LogreplSkipTransactions is a list of transaction IDs (XIDs) whose
+	// changes are dropped instead of being emitted, e.g. to get past a
+	// transaction which can't be decoded.
+	LogreplSkipTransactions []string `json:"logrepl.skipTransactions"`
+	// LogreplBufferTransactions determines if the records of a transaction
+	// should be held back until the transaction is committed, which guarantees
+	// that records are emitted in commit order.
+	LogreplBufferTransactions bool `json:"logrepl.bufferTransactions" default:"false"`
+	// LogreplTransactionSpillThreshold is the number of records of a buffered
+	// transaction kept in memory, further records are spilled to disk until
+	// the transaction is committed. If 0, all records are kept in memory.
+	LogreplTransactionSpillThreshold int `json:"logrepl.transactionSpillThreshold" validate:"gt=-1" default:"0"`
+	// LogreplTransactionSpillDir is the directory used for spilled transaction
+	// records. Defaults to the directory for temporary files of the system.
+	LogreplTransactionSpillDir string `json:"logrepl.transactionSpillDir"`
+	// LogreplStartupTimeout bounds the time it takes to set up logical
+	// replication and start streaming changes. There is no timeout if set
+	// to 0.
+	LogreplStartupTimeout time.Duration `json:"logrepl.startupTimeout" default:"0s"`
+	// LogreplStatementTimeout is the statement_timeout of the connections
+	// used to create and drop the publication and replication slot, so that
+	// statements waiting for a lock held by another session fail instead of
+	// blocking. There is no timeout if set to 0.
+	LogreplStatementTimeout time.Duration `json:"logrepl.statementTimeout" default:"0s"`
+	// LogreplKeepaliveIdle is the time a replication connection has to be
+	// idle before TCP keepalive probes are sent. The system default is used
+	// if set to 0.
+	LogreplKeepaliveIdle time.Duration `json:"logrepl.keepaliveIdle" default:"0s"`
+	// LogreplKeepaliveInterval is the time between TCP keepalive probes on
+	// replication connections. The system default is used if set to 0.
+	LogreplKeepaliveInterval time.Duration `json:"logrepl.keepaliveInterval" default:"0s"`
+	// LogreplKeepaliveCount is the number of unanswered TCP keepalive probes
+	// after which a replication connection is considered dead. Only supported
+	// on Linux, the system default is used if set to 0.
+	LogreplKeepaliveCount int `json:"logrepl.keepaliveCount" validate:"gt=-1" default:"0"`
+	// LogreplStatusInterval is the time between standby status updates sent
+	// to Postgres. It is lowered to half of the wal_sender_timeout of the
+	// server if it's not shorter than the timeout.
+	LogreplStatusInterval time.Duration `json:"logrepl.statusInterval" default:"10s"`
+	// LogreplDefaultSchema is reported in the metadata field
+	// postgres.namespace for tables whose schema is empty or pg_catalog, for
+	// which Postgres does not report a clear schema.
+	LogreplDefaultSchema string `json:"logrepl.defaultSchema"`
+	// LogreplMetadataPrefix is the prefix of Postgres specific metadata keys
+	// in CDC records and of the key hash in snapshot records, e.g. "pg."
+	// produces keys like "pg.skippedColumns".
+	LogreplMetadataPrefix string `json:"logrepl.metadataPrefix" default:"postgres."`
 }
 
 // Validate validates the provided config values.
@@ -93,9 +363,109 @@ func (c Config) Validate() error {
 	if len(c.Tables) == 0 {
 		errs = append(errs, fmt.Errorf(`error validating "tables": %w`, config.ErrRequiredParameterMissing))
 	}
+
+	switch c.TLSChannelBinding {
+	case "", "disable", "prefer", "require":
+	default:
+		errs = append(errs, fmt.Errorf(`error validating "tls.channelBinding": %q is not one of "disable", "prefer" or "require"`, c.TLSChannelBinding))
+	}
+
+	for table, column := range c.KeyColumns {
+		if column == "" {
+			errs = append(errs, fmt.Errorf(`error validating "keyColumns": empty key column for table %q`, table))
+		}
+	}
+
+	for table, index := range c.KeyIndexes {
+		if index == "" {
+			errs = append(errs, fmt.Errorf(`error validating "keyIndexes": empty key index for table %q`, table))
+		}
+		if _, ok := c.KeyColumns[table]; ok {
+			errs = append(errs, fmt.Errorf(`error validating "keyIndexes": table %q also has an entry in "keyColumns"`, table))
+		}
+	}
+
+	if err := c.ValidateKeyTables(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := c.ColumnRenameMap(); err != nil {
+		errs = append(errs, fmt.Errorf(`error validating "columnRenames": %w`, err))
+	}
+
+	if _, err := c.SkipTransactionIDs(); err != nil {
+		errs = append(errs, fmt.Errorf(`error validating "logrepl.skipTransactions": %w`, err))
+	}
+	return errors.Join(errs...)
+}
+
+// ColumnRenameMap parses ColumnRenames into a map of table names to the new
+// names of their columns by the original name.
+func (c Config) ColumnRenameMap() (map[string]map[string]string, error) {
+	renames := make(map[string]map[string]string)
+	for name, renamed := range c.ColumnRenames {
+		// tables can be qualified with their schema, the column follows the
+		// last dot
+		i := strings.LastIndex(name, ".")
+		if i <= 0 || i == len(name)-1 {
+			return nil, fmt.Errorf("invalid column %q, expected the form \"table.column\"", name)
+		}
+		table, column := name[:i], name[i+1:]
+		if renamed == "" {
+			return nil, fmt.Errorf("empty name for column %q", name)
+		}
+		if !c.readingAllTables() && !slices.Contains(c.Tables, table) {
+			return nil, fmt.Errorf("table %q is not in \"tables\"", table)
+		}
+		if renames[table] == nil {
+			renames[table] = make(map[string]string)
+		}
+		renames[table][column] = renamed
+	}
+	return renames, nil
+}
+
+// ValidateKeyTables checks that all tables with an entry in "keyColumns" or
+// "keyIndexes" are in Tables. When reading all tables, it can only be checked
+// once the detected tables replaced the wildcard in Tables.
+func (c Config) ValidateKeyTables() error {
+	if c.readingAllTables() {
+		return nil
+	}
+
+	var errs []error
+	for table := range c.KeyColumns {
+		if !slices.Contains(c.Tables, table) {
+			errs = append(errs, fmt.Errorf(`error validating "keyColumns": table %q is not in "tables"`, table))
+		}
+	}
+	for table := range c.KeyIndexes {
+		if !slices.Contains(c.Tables, table) {
+			errs = append(errs, fmt.Errorf(`error validating "keyIndexes": table %q is not in "tables"`, table))
+		}
+	}
 	return errors.Join(errs...)
 }
 
+// SkipTransactionIDs parses the transaction IDs in LogreplSkipTransactions.
+func (c Config) SkipTransactionIDs() ([]uint32, error) {
+	var xids []uint32
+	for _, s := range c.LogreplSkipTransactions {
+		xid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction ID %q: %w", s, err)
+		}
+		xids = append(xids, uint32(xid))
+	}
+	return xids, nil
+}
+
+// readingAllTables returns true when the connector is configured to read from
+// all tables.
+func (c Config) readingAllTables() bool {
+	return len(c.Tables) == 1 && c.Tables[0] == AllTablesWildcard
+}
+
 // Init sets the desired value on Tables while Table is being deprecated.
 func (c Config) Init() Config {
 	if len(c.Table) > 0 && len(c.Tables) == 0 {
@@ -18,10 +18,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
 	"github.com/conduitio/conduit-connector-postgres/source/position"
+	"github.com/conduitio/conduit-connector-postgres/source/types"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -29,34 +32,370 @@ import (
 
 const (
 	subscriberDoneTimeout = time.Second * 2
+	// defaultStatusInterval is the time between standby status updates if
+	// CDCConfig.StatusInterval is not set.
+	defaultStatusInterval = time.Second * 10
 )
 
+// ErrStartupTimeout is returned if logical replication could not be started
+// within CDCConfig.StartupTimeout.
+var ErrStartupTimeout = errors.New("logical replication startup timed out")
+
 // Config holds configuration values for CDCIterator.
 type CDCConfig struct {
 	LSN             pglogrepl.LSN
 	SlotName        string
 	PublicationName string
-	Tables          []string
-	TableKeys       map[string]string
+	// CommitLSN is the commit LSN of the transaction of the change at LSN,
+	// it's used to detect replayed changes, see CDCHandlerConfig.StartCommitLSN.
+	CommitLSN pglogrepl.LSN
+	// ExtraPublications are existing publications streamed together
+	// with PublicationName, they are not created by the iterator.
+	ExtraPublications    []string
+	Tables               []string
+	TableKeys            map[string]string
+	ColumnRenames        map[string]map[string]string
+	IntervalComponents   bool
+	FloatSpecials        func(name string) any
+	WithDebeziumSchema   bool
+	SchemaRecords        bool
+	WithColumnDefaults   bool
+	WithGeneratedColumns bool
+	WarnExcludedColumns  bool
+	SkipDroppedTables    bool
+	QuarantineChanges    bool
+	DropNoopUpdates      bool
+	RequireBeforeImage   bool
+	PartialBeforeImage   string
+	NullKeys             string
+	NullKeySentinel      string
+	KeylessDeletes       string
+	RelationChanges      string
+	ReplayedChanges      string
+	CoalesceUpdates      time.Duration
+	ExplicitInsertBefore bool
+	CommitMarkers        bool
+	WithPrevLSN          bool
+	WithCommitTime       bool
+	WithReceivedAt       bool
+	WithRelationID       bool
+	WithPublication      bool
+	WithApproxSize       bool
+	WithKeyHash          bool
+	SendRetries          int
+	SendRetryBackoff     time.Duration
+	MaxRecordsPerSecond  int
+	StaticMetadata       map[string]string
+	OverwriteMetadata    bool
+	SkipTransactions     []uint32
+	BufferTransactions   bool
+	TxSpillThreshold     int
+	TxSpillDir           string
+	UnsupportedTypes     string
+	DefaultNamespace     string
+	MetadataPrefix       string
+	// PositionCodec encodes and decodes the positions of records. Defaults to
+	// position.JSONCodec.
+	PositionCodec position.Codec
+	// StartupTimeout bounds the time it takes to set up the replication slot
+	// in NewCDCIterator and to start streaming changes in StartSubscriber.
+	// There is no timeout if it is 0.
+	StartupTimeout time.Duration
+	// StatementTimeout is the statement_timeout of the connection used to
+	// create the publication and the replication slot. There is no timeout
+	// if it is 0.
+	StatementTimeout time.Duration
+	// Keepalive contains the TCP keepalive settings of the replication
+	// connections.
+	Keepalive KeepaliveConfig
+	// StatusInterval is the time between standby status updates sent to
+	// Postgres. It is lowered if it is not shorter than the wal_sender_timeout
+	// of the server, which would close the connection otherwise. Defaults to
+	// 10 seconds.
+	StatusInterval time.Duration
+	// OnLSNProgress is called with the current LSNs after each message
+	// received from the replication slot and each status update sent to
+	// Postgres. It is optional and called synchronously, so it should return
+	// quickly.
+	OnLSNProgress func(LSNProgress)
+	// RowFilter drops changes of rows it returns false for, see
+	// CDCHandlerConfig.RowFilter.
+	RowFilter func(table string, values map[string]any) bool
 }
 
+// LSNProgress contains the positions of logical replication in the WAL, see
+// CDCConfig.OnLSNProgress.
+type LSNProgress = internal.LSNProgress
+
 // CDCIterator asynchronously listens for events from the logical replication
 // slot and returns them to the caller through Next.
 type CDCIterator struct {
 	config  CDCConfig
 	records chan sdk.Record
 	pgconn  *pgconn.PgConn
-
-	sub *internal.Subscription
+	// pgconf is the configuration of regular connections, used for checks
+	// which can't run on the replication connection.
+	pgconf *pgconn.Config
+	// slotConn is the connection used to create the replication slot, it is
+	// kept open so the exported snapshot stays valid while changes are
+	// streamed through pgconn.
+	slotConn *pgconn.PgConn
+	// catalogConn is a regular connection used to query the catalog while
+	// changes are streamed, it is only opened if a feature needs it.
+	catalogConn *pgconn.PgConn
+
+	handler *CDCHandler
+	sub     *internal.Subscription
+	// cancelSub cancels the context the subscription runs in.
+	cancelSub context.CancelFunc
 }
 
 // NewCDCIterator initializes logical replication by creating the publication and subscription manager.
+// The replication slot is created on a separate connection from the one used
+// for streaming, so the exported snapshot can be consumed while streaming.
+// If c.StartupTimeout is set and the setup takes longer, ErrStartupTimeout is
+// returned.
 func NewCDCIterator(ctx context.Context, pgconf *pgconn.Config, c CDCConfig) (*CDCIterator, error) {
-	conn, err := pgconn.ConnectConfig(ctx, withReplication(pgconf))
+	if c.StartupTimeout <= 0 {
+		return newCDCIterator(ctx, pgconf, c)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, c.StartupTimeout, ErrStartupTimeout)
+	defer cancel()
+
+	i, err := newCDCIterator(ctx, pgconf, c)
+	if err != nil && errors.Is(context.Cause(ctx), ErrStartupTimeout) {
+		return nil, fmt.Errorf("%w after %s: %w", ErrStartupTimeout, c.StartupTimeout, err)
+	}
+	return i, err
+}
+
+func newCDCIterator(ctx context.Context, pgconf *pgconn.Config, c CDCConfig) (*CDCIterator, error) {
+	replConf := withKeepalive(withReplication(pgconf), c.Keepalive)
+
+	slotConn, err := pgconn.ConnectConfig(ctx, withStatementTimeout(replConf, c.StatementTimeout))
+	if err != nil {
+		// without the privilege the connection fails with an unclear error,
+		// check if that's the cause on a regular connection
+		if privErr := checkReplicationPrivilege(ctx, pgconf); privErr != nil {
+			err = privErr
+		}
+		return nil, fmt.Errorf("could not establish replication connection: %w", err)
+	}
+
+	slot, err := setupReplication(ctx, slotConn, c)
+	if err != nil {
+		slotConn.Close(ctx)
+		return nil, err
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, replConf)
 	if err != nil {
+		slotConn.Close(ctx)
 		return nil, fmt.Errorf("could not establish replication connection: %w", err)
 	}
 
+	rs := internal.NewRelationSet()
+	rs.UnsupportedTypePolicy = internal.UnsupportedTypePolicy(c.UnsupportedTypes)
+
+	// the streaming connection is idle until the subscription is started
+	if err := types.LoadExtensionTypes(ctx, conn, rs.TypeMap()); err != nil {
+		slotConn.Close(ctx)
+		conn.Close(ctx)
+		return nil, err
+	}
+	if err := types.LoadUserTypes(ctx, conn, rs.TypeMap()); err != nil {
+		slotConn.Close(ctx)
+		conn.Close(ctx)
+		return nil, err
+	}
+	system, err := pglogrepl.IdentifySystem(ctx, conn)
+	if err != nil {
+		slotConn.Close(ctx)
+		conn.Close(ctx)
+		return nil, fmt.Errorf("failed to identify system: %w", err)
+	}
+	walSenderTimeout, err := internal.WALSenderTimeout(ctx, conn)
+	if err != nil {
+		slotConn.Close(ctx)
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	handlerConfig := CDCHandlerConfig{
+		TableKeys:            c.TableKeys,
+		ColumnRenames:        c.ColumnRenames,
+		IntervalComponents:   c.IntervalComponents,
+		FloatSpecials:        c.FloatSpecials,
+		WithDebeziumSchema:   c.WithDebeziumSchema,
+		SchemaRecords:        c.SchemaRecords,
+		DropNoopUpdates:      c.DropNoopUpdates,
+		RequireBeforeImage:   c.RequireBeforeImage,
+		PartialBeforeImage:   PartialBeforeImagePolicy(c.PartialBeforeImage),
+		NullKeys:             NullKeyPolicy(c.NullKeys),
+		NullKeySentinel:      c.NullKeySentinel,
+		KeylessDeletes:       KeylessDeletePolicy(c.KeylessDeletes),
+		RelationChanges:      RelationChangePolicy(c.RelationChanges),
+		CoalesceUpdates:      c.CoalesceUpdates,
+		ExplicitInsertBefore: c.ExplicitInsertBefore,
+		CommitMarkers:        c.CommitMarkers,
+		WithPrevLSN:          c.WithPrevLSN,
+		WithCommitTime:       c.WithCommitTime,
+		WithReceivedAt:       c.WithReceivedAt,
+		WithRelationID:       c.WithRelationID,
+		StartLSN:             c.LSN,
+		StartCommitLSN:       c.CommitLSN,
+		ReplayedChanges:      ReplayedChangePolicy(c.ReplayedChanges),
+		WithApproxSize:       c.WithApproxSize,
+		WithKeyHash:          c.WithKeyHash,
+		SendRetries:          c.SendRetries,
+		SendRetryBackoff:     c.SendRetryBackoff,
+		MaxRecordsPerSecond:  c.MaxRecordsPerSecond,
+		StaticMetadata:       c.StaticMetadata,
+		OverwriteMetadata:    c.OverwriteMetadata,
+		SkipTransactions:     c.SkipTransactions,
+		BufferTransactions:   c.BufferTransactions,
+		TxSpillThreshold:     c.TxSpillThreshold,
+		TxSpillDir:           c.TxSpillDir,
+		Database:             system.DBName,
+		SystemIdentifier:     system.SystemID,
+		DefaultNamespace:     c.DefaultNamespace,
+		MetadataPrefix:       c.MetadataPrefix,
+		PositionCodec:        c.PositionCodec,
+		RowFilter:            c.RowFilter,
+	}
+
+	var catalogConn *pgconn.PgConn
+	withColumnDefaults := (c.WithDebeziumSchema || c.SchemaRecords) && c.WithColumnDefaults
+	if withColumnDefaults || c.WithGeneratedColumns || c.WarnExcludedColumns || c.SkipDroppedTables || c.WithPublication {
+		catalogConn, err = pgconn.ConnectConfig(ctx, pgconf)
+		if err != nil {
+			slotConn.Close(ctx)
+			conn.Close(ctx)
+			return nil, fmt.Errorf("could not establish catalog connection: %w", err)
+		}
+	}
+	if withColumnDefaults {
+		handlerConfig.ColumnDefaults = func(ctx context.Context, relationID uint32) (map[string]string, error) {
+			return internal.ColumnDefaults(ctx, catalogConn, relationID)
+		}
+	}
+	if c.WithGeneratedColumns {
+		handlerConfig.GeneratedColumns = func(ctx context.Context, relationID uint32) ([]string, error) {
+			return internal.GeneratedColumns(ctx, catalogConn, relationID)
+		}
+	}
+	if c.WarnExcludedColumns {
+		handlerConfig.TableColumns = func(ctx context.Context, relationID uint32) ([]string, error) {
+			return internal.PublishableColumns(ctx, catalogConn, relationID)
+		}
+	}
+	if c.SkipDroppedTables {
+		handlerConfig.RelationExists = func(ctx context.Context, relationID uint32) (bool, error) {
+			return internal.RelationExists(ctx, catalogConn, relationID)
+		}
+	}
+
+	if c.WithPublication {
+		publications := append([]string{c.PublicationName}, c.ExtraPublications...)
+		handlerConfig.RelationPublication = func(ctx context.Context, relationID uint32) (string, error) {
+			pubs, err := internal.RelationPublications(ctx, catalogConn, relationID)
+			if err != nil {
+				return "", err
+			}
+			return firstPublication(publications, pubs), nil
+		}
+	}
+
+	if c.QuarantineChanges {
+		handlerConfig.Quarantine = logQuarantinedMessage
+	}
+
+	records := make(chan sdk.Record)
+	handler := NewCDCHandler(rs, records, handlerConfig)
+
+	sub := internal.NewSubscription(
+		conn,
+		c.SlotName,
+		c.PublicationName,
+		c.Tables,
+		c.LSN,
+		handler.Handle,
+	)
+	sub.TXSnapshotID = slot.SnapshotName
+	sub.ExtraPublications = c.ExtraPublications
+	sub.OnProgress = c.OnLSNProgress
+	sub.StatusTimeout = alignStatusInterval(ctx, c.StatusInterval, walSenderTimeout)
+
+	return &CDCIterator{
+		config:      c,
+		records:     records,
+		pgconn:      conn,
+		pgconf:      pgconf,
+		slotConn:    slotConn,
+		catalogConn: catalogConn,
+		handler:     handler,
+		sub:         sub,
+	}, nil
+}
+
+// firstPublication returns the first of the configured publications which
+// contains the relation, so that a relation in multiple publications is always
+// attributed to the same one. Returns an empty string if none contains it.
+func firstPublication(configured, relationPubs []string) string {
+	for _, pub := range configured {
+		if slices.Contains(relationPubs, pub) {
+			return pub
+		}
+	}
+	return ""
+}
+
+// alignStatusInterval returns the interval of standby status updates. If the
+// interval is not shorter than the wal_sender_timeout of the server, a warning
+// is logged and half of the timeout is used instead, so that an update reaches
+// the server in time even if it's delayed.
+func alignStatusInterval(ctx context.Context, interval, walSenderTimeout time.Duration) time.Duration {
+	if interval <= 0 {
+		interval = defaultStatusInterval
+	}
+	if walSenderTimeout <= 0 || interval < walSenderTimeout {
+		return interval
+	}
+
+	aligned := walSenderTimeout / 2
+	sdk.Logger(ctx).Warn().
+		Dur("statusInterval", interval).
+		Dur("walSenderTimeout", walSenderTimeout).
+		Msgf("status interval is not shorter than wal_sender_timeout, using %s instead", aligned)
+	return aligned
+}
+
+// checkReplicationPrivilege checks that the configured role is allowed to use
+// logical replication, using a short-lived regular connection. Only a missing
+// privilege is returned as an error, the check is skipped if the connection or
+// query fails.
+func checkReplicationPrivilege(ctx context.Context, pgconf *pgconn.Config) error {
+	conn, err := pgconn.ConnectConfig(ctx, pgconf)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close(ctx)
+
+	err = internal.CheckReplicationPrivilege(ctx, conn)
+	if errors.Is(err, internal.ErrMissingReplicationPrivilege) {
+		return err
+	}
+	return nil
+}
+
+// setupReplication checks that the server supports logical replication and
+// creates the publication and the replication slot.
+func setupReplication(ctx context.Context, conn *pgconn.PgConn, c CDCConfig) (internal.ReplicationSlot, error) {
+	if err := internal.CheckWALLevel(ctx, conn); err != nil {
+		return internal.ReplicationSlot{}, err
+	}
+
 	if err := internal.CreatePublication(
 		ctx,
 		conn,
@@ -66,53 +405,58 @@ func NewCDCIterator(ctx context.Context, pgconf *pgconn.Config, c CDCConfig) (*C
 		// If creating the publication fails with code 42710, this means
 		// the publication already exists.
 		if !internal.IsPgDuplicateErr(err) {
-			return nil, err
+			return internal.ReplicationSlot{}, err
 		}
 
 		sdk.Logger(ctx).Warn().
 			Msgf("Publication %q already exists.", c.PublicationName)
 	}
 
-	records := make(chan sdk.Record)
-
-	sub, err := internal.CreateSubscription(
-		ctx,
-		conn,
-		c.SlotName,
-		c.PublicationName,
-		c.Tables,
-		c.LSN,
-		NewCDCHandler(internal.NewRelationSet(), c.TableKeys, records).Handle,
-	)
+	slot, err := internal.CreateReplicationSlot(ctx, conn, c.SlotName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize subscription: %w", err)
+		return internal.ReplicationSlot{}, fmt.Errorf("failed to initialize subscription: %w", err)
 	}
 
-	return &CDCIterator{
-		config:  c,
-		records: records,
-		pgconn:  conn,
-		sub:     sub,
-	}, nil
+	return slot, nil
 }
 
 // StartSubscriber starts the logical replication service in the background.
-// Blocks until the subscription becomes ready.
+// Blocks until the subscription becomes ready, fails to start or
+// CDCConfig.StartupTimeout passes.
 func (i *CDCIterator) StartSubscriber(ctx context.Context) error {
 	sdk.Logger(ctx).Info().
 		Str("slot", i.config.SlotName).
 		Str("publication", i.config.PublicationName).
 		Msg("Starting logical replication")
 
+	subCtx, cancel := context.WithCancel(ctx)
+	i.cancelSub = cancel
+
 	go func() {
-		if err := i.sub.Run(ctx); err != nil {
+		if err := i.sub.Run(subCtx); err != nil {
 			sdk.Logger(ctx).Error().
 				Err(err).
 				Msg("replication exited with an error")
 		}
 	}()
 
-	<-i.sub.Ready()
+	var timeout <-chan time.Time
+	if i.config.StartupTimeout > 0 {
+		timer := time.NewTimer(i.config.StartupTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-i.sub.Ready():
+	case <-i.sub.Done():
+		return fmt.Errorf("failed to start logical replication: %w", i.sub.Err())
+	case <-timeout:
+		cancel()
+		return fmt.Errorf("%w after %s", ErrStartupTimeout, i.config.StartupTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	sdk.Logger(ctx).Info().
 		Str("slot", i.config.SlotName).
@@ -132,7 +476,14 @@ func (i *CDCIterator) Next(ctx context.Context) (sdk.Record, error) {
 	}
 
 	for {
+		if r, ok := i.handler.nextBuffered(i.records); ok {
+			return r, nil
+		}
+
 		select {
+		case <-i.handler.resumed:
+			// drain the records buffered while the iterator was paused
+			continue
 		case <-ctx.Done():
 			return sdk.Record{}, ctx.Err()
 		case <-i.sub.Done():
@@ -155,7 +506,11 @@ func (i *CDCIterator) Next(ctx context.Context) (sdk.Record, error) {
 
 // Ack forwards the acknowledgment to the subscription.
 func (i *CDCIterator) Ack(_ context.Context, sdkPos sdk.Position) error {
-	pos, err := position.ParseSDKPosition(sdkPos)
+	codec := i.config.PositionCodec
+	if codec == nil {
+		codec = position.JSONCodec{}
+	}
+	pos, err := codec.Decode(sdkPos)
 	if err != nil {
 		return err
 	}
@@ -182,13 +537,24 @@ func (i *CDCIterator) Ack(_ context.Context, sdkPos sdk.Position) error {
 // error, the error is returned.
 func (i *CDCIterator) Teardown(ctx context.Context) error {
 	defer i.pgconn.Close(ctx)
+	defer i.slotConn.Close(ctx)
+	if i.catalogConn != nil {
+		defer i.catalogConn.Close(ctx)
+	}
+	if i.cancelSub != nil {
+		defer i.cancelSub()
+	}
 
 	if !i.subscriberReady() {
-		return nil
+		return i.handler.Close()
 	}
 
 	i.sub.Stop()
-	return i.sub.Wait(ctx, subscriberDoneTimeout)
+	if err := i.sub.Wait(ctx, subscriberDoneTimeout); err != nil {
+		// the handler could still be in use, don't close it
+		return err
+	}
+	return i.handler.Close()
 }
 
 // subscriberReady returns true when the subscriber is running.
@@ -201,6 +567,35 @@ func (i *CDCIterator) subscriberReady() bool {
 	}
 }
 
+// Pause stops returning new records from Next without stopping logical
+// replication, see CDCHandler.Pause.
+func (i *CDCIterator) Pause() {
+	i.handler.Pause()
+}
+
+// Resume continues returning records from Next, starting with the records
+// received while the iterator was paused, see CDCHandler.Resume. It does not
+// block, the buffered records are returned by the following calls to Next.
+func (i *CDCIterator) Resume() {
+	i.handler.Resume()
+}
+
+// SourceMetadata returns the metadata identifying the database and cluster the
+// records are read from, which is added to every CDC record.
+func (i *CDCIterator) SourceMetadata() map[string]string {
+	return i.handler.SourceMetadata()
+}
+
+// Stats returns the counters collected by the CDC handler.
+func (i *CDCIterator) Stats() HandlerStats {
+	return i.handler.Stats()
+}
+
+// TableOffsets returns the LSN of the last change received per table.
+func (i *CDCIterator) TableOffsets() map[string]pglogrepl.LSN {
+	return i.handler.TableOffsets()
+}
+
 // TXSnapshotID returns the transaction snapshot which is received
 // when the replication slot is created. The value can be empty, when the
 // iterator is resuming.
@@ -220,3 +615,59 @@ func withReplication(pgconf *pgconn.Config) *pgconn.Config {
 
 	return c
 }
+
+// withStatementTimeout returns a copy of the connection config which sets the
+// statement_timeout of the session, so statements waiting for a lock fail
+// instead of blocking indefinitely. The config is returned as it is if the
+// timeout is 0.
+func withStatementTimeout(pgconf *pgconn.Config, timeout time.Duration) *pgconn.Config {
+	if timeout <= 0 {
+		return pgconf
+	}
+	c := pgconf.Copy()
+	if c.RuntimeParams == nil {
+		c.RuntimeParams = make(map[string]string)
+	}
+	c.RuntimeParams["statement_timeout"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	return c
+}
+
+// SetTLSServerName overrides the server name used for SNI and the verification
+// of the server certificate in the connection config and its fallbacks. Configs
+// without TLS are left as they are.
+func SetTLSServerName(pgconf *pgconn.Config, name string) {
+	if name == "" {
+		return
+	}
+	if pgconf.TLSConfig != nil {
+		pgconf.TLSConfig.ServerName = name
+	}
+	for _, fc := range pgconf.Fallbacks {
+		if fc.TLSConfig != nil {
+			fc.TLSConfig.ServerName = name
+		}
+	}
+}
+
+// SetChannelBinding overrides the SCRAM channel binding mode of the connection
+// config, one of "disable", "prefer" or "require". The mode parsed from the
+// connection string is kept if mode is empty.
+func SetChannelBinding(pgconf *pgconn.Config, mode string) {
+	if mode == "" {
+		return
+	}
+	pgconf.ChannelBinding = mode
+}
+
+// logQuarantinedMessage logs a change which can't be decoded, so it can be
+// skipped. The values of the change are left out, they could contain
+// sensitive data.
+func logQuarantinedMessage(ctx context.Context, msg QuarantinedMessage) error {
+	sdk.Logger(ctx).Error().
+		Err(msg.Err).
+		Str("lsn", msg.LSN.String()).
+		Str("messageType", msg.Message.Type().String()).
+		Msg("quarantined change which can't be decoded")
+	return nil
+}
@@ -18,40 +18,83 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
 	sdk "github.com/conduitio/conduit-connector-sdk"
-	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+const (
+	// cleanupAttempts is the number of times a cleanup statement is executed
+	// if it fails with a transient error.
+	cleanupAttempts = 4
+	// cleanupBackoff is the delay before the first retry, it is doubled for
+	// each subsequent retry.
+	cleanupBackoff = 100 * time.Millisecond
+)
+
 type CleanupConfig struct {
 	URL             string
 	SlotName        string
 	PublicationName string
+	// TLSServerName overrides the server name used for TLS, see
+	// SetTLSServerName.
+	TLSServerName string
+	// ChannelBinding overrides the SCRAM channel binding mode, see
+	// SetChannelBinding.
+	ChannelBinding string
+	// StatementTimeout is the statement_timeout of the connection opened by
+	// Cleanup, so that dropping objects locked by other sessions fails
+	// instead of blocking. There is no timeout if it is 0. CleanupConn uses
+	// the settings of the provided connection.
+	StatementTimeout time.Duration
+	// HeartbeatTable is an optional table used for heartbeats, which is
+	// dropped after the replication slot and publication.
+	HeartbeatTable string
 }
 
-// Cleanup drops the provided replication slot and publication.
+// Cleanup drops the provided replication slot, publication and heartbeat table.
 // It will terminate any backends consuming the replication slot before deletion.
 func Cleanup(ctx context.Context, c CleanupConfig) error {
-	logger := sdk.Logger(ctx)
-
 	pgconfig, err := pgconn.ParseConfig(c.URL)
 	if err != nil {
 		return fmt.Errorf("failed to parse config URL: %w", err)
 	}
+	SetTLSServerName(pgconfig, c.TLSServerName)
+	SetChannelBinding(pgconfig, c.ChannelBinding)
 
 	if pgconfig.RuntimeParams == nil {
 		pgconfig.RuntimeParams = make(map[string]string)
 	}
 	pgconfig.RuntimeParams["replication"] = "database"
 
-	conn, err := pgconn.ConnectConfig(ctx, pgconfig)
+	conn, err := pgconn.ConnectConfig(ctx, withStatementTimeout(pgconfig, c.StatementTimeout))
 	if err != nil {
 		return fmt.Errorf("could not establish replication connection: %w", err)
 	}
 	defer conn.Close(ctx)
 
+	err = CleanupConn(ctx, conn, c)
+	if c.StatementTimeout > 0 && internal.IsPgQueryCanceledErr(err) {
+		return fmt.Errorf(
+			"cleanup exceeded the statement timeout of %s, the objects are likely locked by another session: %w",
+			c.StatementTimeout, err,
+		)
+	}
+	return err
+}
+
+// CleanupConn works like Cleanup, but uses the provided connection instead of
+// opening a new one, so tools which clean up repeatedly can reuse it. The
+// connection can be a regular or a replication connection, the URL in the
+// config is ignored. Connections from a pgxpool.Pool can be passed using
+// (*pgxpool.Conn).Conn().PgConn().
+func CleanupConn(ctx context.Context, conn *pgconn.PgConn, c CleanupConfig) error {
+	logger := sdk.Logger(ctx)
+
 	var errs []error
 
 	logger.Debug().
@@ -60,38 +103,137 @@ func Cleanup(ctx context.Context, c CleanupConfig) error {
 		Msg("removing replication slot and publication")
 
 	if c.SlotName != "" {
-		// Terminate any outstanding backends which are consuming the slot before deleting it.
-		mrr := conn.Exec(ctx, fmt.Sprintf(
-			"SELECT pg_terminate_backend(active_pid) FROM pg_replication_slots WHERE slot_name='%s' AND active=true", c.SlotName,
-		))
-		if err := mrr.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("failed to terminate active backends on slot: %w", err))
-		}
-
-		if err := pglogrepl.DropReplicationSlot(
-			ctx,
-			conn,
-			c.SlotName,
-			pglogrepl.DropReplicationSlotOptions{},
-		); err != nil {
-			errs = append(errs, fmt.Errorf("failed to clean up replication slot %q: %w", c.SlotName, err))
+		if err := cleanupSlot(ctx, conn, c.SlotName); err != nil {
+			errs = append(errs, err)
 		}
 	} else {
 		logger.Warn().Msg("cleanup: skipping replication slot cleanup, name is empty")
 	}
 
 	if c.PublicationName != "" {
-		if err := internal.DropPublication(
-			ctx,
-			conn,
-			c.PublicationName,
-			internal.DropPublicationOptions{IfExists: true},
-		); err != nil {
-			errs = append(errs, fmt.Errorf("failed to clean up publication %q: %w", c.PublicationName, err))
+		if err := cleanupPublication(ctx, conn, c.PublicationName); err != nil {
+			errs = append(errs, err)
 		}
 	} else {
 		logger.Warn().Msg("cleanup: skipping publication cleanup, name is empty")
 	}
 
+	// The heartbeat table is dropped last, after nothing is replicating it anymore.
+	if c.HeartbeatTable != "" {
+		if err := retryTransient(ctx, func() error {
+			return conn.Exec(ctx, fmt.Sprintf(
+				"DROP TABLE IF EXISTS %s", pgx.Identifier(strings.Split(c.HeartbeatTable, ".")).Sanitize(),
+			)).Close()
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to clean up heartbeat table %q: %w", c.HeartbeatTable, err))
+		}
+	}
+
 	return errors.Join(errs...)
 }
+
+// SlotExists checks if a replication slot with the name exists. The
+// connection can be a regular or a replication connection.
+func SlotExists(ctx context.Context, conn *pgconn.PgConn, name string) (bool, error) {
+	return internal.SlotExists(ctx, conn, name)
+}
+
+// PublicationExists checks if a publication with the name exists. The
+// connection can be a regular or a replication connection.
+func PublicationExists(ctx context.Context, conn *pgconn.PgConn, name string) (bool, error) {
+	return internal.PublicationExists(ctx, conn, name)
+}
+
+// cleanupSlot terminates any backends consuming the replication slot and drops
+// it. A missing slot is reported as an error.
+func cleanupSlot(ctx context.Context, conn *pgconn.PgConn, name string) error {
+	var exists bool
+	if err := retryTransient(ctx, func() (err error) {
+		exists, err = SlotExists(ctx, conn, name)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to clean up replication slot %q: %w", name, err)
+	}
+	if !exists {
+		return fmt.Errorf("replication slot %q does not exist", name)
+	}
+
+	// Terminate any outstanding backends which are consuming the slot before deleting it.
+	if err := retryTransient(ctx, func() error {
+		return conn.Exec(ctx, fmt.Sprintf(
+			"SELECT pg_terminate_backend(active_pid) FROM pg_replication_slots WHERE slot_name='%s' AND active=true", name,
+		)).Close()
+	}); err != nil {
+		return fmt.Errorf("failed to terminate active backends on slot: %w", err)
+	}
+
+	// The function is used instead of the replication command, so the
+	// slot can also be dropped using a regular connection.
+	if err := retryTransient(ctx, func() error {
+		return conn.Exec(ctx, fmt.Sprintf(
+			"SELECT pg_drop_replication_slot('%s')", name,
+		)).Close()
+	}); err != nil {
+		return fmt.Errorf("failed to clean up replication slot %q: %w", name, err)
+	}
+	return nil
+}
+
+// cleanupPublication drops the publication, a missing publication is skipped.
+func cleanupPublication(ctx context.Context, conn *pgconn.PgConn, name string) error {
+	var exists bool
+	if err := retryTransient(ctx, func() (err error) {
+		exists, err = PublicationExists(ctx, conn, name)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to clean up publication %q: %w", name, err)
+	}
+	if !exists {
+		sdk.Logger(ctx).Debug().
+			Str("publication", name).
+			Msg("cleanup: publication does not exist, skipping")
+		return nil
+	}
+
+	if err := retryTransient(ctx, func() error {
+		return internal.DropPublication(
+			ctx,
+			conn,
+			name,
+			internal.DropPublicationOptions{IfExists: true},
+		)
+	}); err != nil {
+		return fmt.Errorf("failed to clean up publication %q: %w", name, err)
+	}
+	return nil
+}
+
+// retryTransient calls fn until it succeeds, fails with an error that is not
+// transient or the attempts are exhausted. The delay between attempts is
+// doubled after each retry.
+func retryTransient(ctx context.Context, fn func() error) error {
+	return retry(ctx, cleanupAttempts, cleanupBackoff, fn)
+}
+
+func retry(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !internal.IsPgTransientErr(err) {
+			return err
+		}
+
+		sdk.Logger(ctx).Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("cleanup: retrying after transient error")
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
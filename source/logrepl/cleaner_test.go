@@ -17,10 +17,14 @@ package logrepl
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/matryer/is"
 )
 
@@ -112,3 +116,205 @@ func Test_Cleanup(t *testing.T) {
 		})
 	}
 }
+
+func Test_CleanupHeartbeatTable(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+
+	table := test.SetupTestTable(ctx, t, conn)
+	heartbeat := test.RandomIdentifier(t) + "_heartbeat"
+	_, err := conn.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (id int PRIMARY KEY, ts timestamptz)", heartbeat))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP TABLE IF EXISTS "+heartbeat)
+		is.NoErr(err)
+	})
+
+	test.CreatePublication(t, conn, "conduitpub6", []string{table, heartbeat})
+	test.CreateReplicationSlot(t, conn, "conduitslot6")
+
+	is.NoErr(Cleanup(ctx, CleanupConfig{
+		URL:             test.RepmgrConnString,
+		SlotName:        "conduitslot6",
+		PublicationName: "conduitpub6",
+		HeartbeatTable:  heartbeat,
+	}))
+
+	var exists bool
+	is.NoErr(conn.QueryRow(ctx, "SELECT EXISTS(SELECT tablename FROM pg_tables WHERE tablename=$1)", heartbeat).Scan(&exists))
+	is.True(!exists)
+
+	// dropping a missing heartbeat table is not an error
+	is.NoErr(Cleanup(ctx, CleanupConfig{
+		URL:            test.RepmgrConnString,
+		HeartbeatTable: heartbeat,
+	}))
+}
+
+func Test_CleanupStatementTimeout(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+
+	heartbeat := test.RandomIdentifier(t) + "_heartbeat"
+	_, err := conn.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (id int PRIMARY KEY, ts timestamptz)", heartbeat))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP TABLE IF EXISTS "+heartbeat)
+		is.NoErr(err)
+	})
+
+	// hold a lock on the table, so it can't be dropped
+	tx, err := conn.Begin(ctx)
+	is.NoErr(err)
+	_, err = tx.Exec(ctx, fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", heartbeat))
+	is.NoErr(err)
+
+	start := time.Now()
+	err = Cleanup(ctx, CleanupConfig{
+		URL:              test.RepmgrConnString,
+		HeartbeatTable:   heartbeat,
+		StatementTimeout: 200 * time.Millisecond,
+	})
+	is.True(time.Since(start) < 5*time.Second)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "exceeded the statement timeout of 200ms"))
+
+	var pgErr *pgconn.PgError
+	is.True(errors.As(err, &pgErr))
+	is.Equal(pgErr.Code, pgerrcode.QueryCanceled)
+
+	is.NoErr(tx.Rollback(ctx))
+}
+
+func Test_CleanupConn(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+
+	table := test.SetupTestTable(ctx, t, conn)
+	test.CreatePublication(t, conn, "conduitpub7", []string{table})
+	test.CreateReplicationSlot(t, conn, "conduitslot7")
+	test.CreateReplicationSlot(t, conn, "conduitslot8")
+
+	// the same connection is reused for multiple calls
+	is.NoErr(CleanupConn(ctx, conn.PgConn(), CleanupConfig{
+		SlotName:        "conduitslot7",
+		PublicationName: "conduitpub7",
+	}))
+	is.NoErr(CleanupConn(ctx, conn.PgConn(), CleanupConfig{
+		SlotName: "conduitslot8",
+	}))
+
+	var slots int
+	is.NoErr(conn.QueryRow(
+		ctx,
+		"SELECT count(*) FROM pg_replication_slots WHERE slot_name IN ('conduitslot7', 'conduitslot8')",
+	).Scan(&slots))
+	is.Equal(slots, 0)
+	is.True(!conn.PgConn().IsClosed())
+}
+
+func Test_SlotExists(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+
+	test.CreateReplicationSlot(t, conn, "conduitslot9")
+
+	exists, err := SlotExists(ctx, conn.PgConn(), "conduitslot9")
+	is.NoErr(err)
+	is.True(exists)
+
+	exists, err = SlotExists(ctx, conn.PgConn(), "conduitslot_missing")
+	is.NoErr(err)
+	is.True(!exists)
+
+	// Cleanup looks up the slot on a replication connection
+	exists, err = SlotExists(ctx, test.ConnectReplication(ctx, t, test.RepmgrConnString), "conduitslot9")
+	is.NoErr(err)
+	is.True(exists)
+}
+
+func Test_PublicationExists(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+
+	table := test.SetupTestTable(ctx, t, conn)
+	test.CreatePublication(t, conn, "conduitpub9", []string{table})
+
+	exists, err := PublicationExists(ctx, conn.PgConn(), "conduitpub9")
+	is.NoErr(err)
+	is.True(exists)
+
+	exists, err = PublicationExists(ctx, conn.PgConn(), "conduitpub_missing")
+	is.NoErr(err)
+	is.True(!exists)
+
+	// Cleanup looks up the publication on a replication connection
+	exists, err = PublicationExists(ctx, test.ConnectReplication(ctx, t, test.RepmgrConnString), "conduitpub9")
+	is.NoErr(err)
+	is.True(exists)
+}
+
+func Test_retry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			desc:      "succeeds after transient errors",
+			errs:      []error{&pgconn.PgError{Code: pgerrcode.DeadlockDetected}, &pgconn.PgError{Code: pgerrcode.SerializationFailure}, nil},
+			wantCalls: 3,
+		},
+		{
+			desc:      "fails immediately on connection exception",
+			errs:      []error{&pgconn.PgError{Code: pgerrcode.ProtocolViolation}, nil},
+			wantCalls: 1,
+			wantErr:   &pgconn.PgError{Code: pgerrcode.ProtocolViolation},
+		},
+		{
+			desc:      "fails immediately on permanent error",
+			errs:      []error{&pgconn.PgError{Code: pgerrcode.InsufficientPrivilege}, nil},
+			wantCalls: 1,
+			wantErr:   &pgconn.PgError{Code: pgerrcode.InsufficientPrivilege},
+		},
+		{
+			desc: "gives up after all attempts",
+			errs: []error{
+				&pgconn.PgError{Code: pgerrcode.DeadlockDetected},
+				&pgconn.PgError{Code: pgerrcode.DeadlockDetected},
+				&pgconn.PgError{Code: pgerrcode.DeadlockDetected},
+				nil,
+			},
+			wantCalls: 3,
+			wantErr:   &pgconn.PgError{Code: pgerrcode.DeadlockDetected},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			is := is.New(t)
+
+			var calls int
+			err := retry(ctx, 3, time.Millisecond, func() error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			})
+
+			is.Equal(calls, tc.wantCalls)
+			if tc.wantErr != nil {
+				is.Equal(err.Error(), tc.wantErr.Error())
+			} else {
+				is.NoErr(err)
+			}
+		})
+	}
+}
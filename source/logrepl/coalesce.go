@@ -0,0 +1,154 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// coalescer holds back updates for a time window and only keeps the latest
+// update per key. Pending updates are emitted in the order of their latest
+// change when the window ends or before any other record is emitted, so the
+// commit order across keys is preserved.
+type coalescer struct {
+	window time.Duration
+	emit   func(context.Context, sdk.Record) error
+	// carried are metadata keys which are only added to a single record,
+	// e.g. after the key columns of a relation changed. They are copied from
+	// a replaced update to the update replacing it, unless it has its own
+	// value, so they are not lost.
+	carried []string
+
+	// lock guards pending, timer and gen, it is held while records are
+	// emitted, so the flush triggered by the timer can't interleave with new
+	// records.
+	lock    sync.Mutex
+	pending []sdk.Record
+	timer   *time.Timer
+	// gen is incremented on each flush, so a timer which fired while the
+	// window was flushed already does not cut the next window short.
+	gen uint64
+}
+
+// add emits the record or holds it back, if it is an update.
+func (c *coalescer) add(ctx context.Context, rec sdk.Record) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if rec.Operation != sdk.OperationUpdate {
+		if err := c.flushLocked(ctx); err != nil {
+			return err
+		}
+		return c.emit(ctx, rec)
+	}
+
+	key := coalesceKey(rec)
+	for i, p := range c.pending {
+		if coalesceKey(p) == key {
+			// the latest update replaces the pending one and moves to the end
+			c.carryMetadata(p, rec)
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			break
+		}
+	}
+	c.pending = append(c.pending, rec)
+
+	if c.timer == nil {
+		gen := c.gen
+		c.timer = time.AfterFunc(c.window, func() {
+			if err := c.flushGen(ctx, gen); err != nil {
+				sdk.Logger(ctx).Error().Err(err).Msg("failed to flush coalesced updates")
+			}
+		})
+	}
+	return nil
+}
+
+// carryMetadata copies the carried metadata of the replaced record to the
+// record replacing it.
+func (c *coalescer) carryMetadata(replaced, rec sdk.Record) {
+	for _, k := range c.carried {
+		v, ok := replaced.Metadata[k]
+		if !ok {
+			continue
+		}
+		if _, ok := rec.Metadata[k]; !ok {
+			rec.Metadata[k] = v
+		}
+	}
+}
+
+// flush emits all pending updates.
+func (c *coalescer) flush(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.flushLocked(ctx)
+}
+
+// flushGen emits all pending updates, if the window with the generation was
+// not flushed yet.
+func (c *coalescer) flushGen(ctx context.Context, gen uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if gen != c.gen {
+		return nil
+	}
+	return c.flushLocked(ctx)
+}
+
+func (c *coalescer) flushLocked(ctx context.Context) error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+		c.gen++
+	}
+
+	for len(c.pending) > 0 {
+		if err := c.emit(ctx, c.pending[0]); err != nil {
+			return err
+		}
+		c.pending = c.pending[1:]
+	}
+	c.pending = nil
+	return nil
+}
+
+// stop stops the timer of the current window and discards pending updates.
+// Their positions were never acknowledged, so they are read again after a
+// restart.
+func (c *coalescer) stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+		c.gen++
+	}
+	c.pending = nil
+}
+
+// coalesceKey identifies the row changed by the record.
+func coalesceKey(rec sdk.Record) string {
+	var key []byte
+	if rec.Key != nil {
+		key = rec.Key.Bytes()
+	}
+	return rec.Metadata[sdk.MetadataCollection] + "\x00" + string(key)
+}
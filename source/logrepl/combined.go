@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/source/position"
 	"github.com/conduitio/conduit-connector-postgres/source/snapshot"
@@ -41,13 +42,67 @@ type CombinedIterator struct {
 }
 
 type Config struct {
-	Position          sdk.Position
-	SlotName          string
-	PublicationName   string
-	Tables            []string
-	TableKeys         map[string]string
-	WithSnapshot      bool
-	SnapshotFetchSize int
+	Position        sdk.Position
+	SlotName        string
+	PublicationName string
+	// ExtraPublications are existing publications streamed together
+	// with PublicationName.
+	ExtraPublications    []string
+	Tables               []string
+	TableKeys            map[string]string
+	ColumnRenames        map[string]map[string]string
+	IntervalComponents   bool
+	FloatSpecials        func(name string) any
+	WithSnapshot         bool
+	SnapshotFetchSize    int
+	WithSequences        bool
+	SnapshotParallelism  int
+	WithDebeziumSchema   bool
+	SchemaRecords        bool
+	WithColumnDefaults   bool
+	WithGeneratedColumns bool
+	WarnExcludedColumns  bool
+	SkipDroppedTables    bool
+	QuarantineChanges    bool
+	DropNoopUpdates      bool
+	RequireBeforeImage   bool
+	PartialBeforeImage   string
+	NullKeys             string
+	NullKeySentinel      string
+	KeylessDeletes       string
+	RelationChanges      string
+	ReplayedChanges      string
+	CoalesceUpdates      time.Duration
+	ExplicitInsertBefore bool
+	CommitMarkers        bool
+	WithPrevLSN          bool
+	WithCommitTime       bool
+	WithReceivedAt       bool
+	WithRelationID       bool
+	WithPublication      bool
+	WithApproxSize       bool
+	WithKeyHash          bool
+	SendRetries          int
+	SendRetryBackoff     time.Duration
+	MaxRecordsPerSecond  int
+	StaticMetadata       map[string]string
+	OverwriteMetadata    bool
+	SkipTransactions     []uint32
+	BufferTransactions   bool
+	TxSpillThreshold     int
+	TxSpillDir           string
+	UnsupportedTypes     string
+	DefaultNamespace     string
+	MetadataPrefix       string
+	StartupTimeout       time.Duration
+	StatementTimeout     time.Duration
+	Keepalive            KeepaliveConfig
+	StatusInterval       time.Duration
+	OnLSNProgress        func(LSNProgress)
+	RowFilter            func(table string, values map[string]any) bool
+	// PositionCodec encodes and decodes the positions of snapshot and CDC
+	// records. Defaults to position.JSONCodec.
+	PositionCodec position.Codec
 }
 
 // Validate performs validation tasks on the config.
@@ -66,7 +121,11 @@ func (c Config) Validate() error {
 // NewCombinedIterator will initialize and start the Snapshot and CDC iterators.
 // Failure to parse the position or validate the config will return an error.
 func NewCombinedIterator(ctx context.Context, pool *pgxpool.Pool, conf Config) (*CombinedIterator, error) {
-	pos, err := position.ParseSDKPosition(conf.Position)
+	if conf.PositionCodec == nil {
+		conf.PositionCodec = position.JSONCodec{}
+	}
+
+	pos, err := conf.PositionCodec.Decode(conf.Position)
 	if err != nil {
 		sdk.Logger(ctx).Debug().
 			Err(err).
@@ -129,6 +188,14 @@ func (c *CombinedIterator) Next(ctx context.Context) (sdk.Record, error) {
 		return c.activeIterator.Next(ctx)
 	}
 
+	if c.activeIterator == c.snapshotIterator {
+		// CDC records contain the source metadata already
+		for k, v := range c.cdcIterator.SourceMetadata() {
+			r.Metadata[k] = v
+		}
+		mergeMetadata(r.Metadata, c.conf.StaticMetadata, c.conf.OverwriteMetadata)
+	}
+
 	return r, nil
 }
 
@@ -170,13 +237,66 @@ func (c *CombinedIterator) initCDCIterator(ctx context.Context, pos position.Pos
 	if err != nil {
 		return fmt.Errorf("failed to parse LSN in position: %w", err)
 	}
+	commitLSN, err := pos.CommitLSN()
+	if err != nil {
+		return fmt.Errorf("failed to parse commit LSN in position: %w", err)
+	}
 
 	cdcIterator, err := NewCDCIterator(ctx, &c.pool.Config().ConnConfig.Config, CDCConfig{
-		LSN:             lsn,
-		SlotName:        c.conf.SlotName,
-		PublicationName: c.conf.PublicationName,
-		Tables:          c.conf.Tables,
-		TableKeys:       c.conf.TableKeys,
+		LSN:                  lsn,
+		CommitLSN:            commitLSN,
+		SlotName:             c.conf.SlotName,
+		PublicationName:      c.conf.PublicationName,
+		ExtraPublications:    c.conf.ExtraPublications,
+		Tables:               c.conf.Tables,
+		TableKeys:            c.conf.TableKeys,
+		ColumnRenames:        c.conf.ColumnRenames,
+		IntervalComponents:   c.conf.IntervalComponents,
+		FloatSpecials:        c.conf.FloatSpecials,
+		WithDebeziumSchema:   c.conf.WithDebeziumSchema,
+		SchemaRecords:        c.conf.SchemaRecords,
+		WithColumnDefaults:   c.conf.WithColumnDefaults,
+		WithGeneratedColumns: c.conf.WithGeneratedColumns,
+		WarnExcludedColumns:  c.conf.WarnExcludedColumns,
+		SkipDroppedTables:    c.conf.SkipDroppedTables,
+		QuarantineChanges:    c.conf.QuarantineChanges,
+		DropNoopUpdates:      c.conf.DropNoopUpdates,
+		RequireBeforeImage:   c.conf.RequireBeforeImage,
+		PartialBeforeImage:   c.conf.PartialBeforeImage,
+		NullKeys:             c.conf.NullKeys,
+		NullKeySentinel:      c.conf.NullKeySentinel,
+		KeylessDeletes:       c.conf.KeylessDeletes,
+		RelationChanges:      c.conf.RelationChanges,
+		ReplayedChanges:      c.conf.ReplayedChanges,
+		CoalesceUpdates:      c.conf.CoalesceUpdates,
+		ExplicitInsertBefore: c.conf.ExplicitInsertBefore,
+		CommitMarkers:        c.conf.CommitMarkers,
+		WithPrevLSN:          c.conf.WithPrevLSN,
+		WithCommitTime:       c.conf.WithCommitTime,
+		WithReceivedAt:       c.conf.WithReceivedAt,
+		WithRelationID:       c.conf.WithRelationID,
+		WithPublication:      c.conf.WithPublication,
+		WithApproxSize:       c.conf.WithApproxSize,
+		WithKeyHash:          c.conf.WithKeyHash,
+		SendRetries:          c.conf.SendRetries,
+		SendRetryBackoff:     c.conf.SendRetryBackoff,
+		MaxRecordsPerSecond:  c.conf.MaxRecordsPerSecond,
+		StaticMetadata:       c.conf.StaticMetadata,
+		OverwriteMetadata:    c.conf.OverwriteMetadata,
+		SkipTransactions:     c.conf.SkipTransactions,
+		BufferTransactions:   c.conf.BufferTransactions,
+		TxSpillThreshold:     c.conf.TxSpillThreshold,
+		TxSpillDir:           c.conf.TxSpillDir,
+		UnsupportedTypes:     c.conf.UnsupportedTypes,
+		DefaultNamespace:     c.conf.DefaultNamespace,
+		MetadataPrefix:       c.conf.MetadataPrefix,
+		StartupTimeout:       c.conf.StartupTimeout,
+		StatementTimeout:     c.conf.StatementTimeout,
+		Keepalive:            c.conf.Keepalive,
+		StatusInterval:       c.conf.StatusInterval,
+		OnLSNProgress:        c.conf.OnLSNProgress,
+		RowFilter:            c.conf.RowFilter,
+		PositionCodec:        c.conf.PositionCodec,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create CDC iterator: %w", err)
@@ -198,11 +318,19 @@ func (c *CombinedIterator) initSnapshotIterator(ctx context.Context, pos positio
 	}
 
 	snapshotIterator, err := snapshot.NewIterator(ctx, c.pool, snapshot.Config{
-		Position:     c.conf.Position,
-		Tables:       c.conf.Tables,
-		TableKeys:    c.conf.TableKeys,
-		TXSnapshotID: c.cdcIterator.TXSnapshotID(),
-		FetchSize:    c.conf.SnapshotFetchSize,
+		Position:           c.conf.Position,
+		Tables:             c.conf.Tables,
+		TableKeys:          c.conf.TableKeys,
+		ColumnRenames:      c.conf.ColumnRenames,
+		IntervalComponents: c.conf.IntervalComponents,
+		FloatSpecials:      c.conf.FloatSpecials,
+		WithKeyHash:        c.conf.WithKeyHash,
+		MetadataPrefix:     c.conf.MetadataPrefix,
+		TXSnapshotID:       c.cdcIterator.TXSnapshotID(),
+		FetchSize:          c.conf.SnapshotFetchSize,
+		PositionCodec:      c.conf.PositionCodec,
+		WithSequences:      c.conf.WithSequences,
+		Parallelism:        c.conf.SnapshotParallelism,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create snapshot iterator: %w", err)
@@ -162,6 +162,8 @@ func TestCombinedIterator_Next(t *testing.T) {
 	is.NoErr(err)
 
 	var lastPos sdk.Position
+	// snapshotPos is the position of the last snapshot record
+	var snapshotPos position.Position
 
 	expectedRecords := testRecords()
 
@@ -175,6 +177,13 @@ func TestCombinedIterator_Next(t *testing.T) {
 			jsonPos := fmt.Sprintf(`{"type":1,"snapshots":{"%s":{"last_read":%d,"snapshot_end":4}}}`, table, id)
 			is.Equal(string(r.Position), jsonPos)
 
+			pos, err := position.ParseSDKPosition(r.Position)
+			is.NoErr(err)
+			order, err := position.Compare(snapshotPos, pos)
+			is.NoErr(err)
+			is.Equal(order, -1) // snapshot positions increase
+			snapshotPos = pos
+
 			is.Equal("", cmp.Diff(
 				expectedRecords[id],
 				r.Payload.After.(sdk.StructuredData),
@@ -198,6 +207,11 @@ func TestCombinedIterator_Next(t *testing.T) {
 		is.NoErr(err)
 		is.True(lsn != 0)
 
+		// the first CDC record sorts after all snapshot records
+		order, err := position.Compare(snapshotPos, pos)
+		is.NoErr(err)
+		is.Equal(order, -1)
+
 		is.Equal("", cmp.Diff(
 			expectedRecords[5],
 			r.Payload.After.(sdk.StructuredData),
@@ -15,37 +15,707 @@
 package logrepl
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
 	"github.com/conduitio/conduit-connector-postgres/source/position"
+	"github.com/conduitio/conduit-connector-postgres/source/types"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pglogrepl"
+	"golang.org/x/time/rate"
 )
 
+const (
+	// DefaultMetadataPrefix is the prefix of all Postgres specific metadata
+	// keys, unless a different prefix is configured in CDCHandlerConfig.
+	DefaultMetadataPrefix = "postgres."
+
+	// MetadataSkippedColumns is the metadata key containing a comma separated list
+	// of columns left out of the payload because their type is not supported.
+	MetadataSkippedColumns = DefaultMetadataPrefix + "skippedColumns"
+	// MetadataKeyColumns is the metadata key containing a comma separated list
+	// of the key columns of the relation, as reported by Postgres. It is only
+	// added to the first record after the key columns of a relation change.
+	MetadataKeyColumns = DefaultMetadataPrefix + "keyColumns"
+	// MetadataGeneratedColumns is the metadata key containing a comma separated
+	// list of generated columns in the relation. Sinks should not write these
+	// columns back.
+	MetadataGeneratedColumns = DefaultMetadataPrefix + "generatedColumns"
+	// MetadataExcludedColumns is the metadata key containing a comma separated
+	// list of columns of the table which are not replicated, e.g. because the
+	// column list of the publication excludes them, see
+	// CDCHandlerConfig.TableColumns.
+	MetadataExcludedColumns = DefaultMetadataPrefix + "excludedColumns"
+	// MetadataNamespace is the metadata key containing the namespace (schema)
+	// of the relation. It is only added to the first record after the
+	// namespace or replica identity of a relation change.
+	MetadataNamespace = DefaultMetadataPrefix + "namespace"
+	// MetadataReplicaIdentity is the metadata key containing the replica
+	// identity of the relation (default, nothing, full or index), which
+	// determines the old values contained in updates and deletes. It is added
+	// together with MetadataNamespace.
+	MetadataReplicaIdentity = DefaultMetadataPrefix + "replicaIdentity"
+	// MetadataPartialBeforeImage is the metadata key set to "true" on updates
+	// whose before image does not contain the old values of all columns.
+	MetadataPartialBeforeImage = DefaultMetadataPrefix + "partialBeforeImage"
+	// MetadataDatabase is the metadata key containing the name of the database
+	// the record was read from.
+	MetadataDatabase = DefaultMetadataPrefix + "database"
+	// MetadataSystemIdentifier is the metadata key containing the system
+	// identifier of the Postgres cluster the record was read from.
+	MetadataSystemIdentifier = DefaultMetadataPrefix + "systemIdentifier"
+	// MetadataCommitLSN is the metadata key containing the LSN of the commit
+	// of a transaction. It is only added to commit markers, see
+	// CDCHandlerConfig.CommitMarkers.
+	MetadataCommitLSN = DefaultMetadataPrefix + "commitLSN"
+	// MetadataCommitTime is the metadata key containing the commit time of a
+	// transaction in RFC 3339 format. It is added together with
+	// MetadataCommitLSN and to the changes of the transaction, see
+	// CDCHandlerConfig.WithCommitTime.
+	MetadataCommitTime = DefaultMetadataPrefix + "commitTime"
+	// MetadataReceivedAt is the metadata key containing the time the handler
+	// received the change in RFC 3339 format, see
+	// CDCHandlerConfig.WithReceivedAt.
+	MetadataReceivedAt = DefaultMetadataPrefix + "receivedAt"
+	// MetadataBatchStartLSN is the metadata key containing the LSN of the
+	// first change of a buffered transaction. It is only added to records of
+	// buffered transactions, see CDCHandlerConfig.BufferTransactions.
+	MetadataBatchStartLSN = DefaultMetadataPrefix + "batchStartLSN"
+	// MetadataBatchEndLSN is the metadata key containing the LSN of the last
+	// change of a buffered transaction. It is added together with
+	// MetadataBatchStartLSN.
+	MetadataBatchEndLSN = DefaultMetadataPrefix + "batchEndLSN"
+	// MetadataPrevLSN is the metadata key containing the LSN of the record
+	// emitted before the record, see CDCHandlerConfig.WithPrevLSN.
+	MetadataPrevLSN = DefaultMetadataPrefix + "prevLSN"
+	// MetadataRelationID is the metadata key containing the OID of the
+	// relation in pg_class, see CDCHandlerConfig.WithRelationID.
+	MetadataRelationID = DefaultMetadataPrefix + "relationID"
+	// MetadataPublication is the metadata key containing the name of the
+	// publication the relation is streamed from, see
+	// CDCHandlerConfig.RelationPublication.
+	MetadataPublication = DefaultMetadataPrefix + "publication"
+	// MetadataApproxSize is the metadata key containing the approximate size
+	// of the record payload serialized as JSON in bytes, see
+	// CDCHandlerConfig.WithApproxSize.
+	MetadataApproxSize = DefaultMetadataPrefix + "approxSize"
+	// MetadataReplayed is the metadata key set to "true" on changes which
+	// were already emitted before the replication stream was resumed, see
+	// ReplayedChangeMark.
+	MetadataReplayed = DefaultMetadataPrefix + "replayed"
+	// MetadataKeyHash is the metadata key containing the hash of the record
+	// key, see CDCHandlerConfig.WithKeyHash.
+	MetadataKeyHash = DefaultMetadataPrefix + "keyHash"
+)
+
+// PartialBeforeImagePolicy determines what happens with before images of
+// updates, which don't contain the old values of all columns.
+type PartialBeforeImagePolicy string
+
+const (
+	// PartialBeforeImageInclude includes the old values which are available in
+	// the before image and flags the record with MetadataPartialBeforeImage.
+	PartialBeforeImageInclude PartialBeforeImagePolicy = "include"
+	// PartialBeforeImageDrop leaves the before image out of the record.
+	PartialBeforeImageDrop PartialBeforeImagePolicy = "drop"
+)
+
+// NullKeyPolicy determines how NULL values in key columns are written to the
+// record key.
+type NullKeyPolicy string
+
+const (
+	// NullKeyFail fails the change.
+	NullKeyFail NullKeyPolicy = "fail"
+	// NullKeySentinel writes CDCHandlerConfig.NullKeySentinel to the key.
+	NullKeySentinel NullKeyPolicy = "sentinel"
+	// NullKeyNull writes an explicit null to the key.
+	NullKeyNull NullKeyPolicy = "null"
+)
+
+// KeylessDeletePolicy determines what happens with deletes which don't contain
+// the old tuple, so the key of the deleted row is unknown.
+type KeylessDeletePolicy string
+
+const (
+	// KeylessDeleteFail fails the change.
+	KeylessDeleteFail KeylessDeletePolicy = "fail"
+	// KeylessDeleteSkip drops the change and logs a warning.
+	KeylessDeleteSkip KeylessDeletePolicy = "skip"
+	// KeylessDeleteTombstone emits a delete record without a key.
+	KeylessDeleteTombstone KeylessDeletePolicy = "tombstone"
+)
+
+// RelationChangePolicy determines what happens if a relation message replaces a
+// known relation with a different column layout, e.g. after reconnecting to a
+// table which was altered in the meantime.
+type RelationChangePolicy string
+
+const (
+	// RelationChangeReplace emits pending updates decoded with the old layout,
+	// logs the change and continues with the new layout.
+	RelationChangeReplace RelationChangePolicy = "replace"
+	// RelationChangeFail fails the relation message.
+	RelationChangeFail RelationChangePolicy = "fail"
+)
+
+// ReplayedChangePolicy determines what happens with changes which were already
+// emitted before the stream was resumed from CDCHandlerConfig.StartLSN.
+// Postgres resends whole transactions committed after the confirmed position,
+// so after a restart the stream can contain the transaction of the last
+// emitted change and transactions committed before it. Changes are emitted in
+// commit order and changes of concurrent transactions interleave in the WAL,
+// so a change is compared by the commit LSN of its transaction first and its
+// own LSN second, see CDCHandlerConfig.StartCommitLSN.
+type ReplayedChangePolicy string
+
+const (
+	// ReplayedChangeKeep emits replayed changes like any other change.
+	ReplayedChangeKeep ReplayedChangePolicy = "keep"
+	// ReplayedChangeDrop drops replayed changes.
+	ReplayedChangeDrop ReplayedChangePolicy = "drop"
+	// ReplayedChangeMark emits replayed changes with MetadataReplayed.
+	ReplayedChangeMark ReplayedChangePolicy = "mark"
+)
+
+// FilterReason describes why a change was dropped by the handler instead of
+// being sent out as a record.
+type FilterReason string
+
+const (
+	// FilterReasonTable is used for changes in tables the connector is not
+	// configured to read from (e.g. tables added to an existing publication).
+	FilterReasonTable FilterReason = "table"
+	// FilterReasonDroppedTable is used for changes which can't be decoded,
+	// because the table was dropped in the meantime.
+	FilterReasonDroppedTable FilterReason = "droppedTable"
+	// FilterReasonNoopUpdate is used for updates which did not change any
+	// value.
+	FilterReasonNoopUpdate FilterReason = "noopUpdate"
+	// FilterReasonSkippedTransaction is used for changes in transactions
+	// which are configured to be skipped.
+	FilterReasonSkippedTransaction FilterReason = "skippedTransaction"
+	// FilterReasonKeylessDelete is used for deletes without an old tuple,
+	// which are configured to be skipped.
+	FilterReasonKeylessDelete FilterReason = "keylessDelete"
+	// FilterReasonQuarantined is used for changes which can't be decoded and
+	// were passed to the quarantine.
+	FilterReasonQuarantined FilterReason = "quarantined"
+	// FilterReasonRow is used for changes of rows which don't match
+	// CDCHandlerConfig.RowFilter.
+	FilterReasonRow FilterReason = "row"
+	// FilterReasonReplayed is used for changes which were already emitted
+	// before the replication stream was resumed, see ReplayedChangeDrop.
+	FilterReasonReplayed FilterReason = "replayed"
+)
+
+// QuarantinedMessage is a change which could not be decoded, see
+// CDCHandlerConfig.Quarantine.
+type QuarantinedMessage struct {
+	// Message is the logical replication message as received from Postgres.
+	Message pglogrepl.Message
+	// LSN is the position of the message in the WAL.
+	LSN pglogrepl.LSN
+	// Err is the error returned while decoding the message.
+	Err error
+}
+
+// HandlerStats contains counters collected by CDCHandler.
+type HandlerStats struct {
+	// Filtered contains the number of dropped changes by reason.
+	Filtered map[FilterReason]uint64
+	// UnknownMessages contains the number of received messages the handler
+	// does not know how to handle by message type.
+	UnknownMessages map[string]uint64
+}
+
+// CDCHandlerConfig holds configuration values for CDCHandler.
+type CDCHandlerConfig struct {
+	// TableKeys maps table names to their key column. Composite keys are
+	// configured as a comma separated list of columns.
+	TableKeys map[string]string
+	// ColumnRenames maps table names to the new names of their columns by
+	// the original name. Renamed columns get the new name in the key,
+	// payload and Debezium schema of records. The table names are the same
+	// as in TableKeys, they can be qualified with the schema.
+	ColumnRenames map[string]map[string]string
+	// IntervalComponents writes intervals in payloads as their months, days
+	// and microseconds, see types.IntervalFormatter.Components.
+	IntervalComponents bool
+	// FloatSpecials replaces the special values NaN, Infinity and -Infinity
+	// of floats in payloads, if set. It's called with the name of the value.
+	FloatSpecials func(name string) any
+	// WithDebeziumSchema attaches a Debezium-style schema describing the
+	// payload to each record.
+	WithDebeziumSchema bool
+	// SchemaRecords emits a record containing the Debezium-style schema of a
+	// relation when its layout is first seen or changes, instead of attaching
+	// the schema to each record. Records reference the schema by its ID in
+	// MetadataSchemaID. Schema records are emitted in SchemaCollection.
+	SchemaRecords bool
+	// ColumnDefaults returns the default value expressions of the columns in
+	// the relation. If set, the defaults are included in the Debezium schema.
+	ColumnDefaults func(ctx context.Context, relationID uint32) (map[string]string, error)
+	// GeneratedColumns returns the generated columns of the relation. If set,
+	// the generated columns are listed in the metadata of each record.
+	GeneratedColumns func(ctx context.Context, relationID uint32) ([]string, error)
+	// TableColumns returns the columns of the table which can be replicated.
+	// If set, columns of the table missing from the relation, e.g. columns
+	// added after the publication was created with a column list, are logged
+	// and listed in the metadata of each record.
+	TableColumns func(ctx context.Context, relationID uint32) ([]string, error)
+	// RelationExists checks if a relation still exists in the catalog. If set,
+	// changes which reference an unknown relation or fail to decode are
+	// skipped if the relation does not exist anymore, instead of failing.
+	RelationExists func(ctx context.Context, relationID uint32) (bool, error)
+	// RelationPublication returns the name of the publication the relation
+	// is streamed from, or an empty string if it is unknown. If set, the
+	// publication is added to the metadata of each record.
+	RelationPublication func(ctx context.Context, relationID uint32) (string, error)
+	// Quarantine receives changes which can't be decoded. If set, these
+	// changes are skipped instead of failing the stream, unless Quarantine
+	// returns an error.
+	Quarantine func(ctx context.Context, msg QuarantinedMessage) error
+	// RowFilter drops changes of rows it returns false for, which can be used
+	// to filter rows on servers without row filters in publications. It is
+	// called with the table name and the new values of inserts and updates,
+	// and the old values of deletes. The old values of deletes only contain
+	// the replica identity columns, unless the table has REPLICA IDENTITY
+	// FULL.
+	RowFilter func(table string, values map[string]any) bool
+	// DropNoopUpdates drops updates which did not change any value. This can
+	// only be detected if the old tuple contains all columns, i.e. the table
+	// has REPLICA IDENTITY FULL.
+	DropNoopUpdates bool
+	// RequireBeforeImage fails updates which don't contain the old values of
+	// all columns, i.e. updates of tables without REPLICA IDENTITY FULL,
+	// instead of emitting them without a before image.
+	RequireBeforeImage bool
+	// PartialBeforeImage is applied to updates with a before image which only
+	// contains some of the old values, e.g. only the key columns or values
+	// which could not be decoded. Defaults to PartialBeforeImageInclude.
+	PartialBeforeImage PartialBeforeImagePolicy
+	// NullKeys is applied to NULL values in key columns, which are possible
+	// if the key column is not the primary key. Defaults to NullKeyFail.
+	NullKeys NullKeyPolicy
+	// NullKeySentinel is written to the key instead of NULL values with
+	// NullKeySentinel.
+	NullKeySentinel string
+	// KeylessDeletes is applied to deletes which don't contain the old tuple.
+	// Defaults to KeylessDeleteFail.
+	KeylessDeletes KeylessDeletePolicy
+	// RelationChanges is applied to relation messages which change the
+	// column layout of a known relation. Defaults to RelationChangeReplace.
+	RelationChanges RelationChangePolicy
+	// CoalesceUpdates holds back updates for the duration and only sends the
+	// latest update per key, if set. Pending updates are sent before any other
+	// record, so the commit order across keys is preserved.
+	CoalesceUpdates time.Duration
+	// ExplicitInsertBefore sets the before image of inserts to null structured
+	// data instead of leaving it out, so inserts have the same payload shape
+	// as updates.
+	ExplicitInsertBefore bool
+	// CommitMarkers emits a record without key and payload after the changes
+	// of each transaction, containing MetadataCommitLSN and
+	// MetadataCommitTime.
+	CommitMarkers bool
+	// WithPrevLSN adds the LSN of the previously emitted record to each
+	// record in MetadataPrevLSN, so consumers can detect gaps. The first
+	// record gets StartLSN.
+	WithPrevLSN bool
+	// WithCommitTime adds the commit time of the transaction to each record
+	// in MetadataCommitTime.
+	WithCommitTime bool
+	// WithReceivedAt adds the time the change was received by the handler to
+	// each record in MetadataReceivedAt. Unlike the commit time, it shows
+	// how far the connector lags behind.
+	WithReceivedAt bool
+	// StartLSN is the LSN the replication stream resumes from, i.e. the LSN
+	// of the last record emitted before a restart.
+	StartLSN pglogrepl.LSN
+	// StartCommitLSN is the commit LSN of the transaction of the record at
+	// StartLSN. Changes of transactions committed before it and changes of
+	// the same transaction at or below StartLSN were already emitted. No
+	// changes are detected as replayed if it is 0, e.g. when resuming from a
+	// position written without the commit LSN.
+	StartCommitLSN pglogrepl.LSN
+	// ReplayedChanges is applied to changes which were already emitted before
+	// a restart, see StartCommitLSN. Defaults to ReplayedChangeKeep.
+	ReplayedChanges ReplayedChangePolicy
+	// WithRelationID adds the OID of the relation to each record in
+	// MetadataRelationID.
+	WithRelationID bool
+	// WithApproxSize adds the approximate size of the payload to each record
+	// in MetadataApproxSize. The size is estimated without serializing the
+	// payload.
+	WithApproxSize bool
+	// WithKeyHash adds a hash of the key to each record with a structured
+	// key in MetadataKeyHash, see types.HashKey.
+	WithKeyHash bool
+	// SendRetries is the number of times sending a record is retried if the
+	// sink does not accept it within SendRetryBackoff, which doubles with
+	// each attempt. ErrSinkBlocked is returned once all attempts failed. If
+	// 0, sending blocks until the sink accepts the record.
+	SendRetries int
+	// SendRetryBackoff is the time the first attempt to send a record waits
+	// for the sink. Defaults to one second.
+	SendRetryBackoff time.Duration
+	// MaxRecordsPerSecond caps the number of records sent to the sink per
+	// second across all tables, sending blocks while it is exceeded. If 0,
+	// the rate is not limited.
+	MaxRecordsPerSecond int
+	// StaticMetadata is added to the metadata of every record. Keys which
+	// are set by the handler are kept, unless OverwriteMetadata is set.
+	StaticMetadata map[string]string
+	// OverwriteMetadata lets StaticMetadata take precedence over metadata
+	// set by the handler.
+	OverwriteMetadata bool
+	// SkipTransactions contains the IDs of transactions whose changes are
+	// dropped. The position still moves past them with the next acked record.
+	SkipTransactions []uint32
+	// BufferTransactions holds back the records of a transaction until its
+	// commit message is received, so that records are only emitted for
+	// committed transactions and strictly in commit order. The records carry
+	// the LSNs of the first and last change of the transaction in
+	// MetadataBatchStartLSN and MetadataBatchEndLSN.
+	BufferTransactions bool
+	// TxSpillThreshold is the number of records of a buffered transaction
+	// kept in memory, further records are spilled to a temporary file in
+	// TxSpillDir. If 0, all records are kept in memory.
+	TxSpillThreshold int
+	// TxSpillDir is the directory for spilled transaction records, defaults to
+	// the default directory for temporary files.
+	TxSpillDir string
+	// Database and SystemIdentifier identify the source of the changes, they
+	// are added to the metadata of every record if set.
+	Database         string
+	SystemIdentifier string
+	// DefaultNamespace is reported in MetadataNamespace instead of the
+	// namespace of the relation, if that one is empty or pg_catalog. Postgres
+	// sends an empty namespace for relations in pg_catalog, so the namespace
+	// can't be told apart in that case.
+	DefaultNamespace string
+	// MetadataPrefix replaces DefaultMetadataPrefix in Postgres specific
+	// metadata keys, e.g. "pg." produces "pg.skippedColumns". Defaults to
+	// DefaultMetadataPrefix.
+	MetadataPrefix string
+	// PositionCodec encodes the positions of records. Defaults to
+	// position.JSONCodec.
+	PositionCodec position.Codec
+}
+
 // CDCHandler is responsible for handling logical replication messages,
-// converting them to a record and sending them to a channel.
+// converting them to a record and sending them to a sink.
 type CDCHandler struct {
+	config      CDCHandlerConfig
 	tableKeys   map[string]string
 	relationSet *internal.RelationSet
-	out         chan<- sdk.Record
+	sink        RecordSink
+
+	// schemas caches serialized Debezium schemas by relation ID.
+	schemas map[uint32]string
+	// schemaIDs contains the IDs of the schemas last sent in schema records
+	// by relation ID.
+	schemaIDs map[uint32]string
+	// keyColumns contains the key columns by relation ID, keyChanged marks
+	// relations whose key columns changed since the last record.
+	keyColumns map[uint32]string
+	keyChanged map[uint32]bool
+	// generatedColumns contains the generated columns by relation ID.
+	generatedColumns map[uint32]string
+	// excludedColumns contains the columns missing from the relation by
+	// relation ID.
+	excludedColumns map[uint32]string
+	// publications contains the publication of the relation by relation ID.
+	publications map[uint32]string
+	// identities contains the namespace and replica identity by relation ID,
+	// identityChanged marks relations whose identity changed since the last
+	// record.
+	identities      map[uint32]relationIdentity
+	identityChanged map[uint32]bool
+
+	statsLock sync.Mutex
+	filtered  map[FilterReason]uint64
+	unknown   map[string]uint64
+	// offsets contains the LSN of the last change received per table.
+	offsets map[string]pglogrepl.LSN
+
+	// txBuffer contains the records of the current transaction, if
+	// transactions are buffered.
+	txBuffer *txBuffer
+	inTx     bool
+	// skipTx is true while receiving the changes of a skipped transaction.
+	skipTx bool
+	// commitLSN is the commit LSN of the current transaction.
+	commitLSN pglogrepl.LSN
+	// commitTime is the commit time of the current transaction.
+	commitTime time.Time
+
+	// coalescer holds back updates, if updates are coalesced.
+	coalescer *coalescer
+
+	// pauseLock guards paused, buffered and prevLSN, records are buffered
+	// instead of being sent out while the handler is paused. It is never held
+	// while sending, so Pause and Resume don't block.
+	pauseLock sync.Mutex
+	paused    bool
+	buffered  []sdk.Record
+	// resumed is signaled by Resume to wake up a consumer waiting for records.
+	resumed chan struct{}
+	// sendLock is held while records are sent to the sink, so records which
+	// are emitted concurrently keep their order.
+	sendLock sync.Mutex
+	// prevLSN is the LSN of the last emitted record.
+	prevLSN pglogrepl.LSN
+
+	// handleLock is held for reading while a message is handled, Close
+	// acquires it for writing to wait for messages in flight.
+	handleLock sync.RWMutex
+	// closed is canceled when Close is called, which aborts pending sends.
+	closed    context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closeErr  error
+	// done is closed once Close released all resources.
+	done chan struct{}
 }
 
+// NewCDCHandler creates a handler sending records to the channel. Records are
+// discarded if the channel is nil. The handler never closes the channel, it is
+// owned by the caller, which can close it once Close returned.
 func NewCDCHandler(
 	rs *internal.RelationSet,
-	tableKeys map[string]string,
 	out chan<- sdk.Record,
+	c CDCHandlerConfig,
+) *CDCHandler {
+	if out == nil {
+		return NewCDCHandlerWithSink(rs, &DiscardSink{}, c)
+	}
+	return NewCDCHandlerWithSink(rs, ChannelSink(out), c)
+}
+
+// NewCDCHandlerWithSink creates a handler sending records to the sink.
+func NewCDCHandlerWithSink(
+	rs *internal.RelationSet,
+	sink RecordSink,
+	c CDCHandlerConfig,
 ) *CDCHandler {
-	return &CDCHandler{
-		tableKeys:   tableKeys,
-		relationSet: rs,
-		out:         out,
+	if c.MetadataPrefix == "" {
+		c.MetadataPrefix = DefaultMetadataPrefix
+	}
+	if c.PositionCodec == nil {
+		c.PositionCodec = position.JSONCodec{}
+	}
+	if c.NullKeys == "" {
+		c.NullKeys = NullKeyFail
+	}
+	if c.KeylessDeletes == "" {
+		c.KeylessDeletes = KeylessDeleteFail
+	}
+	if c.RelationChanges == "" {
+		c.RelationChanges = RelationChangeReplace
+	}
+	if c.SendRetries > 0 {
+		if c.SendRetryBackoff <= 0 {
+			c.SendRetryBackoff = time.Second
+		}
+		sink = &retrySink{
+			sink:    sink,
+			retries: c.SendRetries,
+			backoff: c.SendRetryBackoff,
+		}
 	}
+	if c.MaxRecordsPerSecond > 0 {
+		sink = &rateLimitedSink{
+			sink:    sink,
+			limiter: rate.NewLimiter(rate.Limit(c.MaxRecordsPerSecond), 1),
+		}
+	}
+	closed, cancel := context.WithCancel(context.Background())
+	h := &CDCHandler{
+		config:           c,
+		tableKeys:        c.TableKeys,
+		relationSet:      rs,
+		sink:             &closableSink{sink: sink, closed: closed},
+		closed:           closed,
+		cancel:           cancel,
+		done:             make(chan struct{}),
+		resumed:          make(chan struct{}, 1),
+		schemas:          make(map[uint32]string),
+		schemaIDs:        make(map[uint32]string),
+		keyColumns:       make(map[uint32]string),
+		keyChanged:       make(map[uint32]bool),
+		generatedColumns: make(map[uint32]string),
+		excludedColumns:  make(map[uint32]string),
+		publications:     make(map[uint32]string),
+		identities:       make(map[uint32]relationIdentity),
+		identityChanged:  make(map[uint32]bool),
+		filtered:         make(map[FilterReason]uint64),
+		offsets:          make(map[string]pglogrepl.LSN),
+		unknown:          make(map[string]uint64),
+		prevLSN:          c.StartLSN,
+		txBuffer: &txBuffer{
+			maxRecords: c.TxSpillThreshold,
+			dir:        c.TxSpillDir,
+		},
+	}
+	if c.CoalesceUpdates > 0 {
+		h.coalescer = &coalescer{
+			window: c.CoalesceUpdates,
+			emit:   h.emit,
+			carried: []string{
+				h.metadataKey(MetadataKeyColumns),
+				h.metadataKey(MetadataNamespace),
+				h.metadataKey(MetadataReplicaIdentity),
+			},
+		}
+	}
+	return h
+}
+
+// Stats returns a snapshot of the counters collected by the handler.
+func (h *CDCHandler) Stats() HandlerStats {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+
+	filtered := make(map[FilterReason]uint64, len(h.filtered))
+	for reason, n := range h.filtered {
+		filtered[reason] = n
+	}
+	unknown := make(map[string]uint64, len(h.unknown))
+	for msgType, n := range h.unknown {
+		unknown[msgType] = n
+	}
+	return HandlerStats{Filtered: filtered, UnknownMessages: unknown}
+}
+
+// TableOffsets returns a snapshot of the LSN of the last change received per
+// table, which can be used to report the progress of each table.
+func (h *CDCHandler) TableOffsets() map[string]pglogrepl.LSN {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	return maps.Clone(h.offsets)
+}
+
+// advanceOffset records that a change of the table was received at the LSN.
+func (h *CDCHandler) advanceOffset(rel *pglogrepl.RelationMessage, lsn pglogrepl.LSN) {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	h.offsets[rel.RelationName] = lsn
+}
+
+// Pause stops sending records to the sink. Changes are still consumed from the
+// replication slot, the records are buffered in memory until Resume is called.
+// The buffer is not bounded, it grows with every change received while the
+// handler is paused, so the handler should only be paused for short periods.
+func (h *CDCHandler) Pause() {
+	h.pauseLock.Lock()
+	defer h.pauseLock.Unlock()
+	h.paused = true
+}
+
+// Resume continues sending records to the sink. It does not block, the records
+// buffered while the handler was paused are sent before the next emitted
+// record, or can be taken with nextBuffered by the consumer of the sink.
+func (h *CDCHandler) Resume() {
+	h.pauseLock.Lock()
+	defer h.pauseLock.Unlock()
+	h.paused = false
+
+	select {
+	case h.resumed <- struct{}{}:
+	default: // a wake up is already pending
+	}
+}
+
+// nextBuffered returns the next record buffered while the handler was paused,
+// so the buffer is drained after Resume even if no new changes are received.
+// Records which were already sent to out, the channel the handler sends
+// records to, are returned first. It returns false if the handler is paused,
+// the buffer is empty or a record is being sent, in which case the buffer is
+// drained by the sender.
+func (h *CDCHandler) nextBuffered(out <-chan sdk.Record) (sdk.Record, bool) {
+	if !h.sendLock.TryLock() {
+		return sdk.Record{}, false
+	}
+	defer h.sendLock.Unlock()
+
+	select {
+	case rec := <-out:
+		return rec, true
+	default:
+	}
+
+	h.pauseLock.Lock()
+	defer h.pauseLock.Unlock()
+	if h.paused || len(h.buffered) == 0 {
+		return sdk.Record{}, false
+	}
+	rec := h.buffered[0]
+	h.buffered = h.buffered[1:]
+	return rec, true
+}
+
+// filter records that a change was dropped for the supplied reason.
+func (h *CDCHandler) filter(ctx context.Context, reason FilterReason, rel *pglogrepl.RelationMessage) {
+	sdk.Logger(ctx).Trace().
+		Str("table", rel.RelationName).
+		Str("reason", string(reason)).
+		Msg("filtering out change")
+
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	h.filtered[reason]++
+}
+
+// isReplayed returns true if the change at the LSN was already emitted before
+// the replication stream was resumed, i.e. its transaction was committed
+// before the one of StartLSN or it is the same transaction and the change is
+// at or below StartLSN.
+func (h *CDCHandler) isReplayed(lsn pglogrepl.LSN) bool {
+	if h.config.StartCommitLSN == 0 {
+		return false
+	}
+	return h.commitLSN < h.config.StartCommitLSN ||
+		(h.commitLSN == h.config.StartCommitLSN && lsn <= h.config.StartLSN)
+}
+
+// isTableIncluded returns true if the connector is configured to read changes
+// from the relation.
+func (h *CDCHandler) isTableIncluded(rel *pglogrepl.RelationMessage) bool {
+	_, ok := h.tableKeys[h.configuredTable(rel)]
+	return ok
+}
+
+// configuredTable returns the name of the relation in the configured tables,
+// which is either qualified with the schema, e.g. "sales.orders", or the bare
+// relation name.
+func (h *CDCHandler) configuredTable(rel *pglogrepl.RelationMessage) string {
+	qualified := rel.Namespace + "." + rel.RelationName
+	if _, ok := h.tableKeys[qualified]; ok {
+		return qualified
+	}
+	return rel.RelationName
 }
 
 // Handle is the handler function that receives all logical replication messages.
+// It returns ErrHandlerClosed once Close was called.
 func (h *CDCHandler) Handle(ctx context.Context, m pglogrepl.Message, lsn pglogrepl.LSN) error {
+	h.handleLock.RLock()
+	defer h.handleLock.RUnlock()
+	if h.closed.Err() != nil {
+		return ErrHandlerClosed
+	}
+
 	sdk.Logger(ctx).Trace().
 		Str("lsn", lsn.String()).
 		Str("messageType", m.Type().String()).
@@ -53,9 +723,55 @@ func (h *CDCHandler) Handle(ctx context.Context, m pglogrepl.Message, lsn pglogr
 
 	switch m := m.(type) {
 	case *pglogrepl.RelationMessage:
+		if err := h.handleRelationChange(ctx, m); err != nil {
+			return fmt.Errorf("logrepl handler relation: %w", err)
+		}
 		// We have to add the Relations to our Set so that we can
 		// decode our own output
 		h.relationSet.Add(m)
+		h.updateKeyColumns(m)
+		h.updateIdentity(m)
+		if h.config.GeneratedColumns != nil {
+			cols, err := h.config.GeneratedColumns(ctx, m.RelationID)
+			if err != nil {
+				return fmt.Errorf("logrepl handler relation: %w", err)
+			}
+			h.generatedColumns[m.RelationID] = strings.Join(cols, ",")
+		}
+		if h.config.RelationPublication != nil {
+			pub, err := h.config.RelationPublication(ctx, m.RelationID)
+			if err != nil {
+				return fmt.Errorf("logrepl handler relation: %w", err)
+			}
+			h.publications[m.RelationID] = pub
+		}
+		if h.config.TableColumns != nil {
+			if err := h.updateExcludedColumns(ctx, m); err != nil {
+				return fmt.Errorf("logrepl handler relation: %w", err)
+			}
+		}
+		if h.config.WithDebeziumSchema || h.config.SchemaRecords {
+			err := h.updateSchema(ctx, m)
+			if err != nil {
+				return fmt.Errorf("logrepl handler relation: %w", err)
+			}
+		}
+		if h.config.SchemaRecords {
+			err := h.sendSchemaRecord(ctx, m, lsn)
+			if err != nil {
+				return fmt.Errorf("logrepl handler relation: %w", err)
+			}
+		}
+	case *pglogrepl.BeginMessage:
+		err := h.handleBegin(m)
+		if err != nil {
+			return fmt.Errorf("logrepl handler begin: %w", err)
+		}
+	case *pglogrepl.CommitMessage:
+		err := h.handleCommit(ctx, m, lsn)
+		if err != nil {
+			return fmt.Errorf("logrepl handler commit: %w", err)
+		}
 	case *pglogrepl.InsertMessage:
 		err := h.handleInsert(ctx, m, lsn)
 		if err != nil {
@@ -71,13 +787,321 @@ func (h *CDCHandler) Handle(ctx context.Context, m pglogrepl.Message, lsn pglogr
 		if err != nil {
 			return fmt.Errorf("logrepl handler delete: %w", err)
 		}
+	case *pglogrepl.OriginMessage,
+		*pglogrepl.TypeMessage,
+		*pglogrepl.TruncateMessage,
+		*pglogrepl.LogicalDecodingMessage:
+		// known messages which don't result in records
+	default:
+		h.handleUnknown(ctx, m, lsn)
 	}
 
 	return nil
 }
 
+// handleRelationChange checks if the relation message changes the column
+// layout of a known relation. Pending updates were decoded with the old
+// layout, they are emitted before the new layout is applied, and all state
+// kept for the relation is dropped, see forgetRelation.
+func (h *CDCHandler) handleRelationChange(ctx context.Context, m *pglogrepl.RelationMessage) error {
+	prev, err := h.relationSet.Get(m.RelationID)
+	if err != nil || sameColumns(prev, m) {
+		return nil // new relation or same layout
+	}
+
+	if h.config.RelationChanges == RelationChangeFail {
+		return fmt.Errorf(
+			"column layout of relation %q (ID %d) changed from (%s) to (%s)",
+			m.RelationName, m.RelationID, columnList(prev), columnList(m),
+		)
+	}
+
+	sdk.Logger(ctx).Warn().
+		Str("relation", m.RelationName).
+		Uint32("relationID", m.RelationID).
+		Str("oldColumns", columnList(prev)).
+		Str("newColumns", columnList(m)).
+		Msg("column layout of relation changed, replacing relation")
+
+	if h.coalescer != nil {
+		if err := h.coalescer.flush(ctx); err != nil {
+			return err
+		}
+	}
+	h.forgetRelation(m.RelationID)
+	return nil
+}
+
+// forgetRelation drops the relation and all state kept for it, so a relation
+// with the same ID starts from scratch, i.e. its key columns, identity and
+// schema are reported again.
+func (h *CDCHandler) forgetRelation(relationID uint32) {
+	h.relationSet.Remove(relationID)
+	delete(h.schemas, relationID)
+	delete(h.schemaIDs, relationID)
+	delete(h.keyColumns, relationID)
+	delete(h.keyChanged, relationID)
+	delete(h.generatedColumns, relationID)
+	delete(h.excludedColumns, relationID)
+	delete(h.publications, relationID)
+	delete(h.identities, relationID)
+	delete(h.identityChanged, relationID)
+}
+
+// sameColumns returns true if both relations have the same columns with the
+// same types in the same order.
+func sameColumns(a, b *pglogrepl.RelationMessage) bool {
+	return slices.EqualFunc(a.Columns, b.Columns, func(x, y *pglogrepl.RelationMessageColumn) bool {
+		return x.Name == y.Name && x.DataType == y.DataType && x.TypeModifier == y.TypeModifier
+	})
+}
+
+// columnList returns the names of the columns in the relation, separated by
+// commas.
+func columnList(rel *pglogrepl.RelationMessage) string {
+	cols := make([]string, len(rel.Columns))
+	for i, col := range rel.Columns {
+		cols[i] = col.Name
+	}
+	return strings.Join(cols, ",")
+}
+
+// handleUnknown logs and counts messages of types the handler does not know,
+// e.g. types added in newer versions of Postgres, so they don't go unnoticed.
+func (h *CDCHandler) handleUnknown(ctx context.Context, m pglogrepl.Message, lsn pglogrepl.LSN) {
+	msgType := messageTypeName(m.Type())
+	sdk.Logger(ctx).Debug().
+		Str("lsn", lsn.String()).
+		Str("messageType", msgType).
+		Str("goType", fmt.Sprintf("%T", m)).
+		Msg("ignoring logical replication message of unknown type")
+
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	h.unknown[msgType]++
+}
+
+// messageTypeName returns the name of the message type, or the type byte if
+// pglogrepl does not know the type either.
+func messageTypeName(t pglogrepl.MessageType) string {
+	if name := t.String(); name != "Unknown" {
+		return name
+	}
+	return fmt.Sprintf("%c", byte(t))
+}
+
+// updateKeyColumns stores the key columns of the relation and marks them as
+// changed if they differ from the previously known key columns.
+func (h *CDCHandler) updateKeyColumns(rel *pglogrepl.RelationMessage) {
+	var cols []string
+	for _, col := range rel.Columns {
+		if col.Flags&1 != 0 { // flag 1 marks the column as part of the key
+			cols = append(cols, col.Name)
+		}
+	}
+
+	keyColumns := strings.Join(cols, ",")
+	if prev, ok := h.keyColumns[rel.RelationID]; !ok || prev != keyColumns {
+		h.keyColumns[rel.RelationID] = keyColumns
+		h.keyChanged[rel.RelationID] = true
+	}
+}
+
+// relationIdentity describes where a relation lives and which old values
+// Postgres sends for it.
+type relationIdentity struct {
+	namespace       string
+	replicaIdentity string
+}
+
+// updateIdentity stores the namespace and replica identity of the relation and
+// marks them as changed, if they differ from the stored ones.
+func (h *CDCHandler) updateIdentity(rel *pglogrepl.RelationMessage) {
+	identity := relationIdentity{
+		namespace:       rel.Namespace,
+		replicaIdentity: replicaIdentityName(rel.ReplicaIdentity),
+	}
+	if prev, ok := h.identities[rel.RelationID]; !ok || prev != identity {
+		h.identities[rel.RelationID] = identity
+		h.identityChanged[rel.RelationID] = true
+	}
+}
+
+// replicaIdentityName returns the name of the replica identity setting sent in
+// relation messages, see pg_class.relreplident.
+func replicaIdentityName(ri uint8) string {
+	switch ri {
+	case 'd':
+		return "default"
+	case 'n':
+		return "nothing"
+	case 'f':
+		return "full"
+	case 'i':
+		return "index"
+	default:
+		return string(rune(ri))
+	}
+}
+
+// updateSchema builds the Debezium schema for the relation and caches it.
+func (h *CDCHandler) updateSchema(ctx context.Context, rel *pglogrepl.RelationMessage) error {
+	var defaults map[string]string
+	if h.config.ColumnDefaults != nil {
+		var err error
+		defaults, err = h.config.ColumnDefaults(ctx, rel.RelationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	table := h.configuredTable(rel)
+	schema, err := newDebeziumSchema(rel, debeziumSchemaOptions{
+		keyColumns:         strings.Split(h.tableKeys[table], ","),
+		defaults:           defaults,
+		renames:            h.config.ColumnRenames[table],
+		intervalComponents: h.config.IntervalComponents,
+		floatSpecials:      h.config.FloatSpecials,
+	}).marshal()
+	if err != nil {
+		return err
+	}
+	h.schemas[rel.RelationID] = schema
+	return nil
+}
+
+// updateExcludedColumns compares the columns of the relation with the columns of
+// the table and logs a warning if columns are not replicated.
+func (h *CDCHandler) updateExcludedColumns(ctx context.Context, rel *pglogrepl.RelationMessage) error {
+	cols, err := h.config.TableColumns(ctx, rel.RelationID)
+	if err != nil {
+		return err
+	}
+
+	var excluded []string
+	for _, col := range cols {
+		if !slices.ContainsFunc(rel.Columns, func(c *pglogrepl.RelationMessageColumn) bool {
+			return c.Name == col
+		}) {
+			excluded = append(excluded, col)
+		}
+	}
+
+	h.excludedColumns[rel.RelationID] = strings.Join(excluded, ",")
+	if len(excluded) > 0 {
+		sdk.Logger(ctx).Warn().
+			Str("relation", rel.RelationName).
+			Strs("columns", excluded).
+			Msg("columns of the table are not replicated, check the column list of the publication")
+	}
+	return nil
+}
+
+// sendSchemaRecord sends a record containing the schema of the relation, if
+// its schema changed since the last schema record.
+func (h *CDCHandler) sendSchemaRecord(ctx context.Context, rel *pglogrepl.RelationMessage, lsn pglogrepl.LSN) error {
+	schema := h.schemas[rel.RelationID]
+	id := schemaID(schema)
+	if h.schemaIDs[rel.RelationID] == id {
+		return nil
+	}
+	h.schemaIDs[rel.RelationID] = id
+	if !h.isTableIncluded(rel) {
+		return nil
+	}
+
+	m := h.SourceMetadata()
+	m[sdk.MetadataCollection] = SchemaCollection
+	m[h.metadataKey(MetadataTable)] = rel.RelationName
+	m[h.metadataKey(MetadataSchemaID)] = id
+	m[h.metadataKey(MetadataDebeziumSchema)] = schema
+
+	rec := sdk.Util.Source.NewRecordCreate(
+		h.buildPosition(lsn),
+		m,
+		sdk.StructuredData{"schemaId": id},
+		nil,
+	)
+	return h.send(ctx, rec, lsn)
+}
+
+// handleBegin starts buffering the records of the transaction, if transactions
+// are buffered, and marks the transaction as skipped if it's configured so.
+func (h *CDCHandler) handleBegin(msg *pglogrepl.BeginMessage) error {
+	h.skipTx = slices.Contains(h.config.SkipTransactions, msg.Xid)
+	h.commitLSN = msg.FinalLSN
+	h.commitTime = msg.CommitTime
+	if !h.config.BufferTransactions {
+		return nil
+	}
+	h.inTx = true
+	return h.txBuffer.reset()
+}
+
+// handleCommit sends out the records buffered for the committed transaction,
+// followed by a commit marker if enabled.
+func (h *CDCHandler) handleCommit(ctx context.Context, msg *pglogrepl.CommitMessage, lsn pglogrepl.LSN) error {
+	skipped := h.skipTx
+	h.skipTx = false
+
+	if h.inTx {
+		h.inTx = false
+		startLSN, endLSN := h.txBuffer.startLSN.String(), h.txBuffer.endLSN.String()
+		err := h.txBuffer.each(func(rec sdk.Record) error {
+			rec.Metadata[h.metadataKey(MetadataBatchStartLSN)] = startLSN
+			rec.Metadata[h.metadataKey(MetadataBatchEndLSN)] = endLSN
+			return h.forward(ctx, rec)
+		})
+		if err := errors.Join(err, h.txBuffer.reset()); err != nil {
+			return err
+		}
+	}
+
+	if !h.config.CommitMarkers || skipped {
+		return nil
+	}
+	return h.forward(ctx, h.buildCommitMarker(msg, lsn))
+}
+
+// buildCommitMarker returns the record marking the commit of a transaction.
+func (h *CDCHandler) buildCommitMarker(msg *pglogrepl.CommitMessage, lsn pglogrepl.LSN) sdk.Record {
+	m := h.SourceMetadata()
+	m[h.metadataKey(MetadataCommitLSN)] = msg.CommitLSN.String()
+	m[h.metadataKey(MetadataCommitTime)] = msg.CommitTime.UTC().Format(time.RFC3339Nano)
+
+	return sdk.Util.Source.NewRecordCreate(h.buildPosition(lsn), m, nil, nil)
+}
+
+// Close stops accepting messages and releases resources held by the handler,
+// i.e. removes records of an incomplete transaction spilled to disk and
+// discards coalesced updates which were not sent yet. Sends blocked on the
+// sink are aborted with ErrHandlerClosed and Close waits for messages which are
+// being handled, so it is safe to call concurrently with Handle. The sink is
+// not closed, it is owned by the caller. Calling Close again has no effect.
+func (h *CDCHandler) Close() error {
+	h.closeOnce.Do(func() {
+		h.cancel()
+
+		h.handleLock.Lock()
+		defer h.handleLock.Unlock()
+
+		if h.coalescer != nil {
+			h.coalescer.stop()
+		}
+		h.closeErr = h.txBuffer.reset()
+		close(h.done)
+	})
+	return h.closeErr
+}
+
+// Done returns a channel which is closed once Close released all resources.
+// No records are sent to the sink afterwards.
+func (h *CDCHandler) Done() <-chan struct{} {
+	return h.done
+}
+
 // handleInsert formats a Record with INSERT event data from Postgres and sends
-// it to the output channel.
+// it to the sink.
 func (h *CDCHandler) handleInsert(
 	ctx context.Context,
 	msg *pglogrepl.InsertMessage,
@@ -85,26 +1109,52 @@ func (h *CDCHandler) handleInsert(
 ) (err error) {
 	rel, err := h.relationSet.Get(msg.RelationID)
 	if err != nil {
-		return err
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, err)
+	}
+
+	if !h.isTableIncluded(rel) {
+		h.filter(ctx, FilterReasonTable, rel)
+		return nil
+	}
+	if h.skipTx {
+		h.filter(ctx, FilterReasonSkippedTransaction, rel)
+		return nil
+	}
+	h.advanceOffset(rel, lsn)
+	if h.isReplayed(lsn) && h.config.ReplayedChanges == ReplayedChangeDrop {
+		h.filter(ctx, FilterReasonReplayed, rel)
+		return nil
 	}
 
 	newValues, err := h.relationSet.Values(msg.RelationID, msg.Tuple)
 	if err != nil {
-		return fmt.Errorf("failed to decode new values: %w", err)
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, fmt.Errorf("failed to decode new values: %w", err))
+	}
+	if !h.matchesRowFilter(rel, newValues) {
+		h.filter(ctx, FilterReasonRow, rel)
+		return nil
+	}
+
+	key, err := h.buildRecordKey(rel, msg.Tuple, false, false)
+	if err != nil {
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, err)
 	}
 
 	rec := sdk.Util.Source.NewRecordCreate(
 		h.buildPosition(lsn),
 		h.buildRecordMetadata(rel),
-		h.buildRecordKey(newValues, rel.RelationName),
-		h.buildRecordPayload(newValues),
+		key,
+		h.buildRecordPayload(rel, newValues),
 	)
+	if h.config.ExplicitInsertBefore {
+		rec.Payload.Before = sdk.StructuredData(nil)
+	}
 
-	return h.send(ctx, rec)
+	return h.send(ctx, rec, lsn)
 }
 
 // handleUpdate formats a record with UPDATE event data from Postgres and sends
-// it to the output channel.
+// it to the sink.
 func (h *CDCHandler) handleUpdate(
 	ctx context.Context,
 	msg *pglogrepl.UpdateMessage,
@@ -112,33 +1162,126 @@ func (h *CDCHandler) handleUpdate(
 ) error {
 	rel, err := h.relationSet.Get(msg.RelationID)
 	if err != nil {
-		return err
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, err)
+	}
+
+	if !h.isTableIncluded(rel) {
+		h.filter(ctx, FilterReasonTable, rel)
+		return nil
+	}
+	if h.skipTx {
+		h.filter(ctx, FilterReasonSkippedTransaction, rel)
+		return nil
+	}
+	h.advanceOffset(rel, lsn)
+	if h.isReplayed(lsn) && h.config.ReplayedChanges == ReplayedChangeDrop {
+		h.filter(ctx, FilterReasonReplayed, rel)
+		return nil
+	}
+
+	if h.config.DropNoopUpdates && isNoopUpdate(msg) {
+		h.filter(ctx, FilterReasonNoopUpdate, rel)
+		return nil
 	}
 
 	newValues, err := h.relationSet.Values(msg.RelationID, msg.NewTuple)
 	if err != nil {
-		return fmt.Errorf("failed to decode new values: %w", err)
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, fmt.Errorf("failed to decode new values: %w", err))
+	}
+	if !h.matchesRowFilter(rel, newValues) {
+		h.filter(ctx, FilterReasonRow, rel)
+		return nil
 	}
 
-	oldValues, err := h.relationSet.Values(msg.RelationID, msg.OldTuple)
+	if h.config.RequireBeforeImage && msg.OldTupleType != pglogrepl.UpdateMessageTupleTypeOld {
+		return fmt.Errorf(
+			"update of table %q does not contain a before image, make sure the table has REPLICA IDENTITY FULL",
+			rel.RelationName,
+		)
+	}
+
+	key, err := h.buildRecordKey(rel, msg.NewTuple, false, false)
 	if err != nil {
-		// this is not a critical error, old values are optional, just log it
-		// we use level "trace" intentionally to not clog up the logs in production
-		sdk.Logger(ctx).Trace().Err(err).Msg("could not parse old values from UpdateMessage")
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, err)
+	}
+
+	metadata := h.buildRecordMetadata(rel)
+	oldValues, partial := h.oldValues(ctx, msg)
+	if partial {
+		if h.config.PartialBeforeImage == PartialBeforeImageDrop {
+			oldValues = nil
+		} else {
+			metadata[h.metadataKey(MetadataPartialBeforeImage)] = "true"
+		}
 	}
 
 	rec := sdk.Util.Source.NewRecordUpdate(
 		h.buildPosition(lsn),
-		h.buildRecordMetadata(rel),
-		h.buildRecordKey(newValues, rel.RelationName),
-		h.buildRecordPayload(oldValues),
-		h.buildRecordPayload(newValues),
+		metadata,
+		key,
+		h.buildRecordPayload(rel, oldValues),
+		h.buildRecordPayload(rel, newValues),
 	)
-	return h.send(ctx, rec)
+	return h.send(ctx, rec, lsn)
+}
+
+// oldValues decodes the old values of the update. The second return value is
+// true if the old values only contain some of the columns, because the old
+// tuple only contains the key, unchanged TOASTed values or values which can't
+// be decoded.
+func (h *CDCHandler) oldValues(ctx context.Context, msg *pglogrepl.UpdateMessage) (map[string]any, bool) {
+	if msg.OldTuple == nil {
+		return nil, false
+	}
+
+	values, missing, err := h.relationSet.PartialValues(msg.RelationID, msg.OldTuple)
+	if err != nil {
+		// this is not a critical error, old values are optional, just log it
+		// we use level "trace" intentionally to not clog up the logs in production
+		sdk.Logger(ctx).Trace().Err(err).Msg("could not parse old values from UpdateMessage")
+		return nil, false
+	}
+	if len(missing) > 0 {
+		sdk.Logger(ctx).Trace().
+			Strs("columns", missing).
+			Msg("could not parse some old values from UpdateMessage")
+	}
+
+	return values, len(missing) > 0 || msg.OldTupleType == pglogrepl.UpdateMessageTupleTypeKey
+}
+
+// matchesRowFilter returns true if the row should be emitted, i.e. there is no
+// row filter or it matches the values.
+func (h *CDCHandler) matchesRowFilter(rel *pglogrepl.RelationMessage, values map[string]any) bool {
+	return h.config.RowFilter == nil || h.config.RowFilter(rel.RelationName, values)
+}
+
+// isNoopUpdate returns true if the update message contains the full old tuple
+// and no value differs from the new tuple. Unchanged TOASTed values are not
+// sent in the new tuple, they are considered equal.
+func isNoopUpdate(msg *pglogrepl.UpdateMessage) bool {
+	if msg.OldTupleType != pglogrepl.UpdateMessageTupleTypeOld || msg.OldTuple == nil || msg.NewTuple == nil {
+		return false
+	}
+
+	oldCols, newCols := msg.OldTuple.Columns, msg.NewTuple.Columns
+	if len(oldCols) != len(newCols) {
+		return false
+	}
+
+	for i, n := range newCols {
+		if n.DataType == pglogrepl.TupleDataTypeToast {
+			continue
+		}
+		if o := oldCols[i]; o.DataType != n.DataType || !bytes.Equal(o.Data, n.Data) {
+			return false
+		}
+	}
+	return true
 }
 
 // handleDelete formats a record with DELETE event data from Postgres and sends
-// it to the output channel. Deleted records only contain the key and no payload.
+// it to the sink. Deleted records only contain the key and no payload.
 func (h *CDCHandler) handleDelete(
 	ctx context.Context,
 	msg *pglogrepl.DeleteMessage,
@@ -146,65 +1289,386 @@ func (h *CDCHandler) handleDelete(
 ) error {
 	rel, err := h.relationSet.Get(msg.RelationID)
 	if err != nil {
-		return err
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, err)
+	}
+
+	if !h.isTableIncluded(rel) {
+		h.filter(ctx, FilterReasonTable, rel)
+		return nil
+	}
+	if h.skipTx {
+		h.filter(ctx, FilterReasonSkippedTransaction, rel)
+		return nil
+	}
+	h.advanceOffset(rel, lsn)
+	if h.isReplayed(lsn) && h.config.ReplayedChanges == ReplayedChangeDrop {
+		h.filter(ctx, FilterReasonReplayed, rel)
+		return nil
 	}
 
-	oldValues, err := h.relationSet.Values(msg.RelationID, msg.OldTuple)
+	if msg.OldTuple == nil || len(msg.OldTuple.Columns) == 0 {
+		switch h.config.KeylessDeletes {
+		case KeylessDeleteSkip:
+			sdk.Logger(ctx).Warn().
+				Str("table", rel.RelationName).
+				Str("lsn", lsn.String()).
+				Msg("skipping delete without old tuple")
+			h.filter(ctx, FilterReasonKeylessDelete, rel)
+			return nil
+		case KeylessDeleteTombstone:
+			rec := sdk.Util.Source.NewRecordDelete(
+				h.buildPosition(lsn),
+				h.buildRecordMetadata(rel),
+				nil,
+			)
+			return h.send(ctx, rec, lsn)
+		}
+	}
+
+	if h.config.RowFilter != nil && msg.OldTuple != nil {
+		oldValues, _, err := h.relationSet.PartialValues(msg.RelationID, msg.OldTuple)
+		if err != nil {
+			return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, fmt.Errorf("failed to decode old values: %w", err))
+		}
+		if !h.matchesRowFilter(rel, oldValues) {
+			h.filter(ctx, FilterReasonRow, rel)
+			return nil
+		}
+	}
+
+	// only the key is decoded, deletes don't contain a payload, the key has
+	// to contain all key columns to match the key of inserts and updates
+	key, err := h.buildRecordKey(rel, msg.OldTuple, msg.OldTupleType == pglogrepl.DeleteMessageTupleTypeKey, true)
 	if err != nil {
-		return fmt.Errorf("failed to decode old values: %w", err)
+		return h.handleDecodeErr(ctx, msg, lsn, msg.RelationID, err)
 	}
 
 	rec := sdk.Util.Source.NewRecordDelete(
 		h.buildPosition(lsn),
 		h.buildRecordMetadata(rel),
-		h.buildRecordKey(oldValues, rel.RelationName),
+		key,
 	)
-	return h.send(ctx, rec)
+	return h.send(ctx, rec, lsn)
 }
 
-// send the record to the output channel or detect the cancellation of the
-// context and return the context error.
-func (h *CDCHandler) send(ctx context.Context, rec sdk.Record) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case h.out <- rec:
-		return nil
+// handleDecodeErr checks if the change could not be decoded because the
+// relation was dropped. In that case the relation is removed from the relation
+// set and the change is skipped, otherwise the change is quarantined.
+func (h *CDCHandler) handleDecodeErr(ctx context.Context, msg pglogrepl.Message, lsn pglogrepl.LSN, relationID uint32, err error) error {
+	if h.config.RelationExists == nil {
+		return h.quarantine(ctx, msg, lsn, err)
+	}
+
+	exists, existsErr := h.config.RelationExists(ctx, relationID)
+	if existsErr != nil {
+		return errors.Join(err, existsErr)
+	}
+	if exists {
+		return h.quarantine(ctx, msg, lsn, err)
 	}
+
+	sdk.Logger(ctx).Warn().
+		Err(err).
+		Uint32("relationID", relationID).
+		Msg("relation was dropped, skipping change")
+
+	h.forgetRelation(relationID)
+
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	h.filtered[FilterReasonDroppedTable]++
+	return nil
+}
+
+// quarantine passes the change which could not be decoded to the configured
+// quarantine and skips it. The error is returned if there is no quarantine.
+func (h *CDCHandler) quarantine(ctx context.Context, msg pglogrepl.Message, lsn pglogrepl.LSN, err error) error {
+	if h.config.Quarantine == nil {
+		return err
+	}
+
+	qErr := h.config.Quarantine(ctx, QuarantinedMessage{Message: msg, LSN: lsn, Err: err})
+	if qErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to quarantine change: %w", qErr))
+	}
+
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+	h.filtered[FilterReasonQuarantined]++
+	return nil
+}
+
+// send the record to the sink or detect the cancellation of the context and
+// return the context error. The record is buffered if it is part of a buffered
+// transaction or if the handler is paused.
+func (h *CDCHandler) send(ctx context.Context, rec sdk.Record, lsn pglogrepl.LSN) error {
+	if h.isReplayed(lsn) && h.config.ReplayedChanges == ReplayedChangeMark {
+		rec.Metadata[h.metadataKey(MetadataReplayed)] = "true"
+	}
+	if h.config.WithApproxSize {
+		rec.Metadata[h.metadataKey(MetadataApproxSize)] = strconv.Itoa(approxPayloadSize(rec.Payload))
+	}
+	if key, ok := rec.Key.(sdk.StructuredData); ok && h.config.WithKeyHash {
+		hash, err := types.HashKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to hash key: %w", err)
+		}
+		rec.Metadata[h.metadataKey(MetadataKeyHash)] = hash
+	}
+	if h.inTx {
+		return h.txBuffer.append(rec, lsn)
+	}
+	return h.forward(ctx, rec)
+}
+
+// forward sends the record to the sink, unless it is an update held
+// back to be coalesced.
+func (h *CDCHandler) forward(ctx context.Context, rec sdk.Record) error {
+	if h.coalescer != nil {
+		return h.coalescer.add(ctx, rec)
+	}
+	return h.emit(ctx, rec)
+}
+
+// emit sends the record to the sink, unless the handler is paused. Records
+// buffered while the handler was paused are sent first.
+func (h *CDCHandler) emit(ctx context.Context, rec sdk.Record) error {
+	h.sendLock.Lock()
+	defer h.sendLock.Unlock()
+
+	h.pauseLock.Lock()
+	if h.config.WithPrevLSN {
+		if err := h.stampPrevLSN(rec); err != nil {
+			h.pauseLock.Unlock()
+			return err
+		}
+	}
+	mergeMetadata(rec.Metadata, h.config.StaticMetadata, h.config.OverwriteMetadata)
+	h.buffered = append(h.buffered, rec)
+	h.pauseLock.Unlock()
+
+	return h.drain(ctx)
+}
+
+// drain sends the buffered records to the sink until the buffer is empty or
+// the handler is paused. A record stays buffered if it could not be sent. It
+// has to be called with sendLock held.
+func (h *CDCHandler) drain(ctx context.Context) error {
+	for {
+		h.pauseLock.Lock()
+		if h.paused || len(h.buffered) == 0 {
+			h.pauseLock.Unlock()
+			return nil
+		}
+		rec := h.buffered[0]
+		h.pauseLock.Unlock()
+
+		if err := h.sink.Send(ctx, rec); err != nil {
+			return err
+		}
+
+		h.pauseLock.Lock()
+		h.buffered = h.buffered[1:]
+		if len(h.buffered) == 0 {
+			h.buffered = nil
+		}
+		h.pauseLock.Unlock()
+	}
+}
+
+// mergeMetadata adds the static metadata to the record metadata. Existing keys
+// are only replaced if overwrite is set.
+func mergeMetadata(md sdk.Metadata, static map[string]string, overwrite bool) {
+	for k, v := range static {
+		if _, ok := md[k]; ok && !overwrite {
+			continue
+		}
+		md[k] = v
+	}
+}
+
+// stampPrevLSN adds the LSN of the previously emitted record to the metadata
+// and remembers the LSN of the record. It has to be called with pauseLock
+// held, updates can be emitted concurrently when they are coalesced.
+func (h *CDCHandler) stampPrevLSN(rec sdk.Record) error {
+	pos, err := h.config.PositionCodec.Decode(rec.Position)
+	if err != nil {
+		return fmt.Errorf("failed to decode record position: %w", err)
+	}
+	lsn, err := pos.LSN()
+	if err != nil {
+		return fmt.Errorf("failed to parse record LSN: %w", err)
+	}
+
+	rec.Metadata[h.metadataKey(MetadataPrevLSN)] = h.prevLSN.String()
+	h.prevLSN = lsn
+	return nil
 }
 
 func (h *CDCHandler) buildRecordMetadata(relation *pglogrepl.RelationMessage) map[string]string {
-	return map[string]string{
+	m := map[string]string{
 		sdk.MetadataCollection: relation.RelationName,
 	}
+	for k, v := range h.SourceMetadata() {
+		m[k] = v
+	}
+	if h.config.SchemaRecords {
+		m[h.metadataKey(MetadataSchemaID)] = h.schemaIDs[relation.RelationID]
+	} else if h.config.WithDebeziumSchema {
+		m[h.metadataKey(MetadataDebeziumSchema)] = h.schemas[relation.RelationID]
+	}
+	if h.keyChanged[relation.RelationID] {
+		m[h.metadataKey(MetadataKeyColumns)] = h.keyColumns[relation.RelationID]
+		delete(h.keyChanged, relation.RelationID)
+	}
+	if h.identityChanged[relation.RelationID] {
+		identity := h.identities[relation.RelationID]
+		m[h.metadataKey(MetadataNamespace)] = h.namespace(identity.namespace)
+		m[h.metadataKey(MetadataReplicaIdentity)] = identity.replicaIdentity
+		delete(h.identityChanged, relation.RelationID)
+	}
+	if cols := h.generatedColumns[relation.RelationID]; cols != "" {
+		m[h.metadataKey(MetadataGeneratedColumns)] = cols
+	}
+	if cols := h.excludedColumns[relation.RelationID]; cols != "" {
+		m[h.metadataKey(MetadataExcludedColumns)] = cols
+	}
+	if pub := h.publications[relation.RelationID]; pub != "" {
+		m[h.metadataKey(MetadataPublication)] = pub
+	}
+	if h.config.WithRelationID {
+		m[h.metadataKey(MetadataRelationID)] = strconv.FormatUint(uint64(relation.RelationID), 10)
+	}
+	if h.config.WithCommitTime && !h.commitTime.IsZero() {
+		m[h.metadataKey(MetadataCommitTime)] = h.commitTime.UTC().Format(time.RFC3339Nano)
+	}
+	if h.config.WithReceivedAt {
+		m[h.metadataKey(MetadataReceivedAt)] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if h.relationSet.UnsupportedTypePolicy == internal.UnsupportedTypeSkip {
+		if cols := h.relationSet.UnsupportedColumns(relation.RelationID); len(cols) > 0 {
+			m[h.metadataKey(MetadataSkippedColumns)] = strings.Join(cols, ",")
+		}
+	}
+	return m
+}
+
+// namespace returns the namespace reported for a relation, which is the
+// configured default namespace if the relation namespace is ambiguous.
+func (h *CDCHandler) namespace(ns string) string {
+	if h.config.DefaultNamespace != "" && (ns == "" || ns == "pg_catalog") {
+		return h.config.DefaultNamespace
+	}
+	return ns
+}
+
+// SourceMetadata returns the metadata identifying the database and cluster the
+// records are read from.
+func (h *CDCHandler) SourceMetadata() map[string]string {
+	m := make(map[string]string, 2)
+	if h.config.Database != "" {
+		m[h.metadataKey(MetadataDatabase)] = h.config.Database
+	}
+	if h.config.SystemIdentifier != "" {
+		m[h.metadataKey(MetadataSystemIdentifier)] = h.config.SystemIdentifier
+	}
+	return m
 }
 
-// buildRecordKey takes the values from the message and extracts the key that
-// matches the configured keyColumnName.
-func (h *CDCHandler) buildRecordKey(values map[string]any, table string) sdk.Data {
-	keyColumn := h.tableKeys[table]
+// metadataKey replaces DefaultMetadataPrefix in the key with the configured
+// prefix.
+func (h *CDCHandler) metadataKey(key string) string {
+	return h.config.MetadataPrefix + strings.TrimPrefix(key, DefaultMetadataPrefix)
+}
+
+// buildRecordKey extracts the key that matches the configured key columns from
+// the tuple. The key values are formatted using types.FormatKey, so that
+// numerics and intervals produce a stable key.
+// The row only contains the replica identity columns if identityOnly is true,
+// other columns are sent as NULL in that case, even though their value is not
+// known, so they are treated as missing. NullKeys is only applied to actual
+// NULL values.
+// If complete is true, a key column missing from the row is an error instead
+// of being left out of the key.
+func (h *CDCHandler) buildRecordKey(rel *pglogrepl.RelationMessage, row *pglogrepl.TupleData, identityOnly, complete bool) (sdk.Data, error) {
 	key := make(sdk.StructuredData)
-	for k, v := range values {
-		if keyColumn == k {
-			key[k] = v
-			break // TODO add support for composite keys
+	for _, keyColumn := range strings.Split(h.tableKeys[h.configuredTable(rel)], ",") {
+		v, ok, err := h.relationSet.KeyValue(rel.RelationID, row, keyColumn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key: %w", err)
+		}
+		if !ok || (identityOnly && !isIdentityColumn(rel, keyColumn)) {
+			if complete {
+				return nil, fmt.Errorf("key column %q is missing from the tuple", keyColumn)
+			}
+			continue
+		}
+		if v == nil {
+			switch h.config.NullKeys {
+			case NullKeySentinel:
+				v = h.config.NullKeySentinel
+			case NullKeyNull:
+			default:
+				return nil, fmt.Errorf("key column %q is NULL", keyColumn)
+			}
+		}
+		key[h.columnName(rel, keyColumn)] = v
+	}
+	return key, nil
+}
+
+// isIdentityColumn returns true if the column is part of the replica identity
+// of the relation.
+func isIdentityColumn(rel *pglogrepl.RelationMessage, column string) bool {
+	for _, col := range rel.Columns {
+		if col.Name == column {
+			return col.Flags&1 != 0 // flag 1 marks the column as part of the key
 		}
 	}
-	return key
+	return false
 }
 
 // buildRecordPayload takes the values from the message and extracts the payload
-// for the record.
-func (h *CDCHandler) buildRecordPayload(values map[string]any) sdk.Data {
+// for the record. Renamed columns get their new name.
+func (h *CDCHandler) buildRecordPayload(rel *pglogrepl.RelationMessage, values map[string]any) sdk.Data {
 	if len(values) == 0 {
 		return nil
 	}
-	return sdk.StructuredData(values)
+	if len(h.config.ColumnRenames[h.configuredTable(rel)]) == 0 &&
+		!h.config.IntervalComponents &&
+		h.config.FloatSpecials == nil {
+		return sdk.StructuredData(values)
+	}
+
+	payload := make(sdk.StructuredData, len(values))
+	for name, v := range values {
+		if h.config.IntervalComponents {
+			v = types.Interval.WithComponents(v)
+		}
+		if h.config.FloatSpecials != nil {
+			v = types.Float.ReplaceSpecials(v, h.config.FloatSpecials)
+		}
+		payload[h.columnName(rel, name)] = v
+	}
+	return payload
 }
 
-func (*CDCHandler) buildPosition(lsn pglogrepl.LSN) sdk.Position {
-	return position.Position{
+// columnName returns the name of the column in records, i.e. the new name if
+// the column is renamed.
+func (h *CDCHandler) columnName(rel *pglogrepl.RelationMessage, column string) string {
+	if renamed, ok := h.config.ColumnRenames[h.configuredTable(rel)][column]; ok {
+		return renamed
+	}
+	return column
+}
+
+func (h *CDCHandler) buildPosition(lsn pglogrepl.LSN) sdk.Position {
+	pos := position.Position{
 		Type:    position.TypeCDC,
 		LastLSN: lsn.String(),
-	}.ToSDKPosition()
+	}
+	if h.commitLSN != 0 {
+		pos.LastCommitLSN = h.commitLSN.String()
+	}
+	return h.config.PositionCodec.Encode(pos)
 }
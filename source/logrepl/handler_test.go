@@ -0,0 +1,2512 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	"github.com/conduitio/conduit-connector-postgres/source/position"
+	"github.com/conduitio/conduit-connector-postgres/source/types"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/matryer/is"
+)
+
+func TestCDCHandler_FilteredTable(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"allowed": "id"},
+	})
+
+	denied := testRelation(1, "denied")
+	is.NoErr(h.Handle(ctx, denied, 0))
+	is.NoErr(h.Handle(ctx, testInsert(denied, "1", "foo"), 1))
+
+	is.Equal(len(out), 0)
+	is.Equal(h.Stats().Filtered[FilterReasonTable], uint64(1))
+
+	allowed := testRelation(2, "allowed")
+	is.NoErr(h.Handle(ctx, allowed, 0))
+	is.NoErr(h.Handle(ctx, testInsert(allowed, "1", "foo"), 2))
+
+	is.Equal(len(out), 1)
+	is.Equal(h.Stats().Filtered[FilterReasonTable], uint64(1))
+}
+
+func TestCDCHandler_QualifiedTable(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"sales.orders": "id"},
+	})
+
+	rel := testRelation(1, "orders")
+	rel.Namespace = "sales"
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	is.Equal(len(out), 1)
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(1)})
+
+	// the same table name in another schema is not included
+	other := testRelation(2, "orders")
+	is.NoErr(h.Handle(ctx, other, 0))
+	is.NoErr(h.Handle(ctx, testInsert(other, "1", "foo"), 2))
+
+	is.Equal(len(out), 0)
+	is.Equal(h.Stats().Filtered[FilterReasonTable], uint64(1))
+}
+
+// testUnknownMessage is a message of a type the handler does not know.
+type testUnknownMessage struct{}
+
+func (testUnknownMessage) Type() pglogrepl.MessageType { return 'X' }
+
+func TestCDCHandler_UnknownMessage(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	is.NoErr(h.Handle(ctx, testUnknownMessage{}, 1))
+	is.NoErr(h.Handle(ctx, testUnknownMessage{}, 2))
+	// known messages without records are not counted
+	is.NoErr(h.Handle(ctx, &pglogrepl.TruncateMessage{}, 3))
+	// stream messages are known to pglogrepl, but not handled
+	stream := &pglogrepl.StreamStartMessageV2{}
+	stream.SetType(pglogrepl.MessageTypeStreamStart)
+	is.NoErr(h.Handle(ctx, stream, 3))
+
+	is.Equal(len(out), 0)
+	is.Equal(h.Stats().UnknownMessages, map[string]uint64{"X": 2, "StreamStart": 1})
+
+	// changes after the unknown messages are still handled
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 4))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 5))
+	is.Equal(len(out), 1)
+}
+
+func TestCDCHandler_TableOffsets(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 4)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table1": "id", "table2": "id"},
+	})
+	is.Equal(h.TableOffsets(), map[string]pglogrepl.LSN{})
+
+	rel1 := testRelation(1, "table1")
+	rel2 := testRelation(2, "table2")
+	is.NoErr(h.Handle(ctx, rel1, 0))
+	is.NoErr(h.Handle(ctx, rel2, 0))
+
+	is.NoErr(h.Handle(ctx, testInsert(rel1, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel2, "1", "foo"), 2))
+	is.Equal(h.TableOffsets(), map[string]pglogrepl.LSN{"table1": 1, "table2": 2})
+
+	// only the offset of the changed table advances
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+		OldTuple:     testTuple("1"),
+	}, 3))
+	offsets := h.TableOffsets()
+	is.Equal(offsets, map[string]pglogrepl.LSN{"table1": 3, "table2": 2})
+
+	// the returned map is a snapshot
+	is.NoErr(h.Handle(ctx, testInsert(rel2, "2", "bar"), 4))
+	is.Equal(offsets["table2"], pglogrepl.LSN(2))
+	is.Equal(h.TableOffsets(), map[string]pglogrepl.LSN{"table1": 3, "table2": 4})
+}
+
+func TestCDCHandler_ColumnRenames(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 3)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		ColumnRenames:      map[string]map[string]string{"table": {"id": "userId"}},
+		WithDebeziumSchema: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+		OldTuple:     testTuple("1", "foo"),
+		NewTuple:     testTuple("1", "bar"),
+	}, 2))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{RelationID: 1, OldTuple: testTuple("1", "bar")}, 3))
+
+	// the key column is renamed in the key and the payload
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"userId": int64(1)})
+	is.Equal(rec.Payload.After, sdk.StructuredData{"userId": int64(1), "name": "foo"})
+	is.True(strings.Contains(rec.Metadata[MetadataDebeziumSchema], `"field":"userId"`))
+
+	rec = <-out
+	is.Equal(rec.Key, sdk.StructuredData{"userId": int64(1)})
+	is.Equal(rec.Payload.Before, sdk.StructuredData{"userId": int64(1), "name": "foo"})
+	is.Equal(rec.Payload.After, sdk.StructuredData{"userId": int64(1), "name": "bar"})
+
+	rec = <-out
+	is.Equal(rec.Key, sdk.StructuredData{"userId": int64(1)})
+}
+
+func TestCDCHandler_QualifiedColumnRenames(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:     map[string]string{"sales.orders": "id"},
+		ColumnRenames: map[string]map[string]string{"sales.orders": {"id": "orderId"}},
+	})
+
+	rel := testRelation(1, "orders")
+	rel.Namespace = "sales"
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	// renames of a table configured with its schema are applied like in
+	// snapshots
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"orderId": int64(1)})
+	is.Equal(rec.Payload.After, sdk.StructuredData{"orderId": int64(1), "name": "foo"})
+}
+
+func TestCDCHandler_DiscardSink(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	sink := &DiscardSink{}
+	h := NewCDCHandlerWithSink(internal.NewRelationSet(), sink, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 2))
+	is.Equal(sink.Count(), uint64(2))
+
+	// decoding errors are still reported
+	bad := testInsert(rel, "not a number", "baz")
+	is.True(h.Handle(ctx, bad, 3) != nil)
+	is.Equal(sink.Count(), uint64(2))
+
+	// a handler without a channel discards records
+	h = NewCDCHandler(internal.NewRelationSet(), nil, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+}
+
+func TestCDCHandler_SendRetries(t *testing.T) {
+	ctx := context.Background()
+	rel := testRelation(1, "table")
+
+	t.Run("slow consumer", func(t *testing.T) {
+		is := is.New(t)
+		ch := make(chan sdk.Record)
+		h := NewCDCHandler(internal.NewRelationSet(), ch, CDCHandlerConfig{
+			TableKeys:        map[string]string{"table": "id"},
+			SendRetries:      3,
+			SendRetryBackoff: 10 * time.Millisecond,
+		})
+		is.NoErr(h.Handle(ctx, rel, 0))
+
+		// the consumer only drains after the first attempts timed out
+		received := make(chan sdk.Record)
+		go func() {
+			time.Sleep(25 * time.Millisecond)
+			received <- <-ch
+		}()
+
+		is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+		rec := <-received
+		is.Equal(rec.Key, sdk.StructuredData{"id": int64(1)})
+	})
+
+	t.Run("dead consumer", func(t *testing.T) {
+		is := is.New(t)
+		ch := make(chan sdk.Record)
+		h := NewCDCHandler(internal.NewRelationSet(), ch, CDCHandlerConfig{
+			TableKeys:        map[string]string{"table": "id"},
+			SendRetries:      2,
+			SendRetryBackoff: time.Millisecond,
+		})
+		is.NoErr(h.Handle(ctx, rel, 0))
+
+		err := h.Handle(ctx, testInsert(rel, "1", "foo"), 1)
+		is.True(errors.Is(err, ErrSinkBlocked))
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		is := is.New(t)
+		ch := make(chan sdk.Record)
+		h := NewCDCHandler(internal.NewRelationSet(), ch, CDCHandlerConfig{
+			TableKeys:        map[string]string{"table": "id"},
+			SendRetries:      2,
+			SendRetryBackoff: time.Hour,
+		})
+		is.NoErr(h.Handle(ctx, rel, 0))
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := h.Handle(cctx, testInsert(rel, "1", "foo"), 1)
+		is.True(errors.Is(err, context.Canceled))
+	})
+}
+
+func TestCDCHandler_MaxRecordsPerSecond(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 20)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:           map[string]string{"table1": "id", "table2": "id"},
+		MaxRecordsPerSecond: 50,
+	})
+	rel1, rel2 := testRelation(1, "table1"), testRelation(2, "table2")
+	is.NoErr(h.Handle(ctx, rel1, 0))
+	is.NoErr(h.Handle(ctx, rel2, 0))
+
+	// the limit is shared by both tables, the first record is sent right away
+	// and each following one 20ms later
+	start := time.Now()
+	for i := 1; i <= 11; i++ {
+		rel := rel1
+		if i%2 == 0 {
+			rel = rel2
+		}
+		is.NoErr(h.Handle(ctx, testInsert(rel, strconv.Itoa(i), "foo"), pglogrepl.LSN(i)))
+	}
+	is.True(time.Since(start) >= 190*time.Millisecond)
+	is.Equal(len(out), 11)
+
+	// waiting for the limiter respects the context
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	err := h.Handle(cctx, testInsert(rel1, "12", "foo"), 12)
+	is.True(err != nil)
+}
+
+func TestCDCHandler_DebeziumSchema(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"mixed": "id"},
+		WithDebeziumSchema: true,
+		IntervalComponents: true,
+		FloatSpecials:      func(name string) any { return name },
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "mixed",
+		ColumnNum:    10,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID},
+			// part of the replica identity, but not of the configured key
+			{Flags: 1, Name: "active", DataType: pgtype.BoolOID},
+			{Name: "price", DataType: pgtype.NumericOID, TypeModifier: -1},
+			{Name: "quantity", DataType: pgtype.NumericOID, TypeModifier: 10<<16 + 4}, // numeric(10,0)
+			{Name: "ratio", DataType: pgtype.Float8OID},
+			{Name: "data", DataType: pgtype.JSONBOID},
+			{Name: "uuid", DataType: pgtype.UUIDOID},
+			{Name: "duration", DataType: pgtype.IntervalOID},
+			{Name: "created_at", DataType: pgtype.TimestamptzOID},
+			{Name: "note", DataType: pgtype.TextOID},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, &pglogrepl.InsertMessage{
+		RelationID: rel.RelationID,
+		Tuple: testTuple(
+			"1", "t", "1.5", "3", "NaN", `{"foo":"bar"}`, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+			"1 day", "2022-03-14 15:16:17+00", "baz",
+		),
+	}, 1))
+
+	rec := <-out
+
+	var got map[string]any
+	is.NoErr(json.Unmarshal([]byte(rec.Metadata[MetadataDebeziumSchema]), &got))
+
+	want := map[string]any{
+		"type":     "struct",
+		"optional": false,
+		"name":     "public.mixed.Value",
+		"fields": []any{
+			map[string]any{"type": "int64", "optional": false, "field": "id"},
+			map[string]any{"type": "boolean", "optional": true, "field": "active"},
+			map[string]any{"type": "float64", "optional": true, "field": "price"},
+			map[string]any{"type": "int64", "optional": true, "field": "quantity"},
+			map[string]any{
+				"type": "float64", "optional": true, "field": "ratio",
+				"parameters": map[string]any{"float.specials": "string"},
+			},
+			map[string]any{
+				"type": "map", "optional": true, "field": "data", "name": "io.debezium.data.Json",
+				"keys": map[string]any{"type": "string", "optional": false},
+			},
+			map[string]any{
+				"type": "array", "optional": true, "field": "uuid", "name": "io.debezium.data.Uuid",
+				"items": map[string]any{"type": "int16", "optional": false},
+			},
+			map[string]any{
+				"type": "struct", "optional": true, "field": "duration",
+				"fields": []any{
+					map[string]any{"type": "int32", "optional": false, "field": "months"},
+					map[string]any{"type": "int32", "optional": false, "field": "days"},
+					map[string]any{"type": "int64", "optional": false, "field": "microseconds"},
+				},
+			},
+			map[string]any{"type": "string", "optional": true, "field": "created_at", "name": "io.debezium.time.ZonedTimestamp"},
+			map[string]any{"type": "string", "optional": true, "field": "note"},
+		},
+	}
+	is.Equal("", cmp.Diff(want, got))
+
+	// the schema describes the values in the payload
+	after := rec.Payload.After.(sdk.StructuredData)
+	is.Equal(after["quantity"], int64(3))
+	is.Equal(after["ratio"], "NaN")
+	is.Equal(after["data"], map[string]any{"foo": "bar"})
+	is.Equal(after["duration"], map[string]any{"months": int32(0), "days": int32(1), "microseconds": int64(0)})
+	_, ok := after["uuid"].([16]uint8)
+	is.True(ok)
+}
+
+func TestCDCHandler_ExcludedColumns(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	// the table got a column which is not part of the publication
+	tableColumns := []string{"id", "name", "email"}
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+		TableColumns: func(context.Context, uint32) ([]string, error) {
+			return tableColumns, nil
+		},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataExcludedColumns], "email")
+
+	// the column was added to the publication
+	added := testRelation(1, "table")
+	added.ColumnNum = 3
+	added.Columns = append(added.Columns, &pglogrepl.RelationMessageColumn{
+		Name: "email", DataType: pgtype.TextOID, TypeModifier: -1,
+	})
+	is.NoErr(h.Handle(ctx, added, 2))
+	is.NoErr(h.Handle(ctx, testInsert(added, "2", "bar", "bar@baz.com"), 3))
+	rec = <-out
+	_, ok := rec.Metadata[MetadataExcludedColumns]
+	is.True(!ok)
+	is.Equal(rec.Payload.After.(sdk.StructuredData)["email"], "bar@baz.com")
+}
+
+func TestCDCHandler_SchemaRecords(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 10)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:     map[string]string{"table": "id"},
+		SchemaRecords: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 1))
+	is.Equal(len(out), 1)
+	schemaRec := <-out
+	id := schemaRec.Metadata[MetadataSchemaID]
+	is.True(id != "")
+	is.Equal(schemaRec.Key, sdk.StructuredData{"schemaId": id})
+	is.Equal(schemaRec.Metadata[sdk.MetadataCollection], SchemaCollection)
+	is.Equal(schemaRec.Metadata[MetadataTable], "table")
+	is.True(strings.Contains(schemaRec.Metadata[MetadataDebeziumSchema], `"name":"public.table.Value"`))
+
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 2))
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataSchemaID], id)
+	is.Equal(rec.Metadata[MetadataDebeziumSchema], "") // only in schema records
+
+	// the same layout does not produce another schema record
+	is.NoErr(h.Handle(ctx, testRelation(1, "table"), 3))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 4))
+	is.Equal(len(out), 1)
+	rec = <-out
+	is.Equal(rec.Metadata[MetadataSchemaID], id)
+
+	// a changed layout does
+	changed := testRelation(1, "table")
+	changed.ColumnNum = 3
+	changed.Columns = append(changed.Columns, &pglogrepl.RelationMessageColumn{
+		Name: "note", DataType: pgtype.TextOID, TypeModifier: -1,
+	})
+	is.NoErr(h.Handle(ctx, changed, 5))
+	is.NoErr(h.Handle(ctx, testInsert(changed, "3", "baz", "qux"), 6))
+	is.Equal(len(out), 2)
+	schemaRec = <-out
+	newID := schemaRec.Metadata[MetadataSchemaID]
+	is.True(newID != id)
+	is.True(strings.Contains(schemaRec.Metadata[MetadataDebeziumSchema], `"field":"note"`))
+	rec = <-out
+	is.Equal(rec.Metadata[MetadataSchemaID], newID)
+}
+
+func TestCDCHandler_DebeziumSchemaColumnDefaults(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		WithDebeziumSchema: true,
+		ColumnDefaults: func(_ context.Context, relationID uint32) (map[string]string, error) {
+			is.Equal(relationID, uint32(1))
+			return map[string]string{"name": "now()"}, nil
+		},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	rec := <-out
+
+	var got debeziumSchema
+	is.NoErr(json.Unmarshal([]byte(rec.Metadata[MetadataDebeziumSchema]), &got))
+	is.Equal(len(got.Fields), 2)
+	is.Equal(got.Fields[0].Parameters, nil)
+	is.Equal(got.Fields[1].Parameters, map[string]string{"column.default": "now()"})
+}
+
+func TestCDCHandler_GeneratedColumns(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id", "other": "id"},
+		GeneratedColumns: func(_ context.Context, relationID uint32) ([]string, error) {
+			if relationID == 1 {
+				return []string{"name"}, nil
+			}
+			return nil, nil
+		},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	other := testRelation(2, "other")
+	is.NoErr(h.Handle(ctx, other, 0))
+	is.NoErr(h.Handle(ctx, testInsert(other, "1", "foo"), 2))
+
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataGeneratedColumns], "name")
+	is.Equal(rec.Payload.After, sdk.StructuredData{"id": int64(1), "name": "foo"})
+
+	rec = <-out
+	_, ok := rec.Metadata[MetadataGeneratedColumns]
+	is.True(!ok)
+}
+
+func TestCDCHandler_DebeziumSchemaDisabled(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	rec := <-out
+	_, ok := rec.Metadata[MetadataDebeziumSchema]
+	is.True(!ok)
+}
+
+func TestCDCHandler_SkippedColumns(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	rs := internal.NewRelationSet()
+	rs.UnsupportedTypePolicy = internal.UnsupportedTypeSkip
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(rs, out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := testRelation(1, "table")
+	rel.Columns[1].DataType = 999999 // unknown type
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataSkippedColumns], "name")
+	is.Equal(rec.Payload.After, sdk.StructuredData{"id": int64(1)})
+}
+
+func TestCDCHandler_MetadataPrefix(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	rs := internal.NewRelationSet()
+	rs.UnsupportedTypePolicy = internal.UnsupportedTypeSkip
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(rs, out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		WithDebeziumSchema: true,
+		MetadataPrefix:     "pg.",
+	})
+
+	rel := testRelation(1, "table")
+	rel.Columns[1].DataType = 999999 // unknown type
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	rec := <-out
+	is.Equal(rec.Metadata["pg.skippedColumns"], "name")
+	is.True(rec.Metadata["pg.debezium.schema"] != "")
+	is.Equal(rec.Metadata[sdk.MetadataCollection], "table")
+
+	_, ok := rec.Metadata[MetadataSkippedColumns]
+	is.True(!ok)
+	_, ok = rec.Metadata[MetadataDebeziumSchema]
+	is.True(!ok)
+}
+
+func TestCDCHandler_IntegerPayload(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "table",
+		ColumnNum:    3,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Name: "small", DataType: pgtype.Int2OID, TypeModifier: -1},
+			{Name: "regular", DataType: pgtype.Int4OID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "9223372036854775807", "-32768", "2147483647"), 1))
+
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(math.MaxInt64)})
+	is.Equal(rec.Payload.After, sdk.StructuredData{
+		"id":      int64(math.MaxInt64),
+		"small":   int16(math.MinInt16),
+		"regular": int32(math.MaxInt32),
+	})
+}
+
+func TestCDCHandler_NumericKey(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "table",
+		ColumnNum:    2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.NumericOID, TypeModifier: -1},
+			{Name: "name", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	// the same number with a different scale produces the same key
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1.50", "foo"), 1))
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": "1.5"})
+	is.Equal(rec.Payload.After, sdk.StructuredData{"id": float64(1.5), "name": "foo"})
+
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+		OldTuple:     testTuple("1.5"),
+	}, 2))
+	rec = <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": "1.5"})
+}
+
+func TestCDCHandler_BigintKey(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		value     string
+		wantKey   int64
+		wantBytes string
+	}{
+		{name: "negative", value: "-1", wantKey: -1, wantBytes: `{"id":-1}`},
+		{name: "min", value: "-9223372036854775808", wantKey: math.MinInt64, wantBytes: `{"id":-9223372036854775808}`},
+		{name: "max", value: "9223372036854775807", wantKey: math.MaxInt64, wantBytes: `{"id":9223372036854775807}`},
+		{name: "near max", value: "9223372036854775806", wantKey: math.MaxInt64 - 1, wantBytes: `{"id":9223372036854775806}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 2)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys: map[string]string{"table": "id"},
+			})
+			rel := testRelation(1, "table")
+			is.NoErr(h.Handle(ctx, rel, 0))
+
+			is.NoErr(h.Handle(ctx, testInsert(rel, tc.value, "foo"), 1))
+			is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+				OldTuple:     testTuple(tc.value),
+			}, 2))
+
+			// the key is kept as an integer, so it serializes without losing
+			// precision and inserts and deletes produce the same bytes
+			for i := 0; i < 2; i++ {
+				rec := <-out
+				is.Equal(rec.Key, sdk.StructuredData{"id": tc.wantKey})
+				is.Equal(string(rec.Key.Bytes()), tc.wantBytes)
+			}
+		})
+	}
+}
+
+func TestCDCHandler_BoolKey(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "active"},
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "table",
+		ColumnNum:    2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "active", DataType: pgtype.BoolOID, TypeModifier: -1},
+			{Name: "verified", DataType: pgtype.BoolOID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	is.NoErr(h.Handle(ctx, testInsert(rel, "t", "f"), 1))
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"active": true})
+	is.Equal(rec.Payload.After, sdk.StructuredData{"active": true, "verified": false})
+
+	insert := testInsert(rel, "f", "")
+	insert.Tuple.Columns[1] = &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+	is.NoErr(h.Handle(ctx, insert, 2))
+	rec = <-out
+	is.Equal(rec.Key, sdk.StructuredData{"active": false})
+	is.Equal(rec.Payload.After, sdk.StructuredData{"active": false, "verified": nil})
+}
+
+func TestCDCHandler_CompositeKeyDelete(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "tenant,id"},
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:      1,
+		Namespace:       "public",
+		RelationName:    "table",
+		ReplicaIdentity: 'd',
+		ColumnNum:       3,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "tenant", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Name: "name", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "2", "foo"), 1))
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"tenant": int64(1), "id": int64(2)})
+
+	// the delete only contains the replica identity, the key is the same
+	oldTuple := testTuple("1", "2", "")
+	oldTuple.Columns[2] = &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+		OldTuple:     oldTuple,
+	}, 2))
+	rec = <-out
+	is.Equal(rec.Operation, sdk.OperationDelete)
+	is.Equal(rec.Key, sdk.StructuredData{"tenant": int64(1), "id": int64(2)})
+
+	// a delete missing part of the key fails instead of sending a partial key
+	err := h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+		OldTuple:     testTuple("1"),
+	}, 3)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `key column "id" is missing from the tuple`))
+	is.Equal(len(out), 0)
+}
+
+func TestCDCHandler_KeyOutsideIdentityDelete(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	// the key column is overridden, the table keeps its default replica
+	// identity on id
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "name"},
+	})
+
+	rel := testRelation(1, "table")
+	rel.ReplicaIdentity = 'd'
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"name": "foo"})
+
+	// the old tuple only contains id, name is sent as NULL
+	oldTuple := testTuple("1", "")
+	oldTuple.Columns[1] = &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+	err := h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+		OldTuple:     oldTuple,
+	}, 2)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `key column "name" is missing from the tuple`))
+	is.Equal(len(out), 0)
+}
+
+func TestCDCHandler_NullKey(t *testing.T) {
+	ctx := context.Background()
+
+	// the key column "name" is not part of the replica identity
+	rel := testRelation(1, "table")
+	nullName := testInsert(rel, "1", "")
+	nullName.Tuple.Columns[1] = &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+
+	tests := []struct {
+		policy  NullKeyPolicy
+		wantKey sdk.Data
+		wantErr bool
+	}{
+		{policy: "", wantErr: true}, // defaults to fail
+		{policy: NullKeyFail, wantErr: true},
+		{policy: NullKeySentinel, wantKey: sdk.StructuredData{"name": "__null__"}},
+		{policy: NullKeyNull, wantKey: sdk.StructuredData{"name": nil}},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 2)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:       map[string]string{"table": "name"},
+				NullKeys:        tc.policy,
+				NullKeySentinel: "__null__",
+			})
+			is.NoErr(h.Handle(ctx, rel, 0))
+
+			err := h.Handle(ctx, nullName, 1)
+			if tc.wantErr {
+				is.True(err != nil)
+				is.True(strings.Contains(err.Error(), `key column "name" is NULL`))
+			} else {
+				is.NoErr(err)
+				rec := <-out
+				is.Equal(rec.Key, tc.wantKey)
+			}
+
+			// deletes only contain the replica identity, the missing value of
+			// the key column is not a NULL value and NullKeys is not applied
+			err = h.Handle(ctx, &pglogrepl.DeleteMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+				OldTuple:     nullName.Tuple,
+			}, 2)
+			is.True(err != nil)
+			is.True(strings.Contains(err.Error(), `key column "name" is missing from the tuple`))
+		})
+	}
+}
+
+func TestCDCHandler_KeylessDeletes(t *testing.T) {
+	ctx := context.Background()
+
+	rel := testRelation(1, "table")
+	deleteMsg := &pglogrepl.DeleteMessage{RelationID: 1}
+
+	tests := []struct {
+		policy   KeylessDeletePolicy
+		wantErr  bool
+		wantRecs int
+		filtered uint64
+	}{
+		{policy: "", wantErr: true}, // defaults to fail
+		{policy: KeylessDeleteFail, wantErr: true},
+		{policy: KeylessDeleteSkip, filtered: 1},
+		{policy: KeylessDeleteTombstone, wantRecs: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:      map[string]string{"table": "id"},
+				KeylessDeletes: tc.policy,
+			})
+			is.NoErr(h.Handle(ctx, rel, 0))
+
+			err := h.Handle(ctx, deleteMsg, 1)
+			is.Equal(err != nil, tc.wantErr)
+			is.Equal(len(out), tc.wantRecs)
+			is.Equal(h.Stats().Filtered[FilterReasonKeylessDelete], tc.filtered)
+
+			if tc.wantRecs > 0 {
+				rec := <-out
+				is.Equal(rec.Operation, sdk.OperationDelete)
+				is.Equal(rec.Key, nil)
+				is.Equal(rec.Metadata[sdk.MetadataCollection], "table")
+			}
+		})
+	}
+}
+
+func TestCDCHandler_PartialBeforeImage(t *testing.T) {
+	ctx := context.Background()
+
+	toast := &pglogrepl.TupleData{
+		ColumnNum: 2,
+		Columns: []*pglogrepl.TupleDataColumn{
+			testTuple("1").Columns[0],
+			{DataType: pglogrepl.TupleDataTypeToast},
+		},
+	}
+
+	tests := []struct {
+		desc        string
+		policy      PartialBeforeImagePolicy
+		msg         *pglogrepl.UpdateMessage
+		wantBefore  sdk.Data
+		wantPartial bool
+	}{
+		{
+			desc:   "full old tuple",
+			policy: PartialBeforeImageInclude,
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("1", "foo"),
+				NewTuple:     testTuple("1", "bar"),
+			},
+			wantBefore: sdk.StructuredData{"id": int64(1), "name": "foo"},
+		},
+		{
+			desc:   "no old tuple",
+			policy: PartialBeforeImageInclude,
+			msg: &pglogrepl.UpdateMessage{
+				RelationID: 1,
+				NewTuple:   testTuple("1", "bar"),
+			},
+			wantBefore: nil,
+		},
+		{
+			desc:   "undecodable value included",
+			policy: PartialBeforeImageInclude,
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("not a number", "foo"),
+				NewTuple:     testTuple("1", "bar"),
+			},
+			wantBefore:  sdk.StructuredData{"name": "foo"},
+			wantPartial: true,
+		},
+		{
+			desc:   "unchanged toast included",
+			policy: PartialBeforeImageInclude,
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     toast,
+				NewTuple:     testTuple("1", "bar"),
+			},
+			wantBefore:  sdk.StructuredData{"id": int64(1)},
+			wantPartial: true,
+		},
+		{
+			desc:   "undecodable value dropped",
+			policy: PartialBeforeImageDrop,
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("not a number", "foo"),
+				NewTuple:     testTuple("1", "bar"),
+			},
+			wantBefore: nil,
+		},
+		{
+			desc:   "old key dropped",
+			policy: PartialBeforeImageDrop,
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeKey,
+				OldTuple:     testTuple("1"),
+				NewTuple:     testTuple("2", "bar"),
+			},
+			wantBefore: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:          map[string]string{"table": "id"},
+				PartialBeforeImage: tc.policy,
+			})
+
+			is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+			is.NoErr(h.Handle(ctx, tc.msg, 1))
+
+			rec := <-out
+			is.Equal(rec.Payload.Before, tc.wantBefore)
+			_, partial := rec.Metadata[MetadataPartialBeforeImage]
+			is.Equal(partial, tc.wantPartial)
+		})
+	}
+}
+
+func TestCDCHandler_RelationChange(t *testing.T) {
+	ctx := context.Background()
+
+	rel := testRelation(1, "table")
+	// the table got a new column in front of name
+	changed := testRelation(1, "table")
+	changed.ColumnNum = 3
+	changed.Columns = []*pglogrepl.RelationMessageColumn{
+		changed.Columns[0],
+		{Flags: 0, Name: "email", DataType: pgtype.TextOID, TypeModifier: -1},
+		changed.Columns[1],
+	}
+	update := func(values ...string) *pglogrepl.UpdateMessage {
+		return &pglogrepl.UpdateMessage{RelationID: 1, NewTuple: testTuple(values...)}
+	}
+
+	t.Run("replace", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 10)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys:       map[string]string{"table": "id"},
+			CoalesceUpdates: time.Hour,
+		})
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.NoErr(h.Handle(ctx, update("1", "foo"), 1))
+		is.Equal(len(out), 0) // update is held back
+
+		// the pending update is emitted with the old layout
+		is.NoErr(h.Handle(ctx, changed, 2))
+		is.Equal(len(out), 1)
+		rec := <-out
+		is.Equal(rec.Payload.After, sdk.StructuredData{"id": int64(1), "name": "foo"})
+
+		// the same relation again is not a change
+		is.NoErr(h.Handle(ctx, update("1", "foo@bar.com", "bar"), 3))
+		is.NoErr(h.Handle(ctx, changed, 4))
+		is.Equal(len(out), 0)
+
+		is.NoErr(h.Handle(ctx, testInsert(changed, "2", "baz@bar.com", "baz"), 5))
+		is.Equal(len(out), 2)
+		rec = <-out
+		is.Equal(rec.Payload.After, sdk.StructuredData{"id": int64(1), "email": "foo@bar.com", "name": "bar"})
+		rec = <-out
+		is.Equal(rec.Payload.After, sdk.StructuredData{"id": int64(2), "email": "baz@bar.com", "name": "baz"})
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		is := is.New(t)
+
+		h := NewCDCHandler(internal.NewRelationSet(), make(chan sdk.Record, 10), CDCHandlerConfig{
+			TableKeys:       map[string]string{"table": "id"},
+			RelationChanges: RelationChangeFail,
+		})
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.NoErr(h.Handle(ctx, rel, 1))
+
+		err := h.Handle(ctx, changed, 2)
+		is.Equal(err.Error(), `logrepl handler relation: column layout of relation "table" (ID 1) changed from (id,name) to (id,email,name)`)
+	})
+}
+
+func TestCDCHandler_CoalesceUpdates(t *testing.T) {
+	ctx := context.Background()
+
+	update := func(id, name string) *pglogrepl.UpdateMessage {
+		return &pglogrepl.UpdateMessage{
+			RelationID: 1,
+			NewTuple:   testTuple(id, name),
+		}
+	}
+	// receive returns the names in the records received until the timeout
+	receive := func(out chan sdk.Record, timeout time.Duration) []any {
+		var names []any
+		for {
+			select {
+			case rec := <-out:
+				names = append(names, rec.Payload.After.(sdk.StructuredData)["name"])
+			case <-time.After(timeout):
+				return names
+			}
+		}
+	}
+
+	t.Run("single key", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 10)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys:       map[string]string{"table": "id"},
+			CoalesceUpdates: 100 * time.Millisecond,
+		})
+		is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+
+		for i := 1; i <= 5; i++ {
+			is.NoErr(h.Handle(ctx, update("1", fmt.Sprintf("foo%d", i)), pglogrepl.LSN(i)))
+		}
+		is.Equal(len(out), 0) // updates are held back
+
+		is.Equal(receive(out, time.Second), []any{"foo5"})
+	})
+
+	t.Run("commit order across keys", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 10)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys:       map[string]string{"table": "id"},
+			CoalesceUpdates: time.Hour,
+		})
+		is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+
+		is.NoErr(h.Handle(ctx, update("1", "a1"), 1))
+		is.NoErr(h.Handle(ctx, update("2", "b1"), 2))
+		is.NoErr(h.Handle(ctx, update("1", "a2"), 3))
+		// other records flush pending updates
+		is.NoErr(h.Handle(ctx, testInsert(testRelation(1, "table"), "3", "c1"), 4))
+
+		is.Equal(receive(out, 100*time.Millisecond), []any{"b1", "a2", "c1"})
+	})
+
+	t.Run("one-shot metadata is kept", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 10)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys:       map[string]string{"table": "id"},
+			CoalesceUpdates: time.Hour,
+		})
+		is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+
+		// only the first update contains the key columns and identity of
+		// the relation
+		is.NoErr(h.Handle(ctx, update("1", "foo1"), 1))
+		is.NoErr(h.Handle(ctx, update("1", "foo2"), 2))
+		is.NoErr(h.coalescer.flush(ctx))
+
+		is.Equal(len(out), 1)
+		rec := <-out
+		is.Equal(rec.Payload.After.(sdk.StructuredData)["name"], "foo2")
+		is.Equal(rec.Metadata[MetadataKeyColumns], "id")
+		is.Equal(rec.Metadata[MetadataNamespace], "public")
+		is.Equal(rec.Metadata[MetadataReplicaIdentity], "default")
+	})
+
+	t.Run("close discards pending updates", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 10)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys:       map[string]string{"table": "id"},
+			CoalesceUpdates: 50 * time.Millisecond,
+		})
+		is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+		is.NoErr(h.Handle(ctx, update("1", "foo"), 1))
+		is.NoErr(h.Close())
+
+		is.Equal(len(receive(out, 200*time.Millisecond)), 0)
+	})
+}
+
+func TestCDCHandler_PauseResume(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	h.Pause()
+	// the output channel is unbuffered, handling would block if the records
+	// were sent out
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 2))
+
+	// resuming doesn't block, the buffered records are sent before the next
+	// record
+	h.Resume()
+
+	handled := make(chan error)
+	go func() {
+		handled <- h.Handle(ctx, testInsert(rel, "3", "baz"), 3)
+	}()
+	for _, id := range []int64{1, 2, 3} {
+		rec := <-out
+		is.Equal(rec.Key, sdk.StructuredData{"id": id})
+	}
+	is.NoErr(<-handled)
+	is.Equal(len(h.buffered), 0)
+}
+
+func TestCDCHandler_NextBuffered(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+	h.Pause()
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 2))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "3", "baz"), 3))
+
+	// the record sent before pausing is returned, buffered records are not
+	rec, ok := h.nextBuffered(out)
+	is.True(ok)
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(1)})
+	_, ok = h.nextBuffered(out)
+	is.True(!ok)
+
+	// the consumer drains the buffer in the same goroutine that resumed
+	h.Resume()
+	for _, id := range []int64{2, 3} {
+		rec, ok := h.nextBuffered(out)
+		is.True(ok)
+		is.Equal(rec.Key, sdk.StructuredData{"id": id})
+	}
+	_, ok = h.nextBuffered(out)
+	is.True(!ok)
+
+	is.NoErr(h.Handle(ctx, testInsert(rel, "4", "qux"), 4))
+	rec = <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(4)})
+}
+
+func TestCDCHandler_Close(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	errs := make(chan error, 1)
+	go func() {
+		for i := 1; ; i++ {
+			err := h.Handle(ctx, testInsert(rel, strconv.Itoa(i), "foo"), pglogrepl.LSN(i))
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	// the first record is received, the next send blocks until Close
+	<-out
+	is.NoErr(h.Close())
+	is.True(errors.Is(<-errs, ErrHandlerClosed))
+
+	select {
+	case <-h.Done():
+	default:
+		is.Fail() // expected handler to be done
+	}
+
+	// closed handlers don't accept messages, closing again has no effect
+	is.Equal(h.Handle(ctx, testInsert(rel, "1", "foo"), 1), ErrHandlerClosed)
+	is.NoErr(h.Close())
+
+	// the channel is owned by the caller, nothing sends to it anymore
+	close(out)
+}
+
+func TestCDCHandler_KeyColumns(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	nextKeyColumns := func(rel *pglogrepl.RelationMessage) (string, bool) {
+		is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+		rec := <-out
+		v, ok := rec.Metadata[MetadataKeyColumns]
+		return v, ok
+	}
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	// key columns are reported with the first record
+	v, ok := nextKeyColumns(rel)
+	is.True(ok)
+	is.Equal(v, "id")
+	_, ok = nextKeyColumns(rel)
+	is.True(!ok)
+
+	// same key columns are not reported again
+	is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+	_, ok = nextKeyColumns(rel)
+	is.True(!ok)
+
+	// changed key columns are reported
+	rel = testRelation(1, "table")
+	rel.Columns[1].Flags = 1
+	is.NoErr(h.Handle(ctx, rel, 0))
+	v, ok = nextKeyColumns(rel)
+	is.True(ok)
+	is.Equal(v, "id,name")
+	_, ok = nextKeyColumns(rel)
+	is.True(!ok)
+}
+
+func TestCDCHandler_ReplicaIdentity(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+
+	nextMetadata := func(rel *pglogrepl.RelationMessage) map[string]string {
+		is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+		rec := <-out
+		return rec.Metadata
+	}
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	// identity is reported with the first record
+	md := nextMetadata(rel)
+	is.Equal(md[MetadataNamespace], "public")
+	is.Equal(md[MetadataReplicaIdentity], "default")
+	md = nextMetadata(rel)
+	_, ok := md[MetadataReplicaIdentity]
+	is.True(!ok)
+
+	// changed replica identity is reported
+	rel = testRelation(1, "table")
+	rel.ReplicaIdentity = 'f'
+	is.NoErr(h.Handle(ctx, rel, 0))
+	md = nextMetadata(rel)
+	is.Equal(md[MetadataNamespace], "public")
+	is.Equal(md[MetadataReplicaIdentity], "full")
+	md = nextMetadata(rel)
+	_, ok = md[MetadataReplicaIdentity]
+	is.True(!ok)
+}
+
+func TestCDCHandler_CommitMarkers(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 5)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:     map[string]string{"table": "id"},
+		CommitMarkers: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	commitTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1}, 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 2))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 3))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{CommitLSN: 4, CommitTime: commitTime}, 4))
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 2}, 5))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "3", "baz"), 6))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{CommitLSN: 7, CommitTime: commitTime.Add(time.Second)}, 7))
+
+	is.Equal(len(out), 5)
+	isMarker := func(rec sdk.Record, lsn pglogrepl.LSN, commitTime time.Time) {
+		is.Equal(rec.Metadata[MetadataCommitLSN], lsn.String())
+		is.Equal(rec.Metadata[MetadataCommitTime], commitTime.Format(time.RFC3339Nano))
+		is.Equal(rec.Key, nil)
+		is.Equal(rec.Payload.After, nil)
+		is.Equal(rec.Position, h.buildPosition(lsn))
+	}
+	isChange := func(rec sdk.Record, id int64) {
+		is.Equal(rec.Key, sdk.StructuredData{"id": id})
+		_, ok := rec.Metadata[MetadataCommitLSN]
+		is.True(!ok)
+	}
+
+	isChange(<-out, 1)
+	isChange(<-out, 2)
+	isMarker(<-out, 4, commitTime)
+	isChange(<-out, 3)
+	isMarker(<-out, 7, commitTime.Add(time.Second))
+}
+
+func TestCDCHandler_ExplicitInsertBefore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, explicit := range []bool{false, true} {
+		t.Run(fmt.Sprintf("explicit=%v", explicit), func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:            map[string]string{"table": "id"},
+				ExplicitInsertBefore: explicit,
+			})
+
+			rel := testRelation(1, "table")
+			is.NoErr(h.Handle(ctx, rel, 0))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+			rec := <-out
+			is.Equal(rec.Payload.After, sdk.StructuredData{"id": int64(1), "name": "foo"})
+
+			// the before image is only set to null structured data if enabled
+			before, ok := rec.Payload.Before.(sdk.StructuredData)
+			is.Equal(ok, explicit)
+			is.True(before == nil)
+
+			got, err := json.Marshal(rec.Payload)
+			is.NoErr(err)
+			is.Equal(string(got), `{"before":null,"after":{"id":1,"name":"foo"}}`)
+		})
+	}
+}
+
+func TestCDCHandler_SkipTransactions(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:        map[string]string{"table": "id"},
+		SkipTransactions: []uint32{736},
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	// changes in the skipped transaction are dropped
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 736}, 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 2))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   rel.RelationID,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+		OldTuple:     testTuple("1", ""),
+	}, 3))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 4))
+
+	// changes in other transactions are emitted
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 737}, 5))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 6))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 7))
+
+	is.Equal(len(out), 1)
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(2)})
+	is.Equal(h.Stats().Filtered[FilterReasonSkippedTransaction], uint64(2))
+}
+
+// testPositionCodec embeds additional state in positions.
+type testPositionCodec struct {
+	state string
+}
+
+type testPosition struct {
+	State    string          `json:"state"`
+	Position json.RawMessage `json:"position"`
+}
+
+func (c testPositionCodec) Encode(p position.Position) sdk.Position {
+	b, err := json.Marshal(testPosition{State: c.state, Position: json.RawMessage(p.ToSDKPosition())})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (c testPositionCodec) Decode(sdkPos sdk.Position) (position.Position, error) {
+	var p testPosition
+	if err := json.Unmarshal(sdkPos, &p); err != nil {
+		return position.Position{}, err
+	}
+	return position.ParseSDKPosition(sdk.Position(p.Position))
+}
+
+func TestCDCHandler_PositionCodec(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	codec := testPositionCodec{state: "snapshot progress"}
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:     map[string]string{"table": "id"},
+		PositionCodec: codec,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 12345))
+	rec := <-out
+
+	// the position contains the additional state
+	var raw testPosition
+	is.NoErr(json.Unmarshal(rec.Position, &raw))
+	is.Equal(raw.State, "snapshot progress")
+
+	// and can still be parsed when resuming
+	pos, err := codec.Decode(rec.Position)
+	is.NoErr(err)
+	is.Equal(pos.Type, position.TypeCDC)
+	lsn, err := pos.LSN()
+	is.NoErr(err)
+	is.Equal(lsn, pglogrepl.LSN(12345))
+}
+
+func TestCDCHandler_SourceMetadata(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:        map[string]string{"table": "id"},
+		Database:         "meroxadb",
+		SystemIdentifier: "7350184950143463461",
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	// the source is added to every record
+	for i := 0; i < 2; i++ {
+		is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+		rec := <-out
+		is.Equal(rec.Metadata[MetadataDatabase], "meroxadb")
+		is.Equal(rec.Metadata[MetadataSystemIdentifier], "7350184950143463461")
+	}
+
+	// without a source no metadata is added
+	h = NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+	})
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	rec := <-out
+	_, ok := rec.Metadata[MetadataDatabase]
+	is.True(!ok)
+	is.Equal(len(h.SourceMetadata()), 0)
+}
+
+func TestCDCHandler_DefaultNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		namespace        string
+		defaultNamespace string
+		want             string
+	}{
+		{namespace: "", defaultNamespace: "public", want: "public"},
+		{namespace: "pg_catalog", defaultNamespace: "public", want: "public"},
+		{namespace: "sales", defaultNamespace: "public", want: "sales"},
+		{namespace: "", defaultNamespace: "", want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%q default %q", tc.namespace, tc.defaultNamespace), func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:        map[string]string{"table": "id"},
+				DefaultNamespace: tc.defaultNamespace,
+			})
+
+			rel := testRelation(1, "table")
+			rel.Namespace = tc.namespace
+			is.NoErr(h.Handle(ctx, rel, 0))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+
+			rec := <-out
+			is.Equal(rec.Metadata[MetadataNamespace], tc.want)
+		})
+	}
+}
+
+func TestCDCHandler_BufferTransactions(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 3)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		BufferTransactions: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1}, 0))
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 2))
+
+	// nothing is sent before the commit
+	is.Equal(len(out), 0)
+
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 3))
+	is.Equal(len(out), 2)
+	for _, id := range []int64{1, 2} {
+		rec := <-out
+		is.Equal(rec.Key, sdk.StructuredData{"id": id})
+	}
+
+	// a second transaction reuses the buffer
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 2}, 4))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "3", "baz"), 5))
+	is.Equal(len(out), 0)
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 6))
+	rec := <-out
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(3)})
+}
+
+func TestCDCHandler_BufferTransactionsLSNRange(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 3)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		BufferTransactions: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1}, 10))
+	is.NoErr(h.Handle(ctx, rel, 10))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 11))
+	is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{RelationID: 1, NewTuple: testTuple("1", "bar")}, 12))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{RelationID: 1, OldTuple: testTuple("1", "bar")}, 13))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 14))
+
+	is.Equal(len(out), 3)
+	for _, op := range []sdk.Operation{sdk.OperationCreate, sdk.OperationUpdate, sdk.OperationDelete} {
+		rec := <-out
+		is.Equal(rec.Operation, op)
+		is.Equal(rec.Metadata[MetadataBatchStartLSN], pglogrepl.LSN(11).String())
+		is.Equal(rec.Metadata[MetadataBatchEndLSN], pglogrepl.LSN(13).String())
+	}
+
+	// the range is reset for the next transaction
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 2}, 15))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "baz"), 16))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 17))
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataBatchStartLSN], pglogrepl.LSN(16).String())
+	is.Equal(rec.Metadata[MetadataBatchEndLSN], pglogrepl.LSN(16).String())
+}
+
+func TestCDCHandler_PrevLSN(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 4)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:     map[string]string{"table": "id"},
+		WithPrevLSN:   true,
+		StartLSN:      5,
+		CommitMarkers: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1}, 10))
+	is.NoErr(h.Handle(ctx, rel, 10))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 11))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 12))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{RelationID: 1, OldTuple: testTuple("1", "foo")}, 13))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 14))
+	is.Equal(len(out), 4)
+
+	// each record points to the record emitted before it, the first one to
+	// the LSN the stream started from
+	prev := pglogrepl.LSN(5)
+	for _, want := range []pglogrepl.LSN{11, 12, 13, 14} {
+		rec := <-out
+		is.Equal(rec.Metadata[MetadataPrevLSN], prev.String())
+
+		pos, err := position.ParseSDKPosition(rec.Position)
+		is.NoErr(err)
+		lsn, err := pos.LSN()
+		is.NoErr(err)
+		is.Equal(lsn, want)
+		is.True(lsn > prev)
+		prev = lsn
+	}
+}
+
+func TestCDCHandler_ReplayedChanges(t *testing.T) {
+	ctx := context.Background()
+
+	for _, policy := range []ReplayedChangePolicy{ReplayedChangeKeep, ReplayedChangeDrop, ReplayedChangeMark} {
+		t.Run(string(policy), func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 7)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys: map[string]string{"table": "id"},
+				// the last emitted change is at 10 in the transaction
+				// committed at 14
+				StartLSN:        10,
+				StartCommitLSN:  14,
+				ReplayedChanges: policy,
+			})
+
+			// Postgres resends all transactions committed after 10, the
+			// transaction committed at 12 was emitted completely
+			rel := testRelation(1, "table")
+			is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1, FinalLSN: 12}, 9))
+			is.NoErr(h.Handle(ctx, rel, 9))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 9))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "2", "foo"), 11))
+			is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{CommitLSN: 12}, 12))
+
+			// the transaction of the last emitted change was emitted up to
+			// and including 10
+			is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 2, FinalLSN: 14}, 8))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "3", "bar"), 8))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "4", "bar"), 10))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "5", "bar"), 13))
+			is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{CommitLSN: 14}, 14))
+
+			// the next transaction started before 10, but was committed
+			// after the last emitted change and was not emitted yet
+			is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 3, FinalLSN: 16}, 7))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "6", "baz"), 7))
+			is.NoErr(h.Handle(ctx, testInsert(rel, "7", "baz"), 15))
+			is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{CommitLSN: 16}, 16))
+
+			replayed := map[pglogrepl.LSN]bool{9: true, 11: true, 8: true, 10: true}
+			var got []pglogrepl.LSN
+			for len(out) > 0 {
+				rec := <-out
+				pos, err := position.ParseSDKPosition(rec.Position)
+				is.NoErr(err)
+				lsn, err := pos.LSN()
+				is.NoErr(err)
+				got = append(got, lsn)
+
+				_, marked := rec.Metadata[MetadataReplayed]
+				is.Equal(marked, policy == ReplayedChangeMark && replayed[lsn])
+			}
+
+			switch policy {
+			case ReplayedChangeDrop:
+				is.Equal(got, []pglogrepl.LSN{13, 7, 15})
+				is.Equal(h.Stats().Filtered[FilterReasonReplayed], uint64(4))
+			default:
+				is.Equal(got, []pglogrepl.LSN{9, 11, 8, 10, 13, 7, 15})
+			}
+		})
+	}
+}
+
+func TestCDCHandler_ReplayedChangesWithoutCommitLSN(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	// positions written without the commit LSN don't tell which changes of
+	// the resent transactions were emitted, all of them are kept
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:       map[string]string{"table": "id"},
+		StartLSN:        10,
+		ReplayedChanges: ReplayedChangeDrop,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1, FinalLSN: 12}, 9))
+	is.NoErr(h.Handle(ctx, rel, 9))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 9))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "foo"), 11))
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{CommitLSN: 12}, 12))
+
+	is.Equal(len(out), 2)
+	is.Equal(h.Stats().Filtered[FilterReasonReplayed], uint64(0))
+
+	// the positions of the records contain the commit LSN
+	pos, err := position.ParseSDKPosition((<-out).Position)
+	is.NoErr(err)
+	is.Equal(pos.LastLSN, pglogrepl.LSN(9).String())
+	is.Equal(pos.LastCommitLSN, pglogrepl.LSN(12).String())
+}
+
+func TestCDCHandler_FloatSpecials(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:     map[string]string{"table": "id"},
+		FloatSpecials: func(string) any { return nil },
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "table",
+		ColumnNum:    5,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Name: "nan", DataType: pgtype.Float8OID, TypeModifier: -1},
+			{Name: "inf", DataType: pgtype.Float4OID, TypeModifier: -1},
+			{Name: "ninf", DataType: pgtype.Float8OID, TypeModifier: -1},
+			{Name: "values", DataType: pgtype.Float8ArrayOID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "NaN", "Infinity", "-Infinity", "{1.5,NaN}"), 1))
+
+	rec := <-out
+	is.Equal(rec.Payload.After, sdk.StructuredData{
+		"id":     int64(1),
+		"nan":    nil,
+		"inf":    nil,
+		"ninf":   nil,
+		"values": []any{1.5, nil},
+	})
+}
+
+func TestCDCHandler_KeyHash(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 4)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:      map[string]string{"table": "id"},
+		WithKeyHash:    true,
+		KeylessDeletes: KeylessDeleteTombstone,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{RelationID: 1, NewTuple: testTuple("1", "bar")}, 2))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "foo"), 3))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{RelationID: 1}, 4))
+
+	insert, update, other, tombstone := <-out, <-out, <-out, <-out
+
+	want, err := types.HashKey(sdk.StructuredData{"id": int64(1)})
+	is.NoErr(err)
+	is.Equal(insert.Metadata[MetadataKeyHash], want)
+	is.Equal(update.Metadata[MetadataKeyHash], want)
+	is.True(other.Metadata[MetadataKeyHash] != want)
+
+	// records without a key have no hash
+	_, ok := tombstone.Metadata[MetadataKeyHash]
+	is.True(!ok)
+}
+
+func TestCDCHandler_RelationID(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:      map[string]string{"table1": "id", "table2": "id"},
+		WithRelationID: true,
+	})
+
+	rel1 := testRelation(16384, "table1")
+	rel2 := testRelation(4294967295, "table2")
+	is.NoErr(h.Handle(ctx, rel1, 0))
+	is.NoErr(h.Handle(ctx, rel2, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel1, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel2, "1", "foo"), 2))
+
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataRelationID], "16384")
+	rec = <-out
+	is.Equal(rec.Metadata[MetadataRelationID], "4294967295")
+}
+
+func TestCDCHandler_IntervalComponents(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		IntervalComponents: true,
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "table",
+		ColumnNum:    4,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.IntervalOID, TypeModifier: -1},
+			{Name: "duration", DataType: pgtype.IntervalOID, TypeModifier: -1},
+			{Name: "durations", DataType: pgtype.IntervalArrayOID, TypeModifier: -1},
+			{Name: "empty", DataType: pgtype.IntervalOID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	insert := testInsert(rel, "1 day", "1 year 2 mons 3 days 04:05:06.789", `{"1 mon","-1 day"}`, "")
+	insert.Tuple.Columns[3] = &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+	is.NoErr(h.Handle(ctx, insert, 1))
+
+	rec := <-out
+	// keys are not affected
+	is.Equal(rec.Key, sdk.StructuredData{"id": "P1D"})
+	is.Equal(rec.Payload.After, sdk.StructuredData{
+		"id": map[string]any{"months": int32(0), "days": int32(1), "microseconds": int64(0)},
+		"duration": map[string]any{
+			"months":       int32(14),
+			"days":         int32(3),
+			"microseconds": int64(4*time.Hour+5*time.Minute+6789*time.Millisecond) / 1000,
+		},
+		"durations": []any{
+			map[string]any{"months": int32(1), "days": int32(0), "microseconds": int64(0)},
+			map[string]any{"months": int32(0), "days": int32(-1), "microseconds": int64(0)},
+		},
+		"empty": nil,
+	})
+}
+
+func TestCDCHandler_RelationPublication(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 3)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table1": "id", "table2": "id", "table3": "id"},
+		RelationPublication: func(_ context.Context, relationID uint32) (string, error) {
+			return map[uint32]string{1: "pub1", 2: "pub2"}[relationID], nil
+		},
+	})
+
+	rel1 := testRelation(1, "table1")
+	rel2 := testRelation(2, "table2")
+	rel3 := testRelation(3, "table3")
+	for _, rel := range []*pglogrepl.RelationMessage{rel1, rel2, rel3} {
+		is.NoErr(h.Handle(ctx, rel, 0))
+	}
+	is.NoErr(h.Handle(ctx, testInsert(rel1, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel2, "1", "foo"), 2))
+	is.NoErr(h.Handle(ctx, testInsert(rel3, "1", "foo"), 3))
+
+	rec := <-out
+	is.Equal(rec.Metadata[MetadataPublication], "pub1")
+	rec = <-out
+	is.Equal(rec.Metadata[MetadataPublication], "pub2")
+	rec = <-out
+	_, ok := rec.Metadata[MetadataPublication]
+	is.True(!ok) // unknown publication
+}
+
+func TestCDCHandler_ApproxSize(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 3)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:      map[string]string{"table": "id"},
+		WithApproxSize: true,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", strings.Repeat("foo", 100)), 2))
+	is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+		OldTuple:     testTuple("2", strings.Repeat("foo", 100)),
+		NewTuple:     testTuple("2", strings.Repeat("foo", 100)),
+	}, 3))
+
+	var sizes []int
+	for i := 0; i < 3; i++ {
+		rec := <-out
+		size, err := strconv.Atoi(rec.Metadata[MetadataApproxSize])
+		is.NoErr(err)
+		sizes = append(sizes, size)
+	}
+
+	// braces, "id" with an integer and "name" with a 3 character string
+	is.Equal(sizes[0], 2+(2+4+8)+(4+4+5))
+	is.True(sizes[1] > sizes[0]+290)   // larger value
+	is.True(sizes[2] >= sizes[1]*2-10) // before and after image
+}
+
+func TestCDCHandler_Timestamps(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 1)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:      map[string]string{"table": "id"},
+		WithCommitTime: true,
+		WithReceivedAt: true,
+	})
+
+	// the transaction was committed before the connector received it
+	commitTime := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, rel, 0))
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{FinalLSN: 2, CommitTime: commitTime, Xid: 1}, 1))
+
+	before := time.Now()
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+	after := time.Now()
+	rec := <-out
+
+	gotCommitTime, err := time.Parse(time.RFC3339Nano, rec.Metadata[MetadataCommitTime])
+	is.NoErr(err)
+	is.True(gotCommitTime.Equal(commitTime))
+
+	receivedAt, err := time.Parse(time.RFC3339Nano, rec.Metadata[MetadataReceivedAt])
+	is.NoErr(err)
+	is.True(!receivedAt.Before(before) && !receivedAt.After(after))
+	is.True(receivedAt.After(gotCommitTime))
+}
+
+func TestCDCHandler_StaticMetadata(t *testing.T) {
+	ctx := context.Background()
+	rel := testRelation(1, "table")
+	static := map[string]string{
+		"environment":          "production",
+		sdk.MetadataCollection: "overwritten",
+	}
+
+	handle := func(is *is.I, overwrite bool) []sdk.Record {
+		out := make(chan sdk.Record, 3)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys:         map[string]string{"table": "id"},
+			StaticMetadata:    static,
+			OverwriteMetadata: overwrite,
+		})
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.NoErr(h.Handle(ctx, testInsert(rel, "1", "foo"), 1))
+		is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{
+			RelationID: 1,
+			NewTuple:   testTuple("1", "bar"),
+		}, 2))
+		is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+			RelationID:   1,
+			OldTupleType: pglogrepl.DeleteMessageTupleTypeKey,
+			OldTuple:     testTuple("1", ""),
+		}, 3))
+		return []sdk.Record{<-out, <-out, <-out}
+	}
+
+	t.Run("keeps dynamic keys", func(t *testing.T) {
+		is := is.New(t)
+		for _, rec := range handle(is, false) {
+			is.Equal(rec.Metadata["environment"], "production")
+			is.Equal(rec.Metadata[sdk.MetadataCollection], "table")
+		}
+	})
+
+	t.Run("overwrites dynamic keys", func(t *testing.T) {
+		is := is.New(t)
+		for _, rec := range handle(is, true) {
+			is.Equal(rec.Metadata["environment"], "production")
+			is.Equal(rec.Metadata[sdk.MetadataCollection], "overwritten")
+		}
+	})
+}
+
+func TestCDCHandler_DroppedTable(t *testing.T) {
+	ctx := context.Background()
+
+	rel := testRelation(1, "table")
+	// a decoding error, e.g. caused by a stale relation
+	invalid := testInsert(rel, "not a number", "foo")
+	// the relation is unknown
+	unknown := &pglogrepl.InsertMessage{RelationID: 2, Tuple: testTuple("1", "foo")}
+
+	t.Run("dropped", func(t *testing.T) {
+		is := is.New(t)
+
+		rs := internal.NewRelationSet()
+		out := make(chan sdk.Record, 1)
+		h := NewCDCHandler(rs, out, CDCHandlerConfig{
+			TableKeys: map[string]string{"table": "id"},
+			RelationExists: func(context.Context, uint32) (bool, error) {
+				return false, nil
+			},
+			WithDebeziumSchema: true,
+			GeneratedColumns: func(context.Context, uint32) ([]string, error) {
+				return nil, nil
+			},
+			RelationPublication: func(context.Context, uint32) (string, error) {
+				return "pub", nil
+			},
+		})
+
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.NoErr(h.Handle(ctx, invalid, 1))
+		is.NoErr(h.Handle(ctx, unknown, 2))
+
+		is.Equal(len(out), 0)
+		is.Equal(h.Stats().Filtered[FilterReasonDroppedTable], uint64(2))
+
+		_, err := rs.Get(rel.RelationID)
+		is.True(err != nil) // relation was removed
+
+		// no state is left behind for the relation
+		for _, m := range []map[uint32]string{
+			h.schemas, h.schemaIDs, h.keyColumns, h.generatedColumns, h.excludedColumns, h.publications,
+		} {
+			_, ok := m[rel.RelationID]
+			is.True(!ok)
+		}
+		_, ok := h.identities[rel.RelationID]
+		is.True(!ok)
+		is.Equal(len(h.keyChanged), 0)
+		is.Equal(len(h.identityChanged), 0)
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		is := is.New(t)
+
+		h := NewCDCHandler(internal.NewRelationSet(), make(chan sdk.Record, 1), CDCHandlerConfig{
+			TableKeys: map[string]string{"table": "id"},
+			RelationExists: func(context.Context, uint32) (bool, error) {
+				return true, nil
+			},
+		})
+
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.True(h.Handle(ctx, invalid, 1) != nil)
+		is.True(h.Handle(ctx, unknown, 2) != nil)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		is := is.New(t)
+
+		h := NewCDCHandler(internal.NewRelationSet(), make(chan sdk.Record, 1), CDCHandlerConfig{
+			TableKeys: map[string]string{"table": "id"},
+		})
+
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.True(h.Handle(ctx, invalid, 1) != nil)
+		is.True(h.Handle(ctx, unknown, 2) != nil)
+	})
+}
+
+func TestCDCHandler_Quarantine(t *testing.T) {
+	ctx := context.Background()
+
+	rel := testRelation(1, "table")
+	invalid := testInsert(rel, "not a number", "foo")
+
+	t.Run("continues", func(t *testing.T) {
+		is := is.New(t)
+
+		var quarantined []QuarantinedMessage
+		out := make(chan sdk.Record, 1)
+		h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+			TableKeys: map[string]string{"table": "id"},
+			Quarantine: func(_ context.Context, msg QuarantinedMessage) error {
+				quarantined = append(quarantined, msg)
+				return nil
+			},
+		})
+
+		is.NoErr(h.Handle(ctx, rel, 0))
+		is.NoErr(h.Handle(ctx, invalid, 1))
+		is.Equal(len(out), 0)
+
+		is.Equal(len(quarantined), 1)
+		is.Equal(quarantined[0].Message, invalid)
+		is.Equal(quarantined[0].LSN, pglogrepl.LSN(1))
+		is.True(strings.Contains(quarantined[0].Err.Error(), "failed to decode new values"))
+		is.Equal(h.Stats().Filtered[FilterReasonQuarantined], uint64(1))
+
+		// the next change is processed as usual
+		is.NoErr(h.Handle(ctx, testInsert(rel, "2", "bar"), 2))
+		rec := <-out
+		is.Equal(rec.Key, sdk.StructuredData{"id": int64(2)})
+	})
+
+	t.Run("quarantine fails", func(t *testing.T) {
+		is := is.New(t)
+
+		h := NewCDCHandler(internal.NewRelationSet(), make(chan sdk.Record, 1), CDCHandlerConfig{
+			TableKeys: map[string]string{"table": "id"},
+			Quarantine: func(context.Context, QuarantinedMessage) error {
+				return errors.New("quarantine is full")
+			},
+		})
+
+		is.NoErr(h.Handle(ctx, rel, 0))
+		err := h.Handle(ctx, invalid, 1)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "quarantine is full"))
+		is.Equal(h.Stats().Filtered[FilterReasonQuarantined], uint64(0))
+	})
+}
+
+func TestCDCHandler_RowFilter(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	out := make(chan sdk.Record, 5)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys: map[string]string{"table": "id"},
+		RowFilter: func(table string, values map[string]any) bool {
+			return table == "table" && values["status"] == "active"
+		},
+	})
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:      1,
+		Namespace:       "public",
+		RelationName:    "table",
+		ReplicaIdentity: 'f',
+		ColumnNum:       2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Flags: 1, Name: "status", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+	is.NoErr(h.Handle(ctx, rel, 0))
+
+	is.NoErr(h.Handle(ctx, testInsert(rel, "1", "active"), 1))
+	is.NoErr(h.Handle(ctx, testInsert(rel, "2", "inactive"), 2))
+	is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+		OldTuple:     testTuple("1", "active"),
+		NewTuple:     testTuple("1", "inactive"),
+	}, 3))
+	is.NoErr(h.Handle(ctx, &pglogrepl.UpdateMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+		OldTuple:     testTuple("2", "inactive"),
+		NewTuple:     testTuple("2", "active"),
+	}, 4))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeOld,
+		OldTuple:     testTuple("1", "inactive"),
+	}, 5))
+	is.NoErr(h.Handle(ctx, &pglogrepl.DeleteMessage{
+		RelationID:   1,
+		OldTupleType: pglogrepl.DeleteMessageTupleTypeOld,
+		OldTuple:     testTuple("2", "active"),
+	}, 6))
+
+	// only changes of active rows are emitted
+	is.Equal(len(out), 3)
+	for _, want := range []struct {
+		op  sdk.Operation
+		key sdk.Data
+	}{
+		{op: sdk.OperationCreate, key: sdk.StructuredData{"id": int64(1)}},
+		{op: sdk.OperationUpdate, key: sdk.StructuredData{"id": int64(2)}},
+		{op: sdk.OperationDelete, key: sdk.StructuredData{"id": int64(2)}},
+	} {
+		rec := <-out
+		is.Equal(rec.Operation, want.op)
+		is.Equal(rec.Key, want.key)
+	}
+	is.Equal(h.Stats().Filtered[FilterReasonRow], uint64(3))
+}
+
+func TestCDCHandler_DropNoopUpdates(t *testing.T) {
+	ctx := context.Background()
+
+	toast := &pglogrepl.TupleData{
+		ColumnNum: 2,
+		Columns: []*pglogrepl.TupleDataColumn{
+			testTuple("1").Columns[0],
+			{DataType: pglogrepl.TupleDataTypeToast},
+		},
+	}
+
+	tests := []struct {
+		desc    string
+		msg     *pglogrepl.UpdateMessage
+		wantOut bool
+	}{
+		{
+			desc: "no-op update",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("1", "foo"),
+				NewTuple:     testTuple("1", "foo"),
+			},
+			wantOut: false,
+		},
+		{
+			desc: "no-op update with unchanged toast",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("1", "foo"),
+				NewTuple:     toast,
+			},
+			wantOut: false,
+		},
+		{
+			desc: "changed value",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("1", "foo"),
+				NewTuple:     testTuple("1", "bar"),
+			},
+			wantOut: true,
+		},
+		{
+			desc: "no full old tuple",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID: 1,
+				NewTuple:   testTuple("1", "foo"),
+			},
+			wantOut: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:       map[string]string{"table": "id"},
+				DropNoopUpdates: true,
+			})
+
+			is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+			is.NoErr(h.Handle(ctx, tc.msg, 1))
+
+			is.Equal(len(out) == 1, tc.wantOut)
+			if !tc.wantOut {
+				is.Equal(h.Stats().Filtered[FilterReasonNoopUpdate], uint64(1))
+			}
+		})
+	}
+}
+
+func TestCDCHandler_RequireBeforeImage(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc    string
+		msg     *pglogrepl.UpdateMessage
+		wantErr bool
+	}{
+		{
+			desc: "full old tuple",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+				OldTuple:     testTuple("1", "foo"),
+				NewTuple:     testTuple("1", "bar"),
+			},
+			wantErr: false,
+		},
+		{
+			desc: "old key only",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID:   1,
+				OldTupleType: pglogrepl.UpdateMessageTupleTypeKey,
+				OldTuple:     testTuple("1"),
+				NewTuple:     testTuple("2", "bar"),
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no old tuple",
+			msg: &pglogrepl.UpdateMessage{
+				RelationID: 1,
+				NewTuple:   testTuple("1", "bar"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+				TableKeys:          map[string]string{"table": "id"},
+				RequireBeforeImage: true,
+			})
+
+			is.NoErr(h.Handle(ctx, testRelation(1, "table"), 0))
+			err := h.Handle(ctx, tc.msg, 1)
+			is.Equal(err != nil, tc.wantErr)
+			is.Equal(len(out) == 1, !tc.wantErr)
+		})
+	}
+}
+
+// testRelation returns a relation message for a table with an int8 column "id"
+// and a text column "name".
+func testRelation(id uint32, table string) *pglogrepl.RelationMessage {
+	return &pglogrepl.RelationMessage{
+		RelationID:      id,
+		Namespace:       "public",
+		RelationName:    table,
+		ReplicaIdentity: 'd',
+		ColumnNum:       2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Flags: 0, Name: "name", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+}
+
+// testTuple returns tuple data containing the supplied values in text format.
+func testTuple(values ...string) *pglogrepl.TupleData {
+	cols := make([]*pglogrepl.TupleDataColumn, len(values))
+	for i, v := range values {
+		cols[i] = &pglogrepl.TupleDataColumn{
+			DataType: pglogrepl.TupleDataTypeText,
+			Length:   uint32(len(v)),
+			Data:     []byte(v),
+		}
+	}
+	return &pglogrepl.TupleData{
+		ColumnNum: uint16(len(values)),
+		Columns:   cols,
+	}
+}
+
+func testInsert(rel *pglogrepl.RelationMessage, values ...string) *pglogrepl.InsertMessage {
+	return &pglogrepl.InsertMessage{
+		RelationID: rel.RelationID,
+		Tuple:      testTuple(values...),
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HealthStatus describes the state of logical replication.
+type HealthStatus struct {
+	// ConnectionAlive is true if the replication connection is open and the
+	// subscription is running.
+	ConnectionAlive bool
+	// SlotActive is true if the replication slot is in use by the replication
+	// connection.
+	SlotActive bool
+	// Reason describes why replication is unhealthy, it is empty otherwise.
+	Reason string
+}
+
+// OK returns true if the status is healthy.
+func (s HealthStatus) OK() bool {
+	return s.ConnectionAlive && s.SlotActive
+}
+
+// Healthy checks that the replication connection is alive and the replication
+// slot is active. The slot is checked using a separate short-lived connection,
+// so streaming is not disrupted.
+func (i *CDCIterator) Healthy(ctx context.Context) HealthStatus {
+	var status HealthStatus
+
+	switch {
+	case !i.subscriberReady():
+		status.Reason = "logical replication has not been started"
+		return status
+	case i.pgconn.IsClosed():
+		status.Reason = "replication connection is closed"
+		return status
+	}
+
+	select {
+	case <-i.sub.Done():
+		status.Reason = fmt.Sprintf("logical replication stopped: %v", i.sub.Err())
+		return status
+	default:
+		status.ConnectionAlive = true
+	}
+
+	active, err := i.slotActive(ctx)
+	if err != nil {
+		status.Reason = fmt.Sprintf("failed to check replication slot: %v", err)
+		return status
+	}
+	if !active {
+		status.Reason = fmt.Sprintf("replication slot %q is not active on the replication connection", i.config.SlotName)
+		return status
+	}
+
+	status.SlotActive = true
+	return status
+}
+
+// slotActive returns true if the replication slot is used by the replication
+// connection.
+func (i *CDCIterator) slotActive(ctx context.Context) (bool, error) {
+	conn, err := pgconn.ConnectConfig(ctx, i.pgconf)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(ctx)
+
+	res := conn.ExecParams(
+		ctx,
+		"SELECT active_pid FROM pg_replication_slots WHERE slot_name = $1 AND active",
+		[][]byte{[]byte(i.config.SlotName)},
+		[]uint32{pgtype.TextOID},
+		nil,
+		nil,
+	).Read()
+	if res.Err != nil {
+		return false, res.Err
+	}
+	if len(res.Rows) == 0 {
+		return false, nil
+	}
+
+	return string(res.Rows[0][0]) == strconv.FormatUint(uint64(i.pgconn.PID()), 10), nil
+}
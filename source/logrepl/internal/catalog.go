@@ -0,0 +1,159 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ColumnDefaults returns the default value expressions of the columns in the
+// relation with the supplied ID, mapped by column name. Columns without a
+// default are not included.
+func ColumnDefaults(ctx context.Context, conn *pgconn.PgConn, relationID uint32) (map[string]string, error) {
+	const query = `SELECT a.attname, pg_get_expr(d.adbin, d.adrelid)
+		FROM pg_attribute a
+		JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`
+
+	rows, err := queryRelation(ctx, conn, query, relationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query column defaults of relation %d: %w", relationID, err)
+	}
+
+	defaults := make(map[string]string, len(rows))
+	for _, row := range rows {
+		defaults[string(row[0])] = string(row[1])
+	}
+	return defaults, nil
+}
+
+// GeneratedColumns returns the names of the generated columns in the relation
+// with the supplied ID, in the order of the columns.
+func GeneratedColumns(ctx context.Context, conn *pgconn.PgConn, relationID uint32) ([]string, error) {
+	const query = `SELECT attname FROM pg_attribute
+		WHERE attrelid = $1 AND attnum > 0 AND NOT attisdropped AND attgenerated <> ''
+		ORDER BY attnum`
+
+	rows, err := queryRelation(ctx, conn, query, relationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query generated columns of relation %d: %w", relationID, err)
+	}
+
+	cols := make([]string, len(rows))
+	for i, row := range rows {
+		cols[i] = string(row[0])
+	}
+	return cols, nil
+}
+
+// PublishableColumns returns the names of the columns in the relation with the
+// supplied ID which can be replicated, i.e. all columns except generated ones,
+// in the order of the columns.
+func PublishableColumns(ctx context.Context, conn *pgconn.PgConn, relationID uint32) ([]string, error) {
+	const query = `SELECT attname FROM pg_attribute
+		WHERE attrelid = $1 AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+		ORDER BY attnum`
+
+	rows, err := queryRelation(ctx, conn, query, relationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns of relation %d: %w", relationID, err)
+	}
+
+	cols := make([]string, len(rows))
+	for i, row := range rows {
+		cols[i] = string(row[0])
+	}
+	return cols, nil
+}
+
+// RelationExists returns true if the relation with the supplied ID exists in
+// the catalog.
+func RelationExists(ctx context.Context, conn *pgconn.PgConn, relationID uint32) (bool, error) {
+	const query = `SELECT EXISTS(SELECT 1 FROM pg_class WHERE oid = $1)`
+
+	rows, err := queryRelation(ctx, conn, query, relationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if relation %d exists: %w", relationID, err)
+	}
+	return len(rows) == 1 && string(rows[0][0]) == "t", nil
+}
+
+// RelationPublications returns the names of the publications which contain the
+// relation with the supplied ID, ordered by name.
+func RelationPublications(ctx context.Context, conn *pgconn.PgConn, relationID uint32) ([]string, error) {
+	const query = `SELECT p.pubname FROM pg_publication_tables p
+		JOIN pg_namespace n ON n.nspname = p.schemaname
+		JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = p.tablename
+		WHERE c.oid = $1
+		ORDER BY p.pubname`
+
+	rows, err := queryRelation(ctx, conn, query, relationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query publications of relation %d: %w", relationID, err)
+	}
+
+	pubs := make([]string, len(rows))
+	for i, row := range rows {
+		pubs[i] = string(row[0])
+	}
+	return pubs, nil
+}
+
+// SlotExists checks if a replication slot with the name exists. The
+// connection can be a regular or a replication connection.
+func SlotExists(ctx context.Context, conn *pgconn.PgConn, name string) (bool, error) {
+	results, err := conn.Exec(
+		ctx,
+		"SELECT 1 FROM pg_replication_slots WHERE slot_name = "+quoteLiteral(name),
+	).ReadAll()
+	if err != nil {
+		return false, fmt.Errorf("failed to look up replication slot %q: %w", name, err)
+	}
+	return len(results[0].Rows) > 0, nil
+}
+
+// queryRelation executes the query with the relation ID as the only parameter
+// and returns the rows in text format.
+func queryRelation(ctx context.Context, conn *pgconn.PgConn, query string, relationID uint32) ([][][]byte, error) {
+	res := conn.ExecParams(
+		ctx,
+		query,
+		[][]byte{[]byte(strconv.FormatUint(uint64(relationID), 10))},
+		[]uint32{pgtype.OIDOID},
+		nil,
+		nil,
+	).Read()
+	return res.Rows, res.Err
+}
+
+// quoteLiteral quotes the string as an SQL string literal, so it can be used
+// in queries sent with the simple query protocol. Replication connections
+// only support the simple protocol, queries which run on them can't use
+// parameters.
+func quoteLiteral(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if strings.Contains(s, `\`) {
+		// escape string constants treat backslashes the same way,
+		// regardless of standard_conforming_strings
+		return "E'" + strings.ReplaceAll(s, `\`, `\\`) + "'"
+	}
+	return "'" + s + "'"
+}
@@ -0,0 +1,124 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/matryer/is"
+)
+
+func TestColumnDefaults(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.RandomIdentifier(t)
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s (
+		id bigserial PRIMARY KEY,
+		name text,
+		created_at timestamptz DEFAULT now()
+	)`, table))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP TABLE "+table)
+		is.NoErr(err)
+	})
+
+	var relationID uint32
+	err = conn.QueryRow(ctx, "SELECT $1::regclass::oid", table).Scan(&relationID)
+	is.NoErr(err)
+
+	got, err := ColumnDefaults(ctx, conn.PgConn(), relationID)
+	is.NoErr(err)
+	is.Equal(got, map[string]string{
+		"id":         fmt.Sprintf("nextval('%s_id_seq'::regclass)", table),
+		"created_at": "now()",
+	})
+}
+
+func TestGeneratedColumns(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.RandomIdentifier(t)
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s (
+		id bigserial PRIMARY KEY,
+		price numeric,
+		quantity integer,
+		total numeric GENERATED ALWAYS AS (price * quantity) STORED
+	)`, table))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP TABLE "+table)
+		is.NoErr(err)
+	})
+
+	var relationID uint32
+	err = conn.QueryRow(ctx, "SELECT $1::regclass::oid", table).Scan(&relationID)
+	is.NoErr(err)
+
+	got, err := GeneratedColumns(ctx, conn.PgConn(), relationID)
+	is.NoErr(err)
+	is.Equal(got, []string{"total"})
+}
+
+func TestRelationPublications(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+	other := test.SetupTestTable(ctx, t, conn)
+	pub1 := test.RandomIdentifier(t)
+	pub2 := test.RandomIdentifier(t)
+	test.CreatePublication(t, conn, pub1, []string{table})
+	test.CreatePublication(t, conn, pub2, []string{table, other})
+
+	var relationID uint32
+	err := conn.QueryRow(ctx, "SELECT $1::regclass::oid", table).Scan(&relationID)
+	is.NoErr(err)
+
+	got, err := RelationPublications(ctx, conn.PgConn(), relationID)
+	is.NoErr(err)
+	want := []string{pub1, pub2}
+	slices.Sort(want)
+	is.Equal(got, want)
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{in: "orders", want: `'orders'`},
+		{in: "", want: `''`},
+		{in: "o'brien", want: `'o''brien'`},
+		{in: `a\b'c`, want: `E'a\\b''c'`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.in, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(quoteLiteral(tc.in), tc.want)
+		})
+	}
+}
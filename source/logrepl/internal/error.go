@@ -25,3 +25,23 @@ func IsPgDuplicateErr(err error) bool {
 	var pgerr *pgconn.PgError
 	return errors.As(err, &pgerr) && pgerr.Code == pgerrcode.DuplicateObject
 }
+
+// IsPgQueryCanceledErr returns true if the statement was canceled, e.g.
+// because it ran longer than statement_timeout.
+func IsPgQueryCanceledErr(err error) bool {
+	var pgerr *pgconn.PgError
+	return errors.As(err, &pgerr) && pgerr.Code == pgerrcode.QueryCanceled
+}
+
+// IsPgTransientErr returns true if the error is caused by a condition which
+// can go away when the statement is retried on the same connection, i.e. a
+// serialization failure or a deadlock. Connection exceptions are not
+// transient, the connection can't be used anymore after them.
+func IsPgTransientErr(err error) bool {
+	var pgerr *pgconn.PgError
+	if !errors.As(err, &pgerr) {
+		return false
+	}
+	return pgerr.Code == pgerrcode.SerializationFailure ||
+		pgerr.Code == pgerrcode.DeadlockDetected
+}
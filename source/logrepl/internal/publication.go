@@ -16,31 +16,104 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// relkindNames maps pg_class.relkind values of relations which can't be part
+// of a publication to a readable name.
+var relkindNames = map[string]string{
+	"v": "a view",
+	"m": "a materialized view",
+	"f": "a foreign table",
+	"S": "a sequence",
+	"i": "an index",
+	"I": "a partitioned index",
+	"c": "a composite type",
+	"t": "a TOAST table",
+}
+
 // CreatePublicationOptions contains additional options for creating a publication.
-// If AllTables and Tables are both true and not empty at the same time,
+// If AllTables is true and Tables or Schemas are not empty at the same time,
 // publication creation will fail.
 type CreatePublicationOptions struct {
-	Tables            []string
+	// AllTables creates a publication for all tables in the database,
+	// including tables created in the future.
+	AllTables bool
+	Tables    []string
+	// Schemas contains schemas whose tables, including tables created in the
+	// future, are part of the publication. It can be combined with Tables and
+	// requires Postgres 15 or newer.
+	Schemas           []string
 	PublicationParams []string
+	// IfNotExists skips the creation if a publication with the name exists
+	// already. Postgres does not support IF NOT EXISTS for publications, so
+	// pg_publication is checked first.
+	IfNotExists bool
+	// AddMissingTables adds tables which are not part of an existing
+	// publication to it. It only has an effect together with IfNotExists.
+	AddMissingTables bool
 }
 
 // CreatePublication creates a publication.
 func CreatePublication(ctx context.Context, conn *pgconn.PgConn, name string, opts CreatePublicationOptions) error {
-	if len(opts.Tables) == 0 {
+	switch {
+	case opts.AllTables && (len(opts.Tables) > 0 || len(opts.Schemas) > 0):
+		return fmt.Errorf("publication %q can't contain all tables and specific tables or schemas", name)
+	case !opts.AllTables && len(opts.Tables) == 0 && len(opts.Schemas) == 0:
 		return fmt.Errorf("publication %q requires at least one table", name)
 	}
 
-	forTableString := fmt.Sprintf("FOR TABLE %s", strings.Join(opts.Tables, ", "))
+	publicationParams, err := renderPublicationParams(opts.PublicationParams)
+	if err != nil {
+		return fmt.Errorf("invalid params for publication %q: %w", name, err)
+	}
+
+	if len(opts.Schemas) > 0 {
+		if v := serverMajorVersion(conn); v < 15 {
+			return fmt.Errorf("publication %q can't contain schemas, Postgres %d does not support it, 15 or newer is required", name, v)
+		}
+	}
+
+	if len(opts.Tables) > 0 {
+		if err := ValidatePublicationTables(ctx, conn, opts.Tables); err != nil {
+			return fmt.Errorf("invalid tables for publication %q: %w", name, err)
+		}
+	}
+
+	if opts.IfNotExists {
+		exists, err := PublicationExists(ctx, conn, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if !opts.AddMissingTables {
+				return nil
+			}
+			return addMissingPublicationTables(ctx, conn, name, opts.Tables)
+		}
+	}
 
-	var publicationParams string
-	if len(opts.PublicationParams) > 0 {
-		publicationParams = fmt.Sprintf("WITH (%s)", strings.Join(opts.PublicationParams, ", "))
+	var forTableString string
+	if opts.AllTables {
+		forTableString = "FOR ALL TABLES"
+	} else {
+		var objects []string
+		if len(opts.Tables) > 0 {
+			objects = append(objects, "TABLE "+strings.Join(opts.Tables, ", "))
+		}
+		if len(opts.Schemas) > 0 {
+			schemas := make([]string, len(opts.Schemas))
+			for i, schema := range opts.Schemas {
+				schemas[i] = fmt.Sprintf("%q", schema)
+			}
+			objects = append(objects, "TABLES IN SCHEMA "+strings.Join(schemas, ", "))
+		}
+		forTableString = "FOR " + strings.Join(objects, ", ")
 	}
 
 	sql := fmt.Sprintf("CREATE PUBLICATION %q %s %s", name, forTableString, publicationParams)
@@ -49,6 +122,121 @@ func CreatePublication(ctx context.Context, conn *pgconn.PgConn, name string, op
 	return mrr.Close()
 }
 
+// renderPublicationParams renders the WITH clause containing the params. Params
+// are trimmed and empty params are dropped, the clause is empty if no params
+// are left. A param consisting only of whitespace is an error, it most likely
+// is the result of a mistake in the configuration.
+func renderPublicationParams(params []string) (string, error) {
+	var trimmed []string
+	for i, p := range params {
+		if p == "" {
+			continue
+		}
+		p = strings.TrimSpace(p)
+		if p == "" {
+			return "", fmt.Errorf("param %d only contains whitespace", i)
+		}
+		trimmed = append(trimmed, p)
+	}
+	if len(trimmed) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("WITH (%s)", strings.Join(trimmed, ", ")), nil
+}
+
+// serverMajorVersion returns the major version of the Postgres server the
+// connection is connected to, as reported when the connection was
+// established. It returns 0 if the version is unknown.
+func serverMajorVersion(conn *pgconn.PgConn) int {
+	// server_version looks like "15.4" or "16beta1 (Debian 16~beta1-2)"
+	version := conn.ParameterStatus("server_version")
+	end := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(version)
+	}
+	major, err := strconv.Atoi(version[:end])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// PublicationExists checks if a publication with the name exists. The
+// connection can be a regular or a replication connection.
+func PublicationExists(ctx context.Context, conn *pgconn.PgConn, name string) (bool, error) {
+	results, err := conn.Exec(
+		ctx,
+		"SELECT 1 FROM pg_publication WHERE pubname = "+quoteLiteral(name),
+	).ReadAll()
+	if err != nil {
+		return false, fmt.Errorf("failed to look up publication %q: %w", name, err)
+	}
+	return len(results[0].Rows) > 0, nil
+}
+
+// addMissingPublicationTables adds the tables which are not part of the
+// publication yet to it.
+func addMissingPublicationTables(ctx context.Context, conn *pgconn.PgConn, name string, tables []string) error {
+	var missing []string
+	for _, table := range tables {
+		results, err := conn.Exec(
+			ctx,
+			`SELECT 1 FROM pg_publication_rel pr
+			JOIN pg_publication p ON p.oid = pr.prpubid
+			WHERE p.pubname = `+quoteLiteral(name)+` AND pr.prrelid = to_regclass(`+quoteLiteral(table)+`)`,
+		).ReadAll()
+		if err != nil {
+			return fmt.Errorf("failed to look up table %q in publication %q: %w", table, name, err)
+		}
+		if len(results[0].Rows) == 0 {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sql := fmt.Sprintf("ALTER PUBLICATION %q ADD TABLE %s", name, strings.Join(missing, ", "))
+	if err := conn.Exec(ctx, sql).Close(); err != nil {
+		return fmt.Errorf("failed to add tables to publication %q: %w", name, err)
+	}
+	return nil
+}
+
+// ValidatePublicationTables checks that all tables exist and are regular or
+// partitioned tables, which are the only relations that can be part of a
+// publication. The returned error lists all invalid tables. The connection can
+// be a regular or a replication connection.
+func ValidatePublicationTables(ctx context.Context, conn *pgconn.PgConn, tables []string) error {
+	var errs []error
+	for _, table := range tables {
+		results, err := conn.Exec(
+			ctx,
+			"SELECT relkind FROM pg_class WHERE oid = to_regclass("+quoteLiteral(table)+")",
+		).ReadAll()
+		if err != nil {
+			return fmt.Errorf("failed to look up table %q: %w", table, err)
+		}
+		res := results[0]
+
+		if len(res.Rows) == 0 {
+			errs = append(errs, fmt.Errorf("table %q does not exist", table))
+			continue
+		}
+
+		switch relkind := string(res.Rows[0][0]); relkind {
+		case "r", "p": // regular or partitioned table
+		default:
+			kind, ok := relkindNames[relkind]
+			if !ok {
+				kind = fmt.Sprintf("a relation of kind %q", relkind)
+			}
+			errs = append(errs, fmt.Errorf("%q is %s, only tables can be published", table, kind))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // DropPublicationOptions contains additional options for dropping a publication.
 type DropPublicationOptions struct {
 	IfExists bool
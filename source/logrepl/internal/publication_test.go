@@ -17,10 +17,12 @@ package internal
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/jackc/pgx/v5"
 	"github.com/matryer/is"
 )
 
@@ -33,6 +35,7 @@ func TestCreatePublication(t *testing.T) {
 		nil,
 		{"publish = 'insert'"},
 		{"publish = 'insert,update,delete'"},
+		{"", " publish = 'insert' ", ""},
 	}
 
 	tables := []string{
@@ -68,6 +71,91 @@ func TestCreatePublication(t *testing.T) {
 		err := CreatePublication(ctx, nil, "testpub", CreatePublicationOptions{})
 		is.Equal(err.Error(), `publication "testpub" requires at least one table`)
 	})
+
+	t.Run("fails with all tables and schemas", func(t *testing.T) {
+		is := is.New(t)
+
+		err := CreatePublication(ctx, nil, "testpub", CreatePublicationOptions{
+			AllTables: true,
+			Schemas:   []string{"public"},
+		})
+		is.Equal(err.Error(), `publication "testpub" can't contain all tables and specific tables or schemas`)
+	})
+}
+
+func Test_renderPublicationParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []string
+		want    string
+		wantErr string
+	}{
+		{name: "nil", params: nil, want: ""},
+		{name: "only empty", params: []string{"", ""}, want: ""},
+		{
+			name:   "trims and drops empty",
+			params: []string{"", "  publish = 'insert'\t", "", "publish_via_partition_root = true"},
+			want:   "WITH (publish = 'insert', publish_via_partition_root = true)",
+		},
+		{
+			name:    "whitespace",
+			params:  []string{"publish = 'insert'", " \t"},
+			wantErr: "param 1 only contains whitespace",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			got, err := renderPublicationParams(tc.params)
+			if tc.wantErr != "" {
+				is.Equal(err.Error(), tc.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestCreatePublicationForSchemas(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	pub := test.RandomIdentifier(t)
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+
+	table := test.SetupTestTable(ctx, t, conn)
+	opts := CreatePublicationOptions{
+		Tables:  []string{table},
+		Schemas: []string{"public"},
+	}
+
+	if v := serverMajorVersion(conn.PgConn()); v < 15 {
+		err := CreatePublication(ctx, conn.PgConn(), pub, opts)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "15 or newer is required"))
+		t.Skipf("Postgres %d does not support publishing schemas", v)
+	}
+
+	schema := test.RandomIdentifier(t)
+	_, err := conn.Exec(ctx, fmt.Sprintf("CREATE SCHEMA %q; CREATE TABLE %q.schema_table (id bigint PRIMARY KEY)", schema, schema))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA %q CASCADE", schema))
+		is.NoErr(err)
+	})
+
+	opts.Schemas = []string{schema}
+	is.NoErr(CreatePublication(ctx, conn.PgConn(), pub, opts))
+	t.Cleanup(func() {
+		is.NoErr(DropPublication(ctx, conn.PgConn(), pub, DropPublicationOptions{IfExists: true}))
+	})
+
+	// the table in the schema is published together with the listed table
+	want := []string{table, "schema_table"}
+	slices.Sort(want)
+	is.Equal(publicationTables(ctx, t, conn, pub), want)
 }
 
 func TestCreatePublicationForTables(t *testing.T) {
@@ -99,6 +187,84 @@ func TestCreatePublicationForTables(t *testing.T) {
 	}
 }
 
+func TestCreatePublicationIfNotExists(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	pub := test.RandomIdentifier(t)
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+
+	table1 := test.SetupTestTable(ctx, t, conn)
+	table2 := test.SetupTestTable(ctx, t, conn)
+
+	is.NoErr(CreatePublication(ctx, conn.PgConn(), pub, CreatePublicationOptions{Tables: []string{table1}}))
+	t.Cleanup(func() {
+		is.NoErr(DropPublication(ctx, conn.PgConn(), pub, DropPublicationOptions{IfExists: true}))
+	})
+
+	// creating the publication again fails without IfNotExists
+	err := CreatePublication(ctx, conn.PgConn(), pub, CreatePublicationOptions{Tables: []string{table1}})
+	is.True(IsPgDuplicateErr(err))
+
+	is.NoErr(CreatePublication(ctx, conn.PgConn(), pub, CreatePublicationOptions{
+		Tables:      []string{table1, table2},
+		IfNotExists: true,
+	}))
+	is.Equal(publicationTables(ctx, t, conn, pub), []string{table1})
+
+	is.NoErr(CreatePublication(ctx, conn.PgConn(), pub, CreatePublicationOptions{
+		Tables:           []string{table1, table2},
+		IfNotExists:      true,
+		AddMissingTables: true,
+	}))
+	want := []string{table1, table2}
+	slices.Sort(want)
+	is.Equal(publicationTables(ctx, t, conn, pub), want)
+}
+
+// publicationTables returns the sorted names of the tables in the publication.
+func publicationTables(ctx context.Context, t *testing.T, conn *pgx.Conn, pub string) []string {
+	is := is.New(t)
+	rows, err := conn.Query(ctx, "SELECT tablename FROM pg_publication_tables WHERE pubname = $1 ORDER BY tablename", pub)
+	is.NoErr(err)
+	tables, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	is.NoErr(err)
+	return tables
+}
+
+func TestValidatePublicationTables(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+
+	table := test.SetupTestTable(ctx, t, conn)
+	view := test.RandomIdentifier(t) + "_view"
+	_, err := conn.Exec(ctx, fmt.Sprintf("CREATE VIEW %s AS SELECT * FROM %s", view, table))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP VIEW "+view)
+		is.NoErr(err)
+	})
+
+	is.NoErr(ValidatePublicationTables(ctx, conn.PgConn(), []string{table}))
+
+	err = ValidatePublicationTables(ctx, conn.PgConn(), []string{table, view, "missing_table"})
+	is.Equal(err.Error(), fmt.Sprintf(
+		"%q is a view, only tables can be published\n"+
+			"table \"missing_table\" does not exist",
+		view,
+	))
+
+	// replication connections only support the simple query protocol
+	replConn := test.ConnectReplication(ctx, t, test.RepmgrConnString)
+	is.NoErr(ValidatePublicationTables(ctx, replConn, []string{table}))
+
+	err = CreatePublication(ctx, conn.PgConn(), test.RandomIdentifier(t), CreatePublicationOptions{
+		Tables: []string{table, view},
+	})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "is a view"))
+}
+
 func TestDropPublication(t *testing.T) {
 	ctx := context.Background()
 	is := is.New(t)
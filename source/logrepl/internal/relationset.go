@@ -23,25 +23,56 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// UnsupportedTypePolicy determines how values of types without a known codec
+// are decoded.
+type UnsupportedTypePolicy string
+
+const (
+	// UnsupportedTypeFail fails to decode the tuple.
+	UnsupportedTypeFail UnsupportedTypePolicy = "fail"
+	// UnsupportedTypeRaw decodes the value as the raw string sent by Postgres.
+	UnsupportedTypeRaw UnsupportedTypePolicy = "raw"
+	// UnsupportedTypeSkip leaves the column out of the decoded values.
+	UnsupportedTypeSkip UnsupportedTypePolicy = "skip"
+)
+
 // RelationSet can be used to build a cache of relations returned by logical
 // replication.
 type RelationSet struct {
+	// UnsupportedTypePolicy is applied to columns with types without a known
+	// codec. Defaults to UnsupportedTypeRaw.
+	UnsupportedTypePolicy UnsupportedTypePolicy
+
 	relations map[uint32]*pglogrepl.RelationMessage
 	connInfo  *pgtype.Map
 }
 
 // NewRelationSet creates a new relation set.
 func NewRelationSet() *RelationSet {
+	connInfo := pgtype.NewMap()
+	types.RegisterTypes(connInfo)
+
 	return &RelationSet{
 		relations: map[uint32]*pglogrepl.RelationMessage{},
-		connInfo:  pgtype.NewMap(),
+		connInfo:  connInfo,
 	}
 }
 
+// TypeMap returns the map used to decode values, additional types can be
+// registered in it.
+func (rs *RelationSet) TypeMap() *pgtype.Map {
+	return rs.connInfo
+}
+
 func (rs *RelationSet) Add(r *pglogrepl.RelationMessage) {
 	rs.relations[r.RelationID] = r
 }
 
+// Remove removes the relation from the set.
+func (rs *RelationSet) Remove(id uint32) {
+	delete(rs.relations, id)
+}
+
 func (rs *RelationSet) Get(id uint32) (*pglogrepl.RelationMessage, error) {
 	msg, ok := rs.relations[id]
 	if !ok {
@@ -60,32 +91,220 @@ func (rs *RelationSet) Values(id uint32, row *pglogrepl.TupleData) (map[string]a
 		return nil, fmt.Errorf("no relation for %d", id)
 	}
 
-	values := map[string]any{}
+	if err := checkColumnCount(rel, row); err != nil {
+		return nil, err
+	}
 
-	// assert same number of row and rel columns
+	values := make(map[string]any, len(row.Columns))
 	for i, tuple := range row.Columns {
 		col := rel.Columns[i]
-		decoder := rs.oidToCodec(col.DataType)
-		val, err := decoder.DecodeValue(rs.connInfo, col.DataType, pgtype.TextFormatCode, tuple.Data)
+		v, ok, err := rs.decodeColumn(i, col, tuple)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode tuple %d: %w", i, err)
+			return nil, err
+		}
+		if ok {
+			values[col.Name] = v
 		}
+	}
+
+	return values, nil
+}
 
-		v, err := types.Format(val)
+// KeyValue decodes the value of the column for use in a record key, see
+// types.FormatKey. The second return value is false if the row does not
+// contain the column or the column is skipped.
+func (rs *RelationSet) KeyValue(id uint32, row *pglogrepl.TupleData, column string) (any, bool, error) {
+	if row == nil {
+		return nil, false, errors.New("no tuple data")
+	}
+
+	rel, err := rs.Get(id)
+	if err != nil {
+		return nil, false, fmt.Errorf("no relation for %d", id)
+	}
+	if err := checkColumnCount(rel, row); err != nil {
+		return nil, false, err
+	}
+
+	for i, tuple := range row.Columns {
+		col := rel.Columns[i]
+		if col.Name != column {
+			continue
+		}
+
+		decoder, ok, err := rs.columnCodec(col)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		val, err := rs.decodeValue(decoder, col.DataType, tuple.Data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to format column %q type %T: %w", col.Name, val, err)
+			return nil, false, decodeError(i, col, tuple, err)
 		}
+		v, err := types.FormatKey(val)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to format key column %q type %T: %w", col.Name, val, err)
+		}
+		return v, true, nil
+	}
+
+	return nil, false, nil
+}
 
-		values[col.Name] = v
+// PartialValues decodes the values like Values, but instead of failing, columns
+// which can't be decoded and unchanged TOASTed values are left out. The names
+// of the left out columns are returned together with the values.
+func (rs *RelationSet) PartialValues(id uint32, row *pglogrepl.TupleData) (map[string]any, []string, error) {
+	if row == nil {
+		return nil, nil, errors.New("no tuple data")
 	}
 
-	return values, nil
+	rel, err := rs.Get(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no relation for %d", id)
+	}
+	if err := checkColumnCount(rel, row); err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]any, len(row.Columns))
+	var missing []string
+
+	for i, tuple := range row.Columns {
+		col := rel.Columns[i]
+		if tuple.DataType == pglogrepl.TupleDataTypeToast {
+			missing = append(missing, col.Name)
+			continue
+		}
+		v, ok, err := rs.decodeColumn(i, col, tuple)
+		if err != nil {
+			missing = append(missing, col.Name)
+			continue
+		}
+		if ok {
+			values[col.Name] = v
+		}
+	}
+
+	return values, missing, nil
 }
 
-func (rs *RelationSet) oidToCodec(id uint32) pgtype.Codec {
-	dt, ok := rs.connInfo.TypeForOID(id)
+// decodeColumn decodes and formats the value of a single column. The second
+// return value is false if the column should be left out of the values.
+func (rs *RelationSet) decodeColumn(i int, col *pglogrepl.RelationMessageColumn, tuple *pglogrepl.TupleDataColumn) (any, bool, error) {
+	decoder, ok, err := rs.columnCodec(col)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	val, err := rs.decodeValue(decoder, col.DataType, tuple.Data)
+	if err != nil {
+		return nil, false, decodeError(i, col, tuple, err)
+	}
+
+	v, err := types.Format(val)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to format column %q type %T: %w", col.Name, val, err)
+	}
+	return v, true, nil
+}
+
+// columnCodec returns the codec for the type of the column and applies
+// UnsupportedTypePolicy to types without a known codec. The second return
+// value is false if the column should be left out.
+func (rs *RelationSet) columnCodec(col *pglogrepl.RelationMessageColumn) (pgtype.Codec, bool, error) {
+	decoder, ok := rs.oidToCodec(col.DataType)
+	if !ok {
+		switch rs.UnsupportedTypePolicy {
+		case UnsupportedTypeFail:
+			if isAnonymousRecord(col.DataType) {
+				return nil, false, fmt.Errorf("column %q has anonymous record type with OID %d, its fields have no known layout", col.Name, col.DataType)
+			}
+			return nil, false, fmt.Errorf("column %q has unsupported type with OID %d", col.Name, col.DataType)
+		case UnsupportedTypeSkip:
+			return nil, false, nil
+		}
+	}
+	return decoder, true, nil
+}
+
+// checkColumnCount returns an error if the tuple has more columns than the
+// relation, e.g. because the relation is outdated.
+func checkColumnCount(rel *pglogrepl.RelationMessage, row *pglogrepl.TupleData) error {
+	if len(row.Columns) > len(rel.Columns) {
+		return fmt.Errorf(
+			"tuple has %d columns, relation %q only has %d",
+			len(row.Columns), rel.RelationName, len(rel.Columns),
+		)
+	}
+	return nil
+}
+
+// decodeError wraps an error returned while decoding the column with details
+// about the column and the raw value. The value itself is left out, it could
+// contain sensitive data.
+func decodeError(i int, col *pglogrepl.RelationMessageColumn, tuple *pglogrepl.TupleDataColumn, err error) error {
+	return fmt.Errorf(
+		"failed to decode column %q (index %d, type OID %d, %d bytes): %w",
+		col.Name, i, col.DataType, len(tuple.Data), err,
+	)
+}
+
+// decodeValue decodes the value in text format. Arrays are decoded including
+// their dimensions, so that multidimensional arrays keep their shape.
+func (rs *RelationSet) decodeValue(codec pgtype.Codec, oid uint32, src []byte) (any, error) {
+	if oid == pgtype.BoolOID && len(src) == 1 {
+		// Postgres sends booleans as "t" or "f", decoding them directly saves
+		// an allocation per column in the codec
+		switch src[0] {
+		case 't':
+			return true, nil
+		case 'f':
+			return false, nil
+		}
+	}
+	if _, ok := codec.(*pgtype.ArrayCodec); !ok || src == nil {
+		return codec.DecodeValue(rs.connInfo, oid, pgtype.TextFormatCode, src)
+	}
+
+	var arr pgtype.Array[any]
+	if err := rs.connInfo.PlanScan(oid, pgtype.TextFormatCode, &arr).Scan(src, &arr); err != nil {
+		return nil, err
+	}
+	return arr, nil
+}
+
+// UnsupportedColumns returns the names of columns in the relation which have a
+// type without a known codec.
+func (rs *RelationSet) UnsupportedColumns(id uint32) []string {
+	rel, ok := rs.relations[id]
 	if !ok {
-		return rs.oidToCodec(pgtype.UnknownOID)
+		return nil
+	}
+
+	var cols []string
+	for _, col := range rel.Columns {
+		if _, ok := rs.oidToCodec(col.DataType); !ok {
+			cols = append(cols, col.Name)
+		}
+	}
+	return cols
+}
+
+// oidToCodec returns the codec for the type. If the type is unknown, the codec
+// for decoding raw strings is returned and the second return value is false.
+// Anonymous records are treated as unknown, the text format does not contain
+// the types of their fields.
+func (rs *RelationSet) oidToCodec(id uint32) (pgtype.Codec, bool) {
+	dt, ok := rs.connInfo.TypeForOID(id)
+	if !ok || isAnonymousRecord(id) {
+		codec, _ := rs.oidToCodec(pgtype.UnknownOID)
+		return codec, false
 	}
-	return dt.Codec
+	return dt.Codec, true
+}
+
+// isAnonymousRecord returns true for the pseudo-type record and arrays of it,
+// which don't have a layout in the catalog.
+func isAnonymousRecord(id uint32) bool {
+	return id == pgtype.RecordOID || id == pgtype.RecordArrayOID
 }
@@ -17,9 +17,11 @@ package internal
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/big"
 	"net"
 	"net/netip"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,6 +42,319 @@ func TestRelationSetUnregisteredType(t *testing.T) {
 	is.Equal(got, nil)
 }
 
+func TestRelationSetUnsupportedType(t *testing.T) {
+	const unknownOID = 999999
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		RelationName: "table",
+		ColumnNum:    2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+			{Name: "custom", DataType: unknownOID},
+		},
+	}
+	row := &pglogrepl.TupleData{
+		ColumnNum: 2,
+		Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Length: 1, Data: []byte("1")},
+			{DataType: pglogrepl.TupleDataTypeText, Length: 3, Data: []byte("foo")},
+		},
+	}
+
+	tests := []struct {
+		policy  UnsupportedTypePolicy
+		want    map[string]any
+		wantKey any
+		wantErr string
+	}{
+		{
+			policy:  "", // defaults to raw
+			want:    map[string]any{"id": int64(1), "custom": "foo"},
+			wantKey: "foo",
+		},
+		{
+			policy:  UnsupportedTypeRaw,
+			want:    map[string]any{"id": int64(1), "custom": "foo"},
+			wantKey: "foo",
+		},
+		{
+			policy: UnsupportedTypeSkip,
+			want:   map[string]any{"id": int64(1)},
+		},
+		{
+			policy:  UnsupportedTypeFail,
+			wantErr: `column "custom" has unsupported type with OID 999999`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			is := is.New(t)
+
+			rs := NewRelationSet()
+			rs.UnsupportedTypePolicy = tc.policy
+			rs.Add(rel)
+
+			is.Equal(rs.UnsupportedColumns(rel.RelationID), []string{"custom"})
+
+			// the policy applies to key columns as well
+			key, ok, keyErr := rs.KeyValue(rel.RelationID, row, "custom")
+
+			values, err := rs.Values(rel.RelationID, row)
+			if tc.wantErr != "" {
+				is.Equal(err.Error(), tc.wantErr)
+				is.Equal(keyErr.Error(), tc.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(values, tc.want)
+			is.NoErr(keyErr)
+			is.Equal(ok, tc.wantKey != nil)
+			is.Equal(key, tc.wantKey)
+		})
+	}
+}
+
+func TestRelationSetAnonymousRecord(t *testing.T) {
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		RelationName: "table",
+		ColumnNum:    2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+			{Name: "rec", DataType: pgtype.RecordOID},
+		},
+	}
+	row := &pglogrepl.TupleData{
+		ColumnNum: 2,
+		Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Length: 1, Data: []byte("1")},
+			{DataType: pglogrepl.TupleDataTypeText, Length: 7, Data: []byte("(1,foo)")},
+		},
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		is := is.New(t)
+
+		rs := NewRelationSet()
+		rs.UnsupportedTypePolicy = UnsupportedTypeFail
+		rs.Add(rel)
+
+		is.Equal(rs.UnsupportedColumns(rel.RelationID), []string{"rec"})
+		_, err := rs.Values(rel.RelationID, row)
+		is.Equal(err.Error(), `column "rec" has anonymous record type with OID 2249, its fields have no known layout`)
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		is := is.New(t)
+
+		rs := NewRelationSet()
+		rs.Add(rel)
+
+		values, err := rs.Values(rel.RelationID, row)
+		is.NoErr(err)
+		is.Equal(values, map[string]any{"id": int64(1), "rec": "(1,foo)"})
+	})
+}
+
+func TestRelationSetColumnCountMismatch(t *testing.T) {
+	is := is.New(t)
+
+	rs := NewRelationSet()
+	rs.Add(&pglogrepl.RelationMessage{
+		RelationID:   1,
+		RelationName: "table",
+		ColumnNum:    1,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+		},
+	})
+	row := &pglogrepl.TupleData{
+		ColumnNum: 2,
+		Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Length: 1, Data: []byte("1")},
+			{DataType: pglogrepl.TupleDataTypeText, Length: 3, Data: []byte("foo")},
+		},
+	}
+
+	_, err := rs.Values(1, row)
+	is.Equal(err.Error(), `tuple has 2 columns, relation "table" only has 1`)
+	_, _, err = rs.PartialValues(1, row)
+	is.Equal(err.Error(), `tuple has 2 columns, relation "table" only has 1`)
+	_, _, err = rs.KeyValue(1, row, "id")
+	is.Equal(err.Error(), `tuple has 2 columns, relation "table" only has 1`)
+}
+
+func TestRelationSetArrays(t *testing.T) {
+	is := is.New(t)
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		RelationName: "table",
+		ColumnNum:    4,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "col_bool_array", DataType: pgtype.BoolArrayOID},
+			{Name: "col_numeric_array", DataType: pgtype.NumericArrayOID},
+			{Name: "col_empty_array", DataType: pgtype.Int4ArrayOID},
+			{Name: "col_null_array", DataType: pgtype.Int4ArrayOID},
+		},
+	}
+	values := []string{"{t,f,NULL}", "{{1.5,2},{3,4}}", "{}"}
+	row := &pglogrepl.TupleData{ColumnNum: 4}
+	for _, v := range values {
+		row.Columns = append(row.Columns, &pglogrepl.TupleDataColumn{
+			DataType: pglogrepl.TupleDataTypeText,
+			Length:   uint32(len(v)),
+			Data:     []byte(v),
+		})
+	}
+	row.Columns = append(row.Columns, &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull})
+
+	rs := NewRelationSet()
+	rs.Add(rel)
+
+	got, err := rs.Values(rel.RelationID, row)
+	is.NoErr(err)
+
+	want := map[string]any{
+		"col_bool_array": []any{true, false, nil},
+		"col_numeric_array": []any{
+			[]any{float64(1.5), int64(2)},
+			[]any{int64(3), int64(4)},
+		},
+		"col_empty_array": []any{},
+		"col_null_array":  nil,
+	}
+	is.Equal("", cmp.Diff(want, got))
+}
+
+func TestRelationSetIntegers(t *testing.T) {
+	tests := []struct {
+		desc string
+		oid  uint32
+		val  string
+		want any
+	}{
+		{desc: "int2 min", oid: pgtype.Int2OID, val: "-32768", want: int16(math.MinInt16)},
+		{desc: "int2 max", oid: pgtype.Int2OID, val: "32767", want: int16(math.MaxInt16)},
+		{desc: "int4 min", oid: pgtype.Int4OID, val: "-2147483648", want: int32(math.MinInt32)},
+		{desc: "int4 max", oid: pgtype.Int4OID, val: "2147483647", want: int32(math.MaxInt32)},
+		{desc: "int8 min", oid: pgtype.Int8OID, val: "-9223372036854775808", want: int64(math.MinInt64)},
+		{desc: "int8 max", oid: pgtype.Int8OID, val: "9223372036854775807", want: int64(math.MaxInt64)},
+		{desc: "int2 array", oid: pgtype.Int2ArrayOID, val: "{-32768,32767}", want: []any{int16(math.MinInt16), int16(math.MaxInt16)}},
+		{desc: "int4 array", oid: pgtype.Int4ArrayOID, val: "{-2147483648,2147483647}", want: []any{int32(math.MinInt32), int32(math.MaxInt32)}},
+		{desc: "int8 array", oid: pgtype.Int8ArrayOID, val: "{-9223372036854775808,9223372036854775807}", want: []any{int64(math.MinInt64), int64(math.MaxInt64)}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			is := is.New(t)
+
+			rs := NewRelationSet()
+			rs.Add(&pglogrepl.RelationMessage{
+				RelationID:   1,
+				RelationName: "table",
+				ColumnNum:    1,
+				Columns: []*pglogrepl.RelationMessageColumn{
+					{Name: "col", DataType: tc.oid},
+				},
+			})
+
+			got, err := rs.Values(1, &pglogrepl.TupleData{
+				ColumnNum: 1,
+				Columns: []*pglogrepl.TupleDataColumn{
+					{DataType: pglogrepl.TupleDataTypeText, Length: uint32(len(tc.val)), Data: []byte(tc.val)},
+				},
+			})
+			is.NoErr(err)
+			is.Equal("", cmp.Diff(tc.want, got["col"]))
+		})
+	}
+}
+
+func TestRelationSetBooleans(t *testing.T) {
+	tests := []struct {
+		desc string
+		oid  uint32
+		col  *pglogrepl.TupleDataColumn
+		want any
+	}{
+		{
+			desc: "true",
+			oid:  pgtype.BoolOID,
+			col:  &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Length: 1, Data: []byte("t")},
+			want: true,
+		},
+		{
+			desc: "false",
+			oid:  pgtype.BoolOID,
+			col:  &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Length: 1, Data: []byte("f")},
+			want: false,
+		},
+		{
+			desc: "null",
+			oid:  pgtype.BoolOID,
+			col:  &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull},
+			want: nil,
+		},
+		{
+			desc: "array",
+			oid:  pgtype.BoolArrayOID,
+			col:  &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Length: 10, Data: []byte("{t,f,NULL}")},
+			want: []any{true, false, nil},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			is := is.New(t)
+
+			rs := NewRelationSet()
+			rs.Add(&pglogrepl.RelationMessage{
+				RelationID:   1,
+				RelationName: "table",
+				ColumnNum:    1,
+				Columns: []*pglogrepl.RelationMessageColumn{
+					{Name: "col", DataType: tc.oid},
+				},
+			})
+
+			got, err := rs.Values(1, &pglogrepl.TupleData{
+				ColumnNum: 1,
+				Columns:   []*pglogrepl.TupleDataColumn{tc.col},
+			})
+			is.NoErr(err)
+			is.Equal("", cmp.Diff(tc.want, got["col"]))
+		})
+	}
+}
+
+func TestRelationSetDecodeError(t *testing.T) {
+	is := is.New(t)
+
+	rs := NewRelationSet()
+	rs.Add(&pglogrepl.RelationMessage{
+		RelationID:   1,
+		RelationName: "table",
+		ColumnNum:    2,
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+			{Name: "amount", DataType: pgtype.Int4OID},
+		},
+	})
+
+	_, err := rs.Values(1, &pglogrepl.TupleData{
+		ColumnNum: 2,
+		Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Length: 1, Data: []byte("1")},
+			{DataType: pglogrepl.TupleDataTypeText, Length: 3, Data: []byte("foo")},
+		},
+	})
+	is.True(err != nil)
+	is.True(strings.HasPrefix(err.Error(), `failed to decode column "amount" (index 1, type OID 23, 3 bytes): `))
+}
+
 func TestRelationSetAllTypes(t *testing.T) {
 	// need to reset local timezone in test to ensure it runs the same way on
 	// any machine (CI or local)
@@ -115,12 +430,15 @@ func setupTableAllTypes(ctx context.Context, t *testing.T, conn test.Querier) st
 		  col_interval      interval,
 		  col_json          json,
 		  col_jsonb         jsonb,
+		  col_jsonpath      jsonpath,
 		  col_line          line,
 		  col_lseg          lseg,
 		  col_macaddr       macaddr,
 		  col_macaddr8      macaddr8,
 		  col_money         money,
+		  col_name          name,
 		  col_numeric       numeric(8,2),
+		  col_oidvector     oidvector,
 		  col_path          path,
 		  col_pg_lsn        pg_lsn,
 		  col_pg_snapshot   pg_snapshot,
@@ -134,10 +452,14 @@ func setupTableAllTypes(ctx context.Context, t *testing.T, conn test.Querier) st
 		  col_timetz        timetz,
 		  col_timestamp     timestamp,
 		  col_timestamptz   timestamptz,
+		  col_tstzrange     tstzrange,
 		  col_tsquery       tsquery,
 		  col_tsvector      tsvector,
+		  col_txid_snapshot txid_snapshot,
 		  col_uuid          uuid,
-		  col_xml           xml
+		  col_xml           xml,
+		  col_xid           xid,
+		  col_xid8          xid8
 		)`
 	query = fmt.Sprintf(query, table)
 	_, err := conn.Exec(ctx, query)
@@ -175,12 +497,15 @@ func insertRowAllTypes(ctx context.Context, t *testing.T, conn test.Querier, tab
 		  col_interval,
 		  col_json,
 		  col_jsonb,
+		  col_jsonpath,
 		  col_line,
 		  col_lseg,
 		  col_macaddr,
 		  col_macaddr8,
 		  col_money,
+		  col_name,
 		  col_numeric,
+		  col_oidvector,
 		  col_path,
 		  col_pg_lsn,
 		  col_pg_snapshot,
@@ -194,10 +519,14 @@ func insertRowAllTypes(ctx context.Context, t *testing.T, conn test.Querier, tab
 		  col_timetz,
 		  col_timestamp,
 		  col_timestamptz,
+		  col_tstzrange,
 		  col_tsquery,
 		  col_tsvector,
+		  col_txid_snapshot,
 		  col_uuid,
-		  col_xml
+		  col_xml,
+		  col_xid,
+		  col_xid8
 		) VALUES (
 		  B'00000001',                                -- col_bit
 		  B'00000010',                                -- col_varbit
@@ -218,12 +547,15 @@ func insertRowAllTypes(ctx context.Context, t *testing.T, conn test.Querier, tab
 		  '18 seconds',                               -- col_interval
 		  '{"foo":"bar"}',                            -- col_json
 		  '{"foo":"baz"}',                            -- col_jsonb
+		  '$.foo[*] ? (@ > 1)',                       -- col_jsonpath
 		  '{19,20,21}',                               -- col_line
 		  '((22,23),(24,25))',                        -- col_lseg
 		  '08:00:2b:01:02:26',                        -- col_macaddr
 		  '08:00:2b:01:02:03:04:27',                  -- col_macaddr8
 		  '$28',                                      -- col_money
+		  'pg_class',                                 -- col_name
 		  '292929.29',                                -- col_numeric
+		  '23 25',                                    -- col_oidvector
 		  '[(30,31),(32,33),(34,35)]',                -- col_path
 		  '36/37',                                    -- col_pg_lsn
 		  '10:20:10,14,15',                           -- col_pg_snapshot
@@ -237,10 +569,14 @@ func insertRowAllTypes(ctx context.Context, t *testing.T, conn test.Querier, tab
 		  '04:05:06.789-08',                          -- col_timetz
 		  '2022-03-14 15:16:17',                      -- col_timestamp
 		  '2022-03-14 15:16:17-08',                   -- col_timestamptz
+		  '[2022-03-14 15:16:17-08,2022-03-15 01:00:00+02)', -- col_tstzrange
 		  'fat & (rat | cat)',                        -- col_tsquery
 		  'a fat cat sat on a mat and ate a fat rat', -- col_tsvector
+		  '100:104:100,102',                          -- col_txid_snapshot
 		  'bd94ee0b-564f-4088-bf4e-8d5e626caf66',     -- col_uuid
-		  '<foo>bar</foo>'                            -- col_xml
+		  '<foo>bar</foo>',                           -- col_xml
+		  '46',                                       -- col_xid
+		  '47'                                        -- col_xid8
 		)`
 	query = fmt.Sprintf(query, table)
 	_, err := conn.Exec(ctx, query)
@@ -260,78 +596,63 @@ func isValuesAllTypes(is *is.I, got map[string]any) {
 			Valid: true,
 		},
 		"col_boolean": true,
-		"col_box": pgtype.Box{
-			P:     [2]pgtype.Vec2{{X: 5, Y: 6}, {X: 3, Y: 4}},
-			Valid: true,
-		},
+		"col_box":     "(5,6),(3,4)",
 		"col_bytea":   []byte{0x07},
 		"col_char":    "8  ", // blank padded char
 		"col_varchar": "9",
 		"col_cidr":    netip.MustParsePrefix("192.168.100.128/25"),
-		"col_circle": pgtype.Circle{
-			P:     pgtype.Vec2{X: 11, Y: 12},
-			R:     13,
-			Valid: true,
-		},
-		"col_date":   time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC).UTC().String(),
-		"col_float4": float32(15),
-		"col_float8": float64(16.16),
-		"col_inet":   netip.MustParsePrefix("192.168.0.17/32"),
-		"col_int2":   int16(32767),
-		"col_int4":   int32(2147483647),
-		"col_int8":   int64(9223372036854775807),
+		"col_circle":  "<(11,12),13>",
+		"col_date":    time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC).UTC().String(),
+		"col_float4":  float32(15),
+		"col_float8":  float64(16.16),
+		"col_inet":    netip.MustParsePrefix("192.168.0.17/32"),
+		"col_int2":    int16(32767),
+		"col_int4":    int32(2147483647),
+		"col_int8":    int64(9223372036854775807),
 		"col_interval": pgtype.Interval{
 			Microseconds: 18000000,
 			Days:         0,
 			Months:       0,
 			Valid:        true,
 		},
-		"col_json":  map[string]any{"foo": "bar"},
-		"col_jsonb": map[string]any{"foo": "baz"},
-		"col_line": pgtype.Line{
-			A:     19,
-			B:     20,
-			C:     21,
-			Valid: true,
-		},
-		"col_lseg": pgtype.Lseg{
-			P:     [2]pgtype.Vec2{{X: 22, Y: 23}, {X: 24, Y: 25}},
-			Valid: true,
-		},
-		"col_macaddr":  net.HardwareAddr{0x08, 0x00, 0x2b, 0x01, 0x02, 0x26},
-		"col_macaddr8": net.HardwareAddr{0x08, 0x00, 0x2b, 0x01, 0x02, 0x03, 0x04, 0x27},
-		"col_money":    "$28.00",
-		"col_numeric":  float64(292929.29),
-		"col_path": pgtype.Path{
-			P:      []pgtype.Vec2{{X: 30, Y: 31}, {X: 32, Y: 33}, {X: 34, Y: 35}},
-			Closed: false,
-			Valid:  true,
-		},
+		"col_json":        map[string]any{"foo": "bar"},
+		"col_jsonb":       map[string]any{"foo": "baz"},
+		"col_jsonpath":    `$."foo"[*]?(@ > 1)`,
+		"col_line":        "{19,20,21}",
+		"col_lseg":        "[(22,23),(24,25)]",
+		"col_macaddr":     net.HardwareAddr{0x08, 0x00, 0x2b, 0x01, 0x02, 0x26},
+		"col_macaddr8":    "08:00:2b:01:02:03:04:27",
+		"col_money":       "$28.00",
+		"col_numeric":     float64(292929.29),
+		"col_oidvector":   []uint32{23, 25},
+		"col_path":        "[(30,31),(32,33),(34,35)]",
 		"col_pg_lsn":      "36/37",
 		"col_pg_snapshot": "10:20:10,14,15",
-		"col_point": pgtype.Point{
-			P:     pgtype.Vec2{X: 38, Y: 39},
-			Valid: true,
-		},
-		"col_polygon": pgtype.Polygon{
-			P:     []pgtype.Vec2{{X: 40, Y: 41}, {X: 42, Y: 43}, {X: 44, Y: 45}},
-			Valid: true,
-		},
-		"col_serial2": int16(32767),
-		"col_serial4": int32(2147483647),
-		"col_serial8": int64(9223372036854775807),
-		"col_text":    "foo bar baz",
-		"col_time": pgtype.Time{
-			Microseconds: time.Date(1970, 1, 1, 4, 5, 6, 789000000, time.UTC).UnixMicro(),
-			Valid:        true,
-		},
-		"col_timetz":      "04:05:06.789-08",
+		"col_point":       "(38,39)",
+		"col_polygon":     "((40,41),(42,43),(44,45))",
+		"col_serial2":     int16(32767),
+		"col_serial4":     int32(2147483647),
+		"col_serial8":     int64(9223372036854775807),
+		"col_text":        "foo bar baz",
+		"col_time":        "04:05:06.789000",
+		"col_timetz":      "04:05:06.789-08:00",
 		"col_timestamp":   time.Date(2022, 3, 14, 15, 16, 17, 0, time.UTC).UTC().String(),
 		"col_timestamptz": time.Date(2022, 3, 14, 15+8, 16, 17, 0, time.UTC).UTC().String(),
 		"col_tsquery":     "'fat' & ( 'rat' | 'cat' )",
 		"col_tsvector":    "'a' 'and' 'ate' 'cat' 'fat' 'mat' 'on' 'rat' 'sat'",
 		"col_uuid":        [16]uint8{0xbd, 0x94, 0xee, 0x0b, 0x56, 0x4f, 0x40, 0x88, 0xbf, 0x4e, 0x8d, 0x5e, 0x62, 0x6c, 0xaf, 0x66},
 		"col_xml":         "<foo>bar</foo>",
+		"col_xid":         uint32(46),
+		"col_xid8":        uint64(47),
+		"col_tstzrange": pgtype.Range[any]{
+			Lower:     time.Date(2022, 3, 14, 15+8, 16, 17, 0, time.UTC).UTC().String(),
+			Upper:     time.Date(2022, 3, 14, 23, 0, 0, 0, time.UTC).UTC().String(),
+			LowerType: pgtype.Inclusive,
+			UpperType: pgtype.Exclusive,
+			Valid:     true,
+		},
+		"col_txid_snapshot": "100:104:100,102",
+		"col_name":          "pg_class",
 	}
 	is.Equal("", cmp.Diff(want, got,
 		cmp.Comparer(func(x, y *big.Int) bool {
@@ -342,3 +663,49 @@ func isValuesAllTypes(is *is.I, got map[string]any) {
 		}),
 	))
 }
+
+func BenchmarkRelationSetValues_WideTable(b *testing.B) {
+	const columns = 300
+
+	rel := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		RelationName: "wide",
+		ColumnNum:    columns,
+	}
+	row := &pglogrepl.TupleData{ColumnNum: columns}
+
+	// cycle through common types to get a realistic mix of decoders
+	types := []struct {
+		oid   uint32
+		value string
+	}{
+		{pgtype.Int8OID, "1234567"},
+		{pgtype.TextOID, "foo bar baz"},
+		{pgtype.BoolOID, "t"},
+		{pgtype.Float8OID, "12.25"},
+		{pgtype.TimestamptzOID, "2022-03-14 15:15:16.123456+01"},
+	}
+	for i := 0; i < columns; i++ {
+		typ := types[i%len(types)]
+		rel.Columns = append(rel.Columns, &pglogrepl.RelationMessageColumn{
+			Name:     fmt.Sprintf("column%d", i),
+			DataType: typ.oid,
+		})
+		row.Columns = append(row.Columns, &pglogrepl.TupleDataColumn{
+			DataType: pglogrepl.TupleDataTypeText,
+			Length:   uint32(len(typ.value)),
+			Data:     []byte(typ.value),
+		})
+	}
+
+	rs := NewRelationSet()
+	rs.Add(rel)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rs.Values(rel.RelationID, row); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
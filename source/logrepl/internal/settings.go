@@ -0,0 +1,113 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// requiredWALLevel is the WAL level required for logical replication.
+const requiredWALLevel = "logical"
+
+// CheckWALLevel returns an error if the server is not configured with the WAL
+// level required for logical replication.
+func CheckWALLevel(ctx context.Context, conn *pgconn.PgConn) error {
+	results, err := conn.Exec(ctx, "SHOW wal_level").ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to query wal_level: %w", err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) != 1 {
+		return fmt.Errorf("unexpected result when querying wal_level")
+	}
+
+	return checkWALLevel(string(results[0].Rows[0][0]))
+}
+
+func checkWALLevel(level string) error {
+	if level != requiredWALLevel {
+		return fmt.Errorf("wal_level must be %q, found %q (set wal_level = logical in postgresql.conf and restart the server)", requiredWALLevel, level)
+	}
+	return nil
+}
+
+// ErrMissingReplicationPrivilege is returned by CheckReplicationPrivilege if the
+// role is not allowed to use logical replication.
+var ErrMissingReplicationPrivilege = errors.New("missing REPLICATION privilege")
+
+// CheckReplicationPrivilege returns an error if the role of the connection is
+// not allowed to use logical replication, i.e. it is neither a superuser nor
+// has the REPLICATION attribute. On Amazon RDS, membership in the
+// rds_replication role is accepted as well.
+func CheckReplicationPrivilege(ctx context.Context, conn *pgconn.PgConn) error {
+	results, err := conn.Exec(ctx, `
+		SELECT current_user, rolsuper, rolreplication, EXISTS (
+			SELECT 1 FROM pg_roles r
+			WHERE r.rolname = 'rds_replication' AND pg_has_role(current_user, r.oid, 'member')
+		)
+		FROM pg_roles WHERE rolname = current_user`,
+	).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to query role attributes: %w", err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) != 4 {
+		return fmt.Errorf("unexpected result when querying role attributes")
+	}
+
+	row := results[0].Rows[0]
+	return checkReplicationPrivilege(string(row[0]), isTrue(row[1]), isTrue(row[2]), isTrue(row[3]))
+}
+
+func checkReplicationPrivilege(role string, superuser, replication, rdsReplication bool) error {
+	if !superuser && !replication && !rdsReplication {
+		return fmt.Errorf("%w: role %q is not allowed to use logical replication (grant it with ALTER ROLE %s WITH REPLICATION)", ErrMissingReplicationPrivilege, role, role)
+	}
+	return nil
+}
+
+// isTrue returns true if the value is a boolean true in text format.
+func isTrue(v []byte) bool {
+	return string(v) == "t"
+}
+
+// WALSenderTimeout returns the wal_sender_timeout of the server, i.e. the time
+// after which the server closes a replication connection which didn't send a
+// status update. A timeout of 0 means the server never closes the connection.
+func WALSenderTimeout(ctx context.Context, conn *pgconn.PgConn) (time.Duration, error) {
+	results, err := conn.Exec(ctx, "SELECT setting FROM pg_settings WHERE name = 'wal_sender_timeout'").ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query wal_sender_timeout: %w", err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) != 1 {
+		return 0, fmt.Errorf("unexpected result when querying wal_sender_timeout")
+	}
+
+	return parseWALSenderTimeout(string(results[0].Rows[0][0]))
+}
+
+// parseWALSenderTimeout parses the setting of wal_sender_timeout as stored in
+// pg_settings, which is always in milliseconds.
+func parseWALSenderTimeout(setting string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(setting, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wal_sender_timeout %q: %w", setting, err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
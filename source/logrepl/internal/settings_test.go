@@ -0,0 +1,92 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/matryer/is"
+)
+
+func TestCheckWALLevel(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectReplication(ctx, t, test.RepmgrConnString)
+
+	is.NoErr(CheckWALLevel(ctx, conn))
+}
+
+func TestCheckWALLevel_Invalid(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(checkWALLevel("logical"))
+
+	err := checkWALLevel("replica")
+	is.Equal(err.Error(), `wal_level must be "logical", found "replica" (set wal_level = logical in postgresql.conf and restart the server)`)
+}
+
+func TestCheckReplicationPrivilege(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	is.NoErr(CheckReplicationPrivilege(ctx, conn.PgConn()))
+
+	conn = test.ConnectSimple(ctx, t, test.RegularConnString)
+	err := CheckReplicationPrivilege(ctx, conn.PgConn())
+	is.True(err != nil)
+	is.Equal(err.Error(), `missing REPLICATION privilege: role "meroxauser" is not allowed to use logical replication (grant it with ALTER ROLE meroxauser WITH REPLICATION)`)
+}
+
+func TestCheckReplicationPrivilege_Missing(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(checkReplicationPrivilege("admin", true, false, false))
+	is.NoErr(checkReplicationPrivilege("repl", false, true, false))
+	is.NoErr(checkReplicationPrivilege("rds", false, false, true))
+
+	err := checkReplicationPrivilege("user", false, false, false)
+	is.True(errors.Is(err, ErrMissingReplicationPrivilege))
+	is.Equal(err.Error(), `missing REPLICATION privilege: role "user" is not allowed to use logical replication (grant it with ALTER ROLE user WITH REPLICATION)`)
+}
+
+func TestWALSenderTimeout(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectReplication(ctx, t, test.RepmgrConnString)
+
+	timeout, err := WALSenderTimeout(ctx, conn)
+	is.NoErr(err)
+	is.Equal(timeout, time.Minute) // Postgres default
+}
+
+func TestParseWALSenderTimeout(t *testing.T) {
+	is := is.New(t)
+
+	timeout, err := parseWALSenderTimeout("60000")
+	is.NoErr(err)
+	is.Equal(timeout, time.Minute)
+
+	timeout, err = parseWALSenderTimeout("0")
+	is.NoErr(err)
+	is.Equal(timeout, time.Duration(0))
+
+	_, err = parseWALSenderTimeout("1min")
+	is.True(err != nil)
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -41,6 +42,13 @@ type Subscription struct {
 	Handler       Handler
 	StatusTimeout time.Duration
 	TXSnapshotID  string
+	// ExtraPublications are streamed together with Publication, their
+	// changes are passed to the same handler.
+	ExtraPublications []string
+	// OnProgress is called with the current LSNs after each processed message
+	// and each standby status update, if set. It is called synchronously, so
+	// it should return quickly.
+	OnProgress func(LSNProgress)
 
 	conn *pgconn.PgConn
 
@@ -56,16 +64,36 @@ type Subscription struct {
 
 type Handler func(context.Context, pglogrepl.Message, pglogrepl.LSN) error
 
-// CreateSubscription initializes the logical replication subscriber by creating the replication slot.
-func CreateSubscription(
-	ctx context.Context,
-	conn *pgconn.PgConn,
-	slotName,
-	publication string,
-	tables []string,
-	startLSN pglogrepl.LSN,
-	h Handler,
-) (*Subscription, error) {
+// LSNProgress contains the positions of the subscription in the WAL.
+type LSNProgress struct {
+	// Received is the LSN of the last message processed by the handler.
+	Received pglogrepl.LSN
+	// Flushed is the LSN of the last acknowledged message, Postgres can
+	// remove WAL up to this position.
+	Flushed pglogrepl.LSN
+	// Applied is the LSN reported to Postgres as applied, currently the same
+	// as Flushed.
+	Applied pglogrepl.LSN
+}
+
+// ReplicationSlot contains information about a created replication slot which
+// does not depend on the connection that was used to create it.
+type ReplicationSlot struct {
+	Name string
+	// ConsistentPoint is the LSN at which the slot became consistent. It is
+	// zero if the slot already existed.
+	ConsistentPoint pglogrepl.LSN
+	// SnapshotName is the name of the snapshot exported when the slot was
+	// created. It is empty if the slot already existed. The snapshot is valid
+	// until the connection used to create the slot is closed or used to
+	// execute another command.
+	SnapshotName string
+}
+
+// CreateReplicationSlot creates a logical replication slot and exports a
+// snapshot. If the slot already exists, a warning is logged and an empty
+// snapshot name is returned.
+func CreateReplicationSlot(ctx context.Context, conn *pgconn.PgConn, slotName string) (ReplicationSlot, error) {
 	result, err := pglogrepl.CreateReplicationSlot(
 		ctx,
 		conn,
@@ -80,13 +108,63 @@ func CreateSubscription(
 		// If creating the replication slot fails with code 42710, this means
 		// the replication slot already exists.
 		if !IsPgDuplicateErr(err) {
-			return nil, err
+			return ReplicationSlot{}, err
 		}
 
 		sdk.Logger(ctx).Warn().
 			Msgf("replication slot %q already exists", slotName)
+
+		return ReplicationSlot{Name: slotName}, nil
+	}
+
+	consistentPoint, err := pglogrepl.ParseLSN(result.ConsistentPoint)
+	if err != nil {
+		return ReplicationSlot{}, fmt.Errorf("failed to parse consistent point: %w", err)
 	}
 
+	return ReplicationSlot{
+		Name:            slotName,
+		ConsistentPoint: consistentPoint,
+		SnapshotName:    result.SnapshotName,
+	}, nil
+}
+
+// CreateSubscription initializes the logical replication subscriber by creating
+// the replication slot. The same connection is used to create the slot and to
+// stream changes, which invalidates the exported snapshot once the subscription
+// is started. Use CreateReplicationSlot and NewSubscription with separate
+// connections to consume the snapshot while streaming.
+func CreateSubscription(
+	ctx context.Context,
+	conn *pgconn.PgConn,
+	slotName,
+	publication string,
+	tables []string,
+	startLSN pglogrepl.LSN,
+	h Handler,
+) (*Subscription, error) {
+	slot, err := CreateReplicationSlot(ctx, conn, slotName)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := NewSubscription(conn, slotName, publication, tables, startLSN, h)
+	sub.TXSnapshotID = slot.SnapshotName
+
+	return sub, nil
+}
+
+// NewSubscription initializes the logical replication subscriber for an
+// existing replication slot. The connection is used exclusively for streaming
+// changes.
+func NewSubscription(
+	conn *pgconn.PgConn,
+	slotName,
+	publication string,
+	tables []string,
+	startLSN pglogrepl.LSN,
+	h Handler,
+) *Subscription {
 	return &Subscription{
 		SlotName:      slotName,
 		Publication:   publication,
@@ -94,13 +172,12 @@ func CreateSubscription(
 		StartLSN:      startLSN,
 		Handler:       h,
 		StatusTimeout: 10 * time.Second,
-		TXSnapshotID:  result.SnapshotName,
 
 		conn: conn,
 
 		ready: make(chan struct{}),
 		done:  make(chan struct{}),
-	}, nil
+	}
 }
 
 // Run logical replication listener and block until error or ctx is canceled.
@@ -108,6 +185,7 @@ func (s *Subscription) Run(ctx context.Context) error {
 	defer s.doneReplication()
 
 	if err := s.startReplication(ctx); err != nil {
+		s.doneErr = err
 		return err
 	}
 
@@ -217,9 +295,23 @@ func (s *Subscription) handleXLogData(ctx context.Context, copyDataMsg *pgproto3
 	if xld.WALStart > 0 {
 		s.walWritten = xld.WALStart
 	}
+	s.reportProgress()
 	return nil
 }
 
+// reportProgress calls OnProgress with the current LSNs, if set.
+func (s *Subscription) reportProgress() {
+	if s.OnProgress == nil {
+		return
+	}
+	walFlushed := pglogrepl.LSN(atomic.LoadUint64((*uint64)(&s.walFlushed)))
+	s.OnProgress(LSNProgress{
+		Received: s.walWritten,
+		Flushed:  walFlushed,
+		Applied:  walFlushed,
+	})
+}
+
 // Ack stores the LSN as flushed. Next time WAL positions are flushed, Postgres
 // will know it can purge WAL logs up to this LSN.
 func (s *Subscription) Ack(lsn pglogrepl.LSN) {
@@ -274,7 +366,7 @@ func (s *Subscription) Err() error {
 func (s *Subscription) startReplication(ctx context.Context) error {
 	pluginArgs := []string{
 		`"proto_version" '1'`,
-		fmt.Sprintf(`"publication_names" '%s'`, s.Publication),
+		fmt.Sprintf(`"publication_names" '%s'`, strings.Join(s.publicationNames(), ",")),
 	}
 
 	if err := pglogrepl.StartReplication(
@@ -294,6 +386,11 @@ func (s *Subscription) startReplication(ctx context.Context) error {
 	return nil
 }
 
+// publicationNames returns the names of all publications to stream.
+func (s *Subscription) publicationNames() []string {
+	return append([]string{s.Publication}, s.ExtraPublications...)
+}
+
 // sendStandbyCopyDone sends the status message to server indicating that
 // replication is done.
 func (s *Subscription) sendStandbyCopyDone(ctx context.Context) error {
@@ -332,6 +429,7 @@ func (s *Subscription) sendStandbyStatusUpdate(ctx context.Context) error {
 		return fmt.Errorf("failed to send standby status update: %w", err)
 	}
 
+	s.reportProgress()
 	return nil
 }
 
@@ -16,6 +16,7 @@ package internal
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"testing"
@@ -24,6 +25,7 @@ import (
 	"github.com/conduitio/conduit-connector-postgres/test"
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/matryer/is"
 )
 
@@ -198,6 +200,43 @@ func TestSubscription_Stop(t *testing.T) {
 	})
 }
 
+func TestSubscription_OnProgress(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	var got []LSNProgress
+	s := &Subscription{
+		Handler: func(context.Context, pglogrepl.Message, pglogrepl.LSN) error {
+			return nil
+		},
+		OnProgress: func(p LSNProgress) {
+			got = append(got, p)
+		},
+	}
+
+	// xlog data containing a begin message
+	xlogData := func(walStart pglogrepl.LSN) *pgproto3.CopyData {
+		data := []byte{pglogrepl.XLogDataByteID}
+		data = binary.BigEndian.AppendUint64(data, uint64(walStart))
+		data = binary.BigEndian.AppendUint64(data, uint64(walStart)) // server WAL end
+		data = binary.BigEndian.AppendUint64(data, 0)                // server time
+		data = append(data, byte(pglogrepl.MessageTypeBegin))
+		data = binary.BigEndian.AppendUint64(data, uint64(walStart)) // final LSN
+		data = binary.BigEndian.AppendUint64(data, 0)                // commit time
+		data = binary.BigEndian.AppendUint32(data, 1)                // xid
+		return &pgproto3.CopyData{Data: data}
+	}
+
+	is.NoErr(s.handleXLogData(ctx, xlogData(100)))
+	s.Ack(100)
+	is.NoErr(s.handleXLogData(ctx, xlogData(200)))
+
+	is.Equal(got, []LSNProgress{
+		{Received: 100, Flushed: 0, Applied: 0},
+		{Received: 200, Flushed: 100, Applied: 100},
+	})
+}
+
 func setupSubscription(
 	ctx context.Context,
 	t *testing.T,
@@ -0,0 +1,82 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// KeepaliveConfig contains the TCP keepalive settings of replication
+// connections, which are idle while no changes are replicated. Zero values
+// keep the defaults of the operating system.
+type KeepaliveConfig struct {
+	// Idle is the time a connection has to be idle before keepalive probes
+	// are sent.
+	Idle time.Duration
+	// Interval is the time between keepalive probes.
+	Interval time.Duration
+	// Count is the number of unanswered probes after which the connection is
+	// considered dead. It is only supported on Linux.
+	Count int
+}
+
+func (k KeepaliveConfig) isZero() bool {
+	return k == KeepaliveConfig{}
+}
+
+// withKeepalive returns a copy of the connection config which applies the
+// keepalive settings to the connections it dials.
+func withKeepalive(pgconf *pgconn.Config, k KeepaliveConfig) *pgconn.Config {
+	c := pgconf.Copy()
+	if k.isZero() {
+		return c
+	}
+
+	dial := c.DialFunc
+	c.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tcpConn, ok := conn.(*net.TCPConn)
+		if !ok {
+			return conn, nil // e.g. unix sockets
+		}
+		if err := setKeepalive(tcpConn, k); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set keepalive options: %w", err)
+		}
+		return conn, nil
+	}
+	return c
+}
+
+func setKeepalive(conn *net.TCPConn, k KeepaliveConfig) error {
+	if err := conn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	if k.Idle > 0 {
+		// sets the interval as well on most platforms, it is overwritten below
+		if err := conn.SetKeepAlivePeriod(k.Idle); err != nil {
+			return err
+		}
+	}
+	return setKeepaliveProbes(conn, k)
+}
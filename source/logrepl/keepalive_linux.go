@@ -0,0 +1,51 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package logrepl
+
+import (
+	"net"
+	"syscall"
+)
+
+// setKeepaliveProbes sets the interval and number of keepalive probes, which
+// the standard library does not expose separately.
+func setKeepaliveProbes(conn *net.TCPConn, k KeepaliveConfig) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if k.Interval > 0 {
+			secs := int(k.Interval.Seconds())
+			if secs < 1 {
+				secs = 1
+			}
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, secs); sockErr != nil {
+				return
+			}
+		}
+		if k.Count > 0 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, k.Count)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
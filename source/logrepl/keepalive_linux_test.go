@@ -0,0 +1,68 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/matryer/is"
+)
+
+func TestWithKeepalive(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer l.Close()
+
+	pgconf, err := pgconn.ParseConfig("postgres://" + l.Addr().String() + "/db")
+	is.NoErr(err)
+
+	conf := withKeepalive(pgconf, KeepaliveConfig{
+		Idle:     42 * time.Second,
+		Interval: 7 * time.Second,
+		Count:    3,
+	})
+	conn, err := conf.DialFunc(ctx, "tcp", l.Addr().String())
+	is.NoErr(err)
+	defer conn.Close()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	is.NoErr(err)
+
+	got := map[int]int{}
+	is.NoErr(raw.Control(func(fd uintptr) {
+		for _, opt := range []int{syscall.TCP_KEEPIDLE, syscall.TCP_KEEPINTVL, syscall.TCP_KEEPCNT} {
+			v, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, opt)
+			is.NoErr(err)
+			got[opt] = v
+		}
+		v, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+		is.NoErr(err)
+		is.Equal(v, 1)
+	}))
+
+	is.Equal(got, map[int]int{
+		syscall.TCP_KEEPIDLE:  42,
+		syscall.TCP_KEEPINTVL: 7,
+		syscall.TCP_KEEPCNT:   3,
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+)
+
+// Replay feeds the messages through a new CDCHandler created with the config
+// and returns the records emitted by the handler. It can be used to reproduce
+// issues with a captured sequence of logical replication messages, e.g. parsed
+// with pglogrepl.Parse. The messages get consecutive LSNs starting at 1.
+//
+// Replay stops at the first message the handler fails on and returns the
+// records emitted up to that point together with the error. Updates which are
+// still held back to be coalesced are emitted after the last message.
+func Replay(ctx context.Context, c CDCHandlerConfig, msgs []pglogrepl.Message) ([]sdk.Record, error) {
+	out := make(chan sdk.Record)
+	h := NewCDCHandler(internal.NewRelationSet(), out, c)
+
+	collected := make(chan []sdk.Record)
+	go func() {
+		var recs []sdk.Record
+		for rec := range out {
+			recs = append(recs, rec)
+		}
+		collected <- recs
+	}()
+
+	var err error
+	for i, msg := range msgs {
+		if err = h.Handle(ctx, msg, pglogrepl.LSN(i+1)); err != nil {
+			err = fmt.Errorf("failed to replay message %d: %w", i, err)
+			break
+		}
+	}
+	if err == nil && h.coalescer != nil {
+		err = h.coalescer.flush(ctx)
+	}
+	if closeErr := h.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close handler: %w", closeErr)
+	}
+	close(out)
+
+	return <-collected, err
+}
@@ -0,0 +1,89 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/matryer/is"
+)
+
+// capturedUsers is a captured pgoutput stream of a transaction inserting and
+// updating a row in the table users (id int8 primary key, name text).
+var capturedUsers = []string{
+	"4200000000016b37480000000000000000000002eb",                                                     // begin
+	"520000400a7075626c6963007573657273006400020169640000000014ffffffff006e616d650000000019ffffffff", // relation
+	"490000400a4e00027400000001317400000005616c696365",                                               // insert
+	"550000400a4e00027400000001317400000003626f62",                                                   // update
+	"430000000000016b374800000000016b37780000000000000000",                                           // commit
+}
+
+func parseCaptured(captured []string) ([]pglogrepl.Message, error) {
+	msgs := make([]pglogrepl.Message, len(captured))
+	for i, c := range captured {
+		data, err := hex.DecodeString(c)
+		if err != nil {
+			return nil, err
+		}
+		msgs[i], err = pglogrepl.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+func ExampleReplay() {
+	msgs, err := parseCaptured(capturedUsers)
+	if err != nil {
+		panic(err)
+	}
+
+	recs, err := Replay(context.Background(), CDCHandlerConfig{
+		TableKeys: map[string]string{"users": "id"},
+	}, msgs)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, rec := range recs {
+		fmt.Println(rec.Operation, rec.Key, rec.Payload.After)
+	}
+
+	// Output:
+	// create map[id:1] map[id:1 name:alice]
+	// update map[id:1] map[id:1 name:bob]
+}
+
+func TestReplay_Error(t *testing.T) {
+	is := is.New(t)
+
+	msgs, err := parseCaptured(capturedUsers)
+	is.NoErr(err)
+	// drop the relation, the insert can't be decoded without it
+	msgs = append(msgs[:1], msgs[2:]...)
+
+	recs, err := Replay(context.Background(), CDCHandlerConfig{
+		TableKeys: map[string]string{"users": "id"},
+	}, msgs)
+	is.True(err != nil)
+	is.Equal(err.Error(), "failed to replay message 1: logrepl handler insert: no relation for 16394")
+	is.Equal(recs, []sdk.Record(nil))
+}
@@ -0,0 +1,210 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MetadataDebeziumSchema is the metadata key containing the Debezium-style
+// schema of the record payload.
+const MetadataDebeziumSchema = DefaultMetadataPrefix + "debezium.schema"
+
+// MetadataSchemaID is the metadata key containing the ID of the Debezium-style
+// schema of the record payload, see CDCHandlerConfig.SchemaRecords. Schema
+// records contain the schema itself in MetadataDebeziumSchema.
+const MetadataSchemaID = DefaultMetadataPrefix + "schemaId"
+
+// SchemaCollection is the collection of schema records, which keeps them apart
+// from the changes of the tables they describe. Consumers writing collections
+// to tables should filter it out.
+const SchemaCollection = "_schemas"
+
+// MetadataTable is the metadata key containing the name of the table a schema
+// record describes.
+const MetadataTable = DefaultMetadataPrefix + "table"
+
+// debeziumSchema describes a payload using the Kafka Connect schema format,
+// which is what Debezium attaches to its records.
+type debeziumSchema struct {
+	Type       string            `json:"type"`
+	Optional   bool              `json:"optional"`
+	Name       string            `json:"name,omitempty"`
+	Field      string            `json:"field,omitempty"`
+	Fields     []debeziumSchema  `json:"fields,omitempty"`
+	Items      *debeziumSchema   `json:"items,omitempty"`
+	Keys       *debeziumSchema   `json:"keys,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+const (
+	// debeziumParamColumnDefault is the schema parameter containing the
+	// default value expression of a column.
+	debeziumParamColumnDefault = "column.default"
+	// debeziumParamFloatSpecials is the schema parameter set to "string" on
+	// float fields whose special values are written as strings, see
+	// types.FloatFormatter.ReplaceSpecials.
+	debeziumParamFloatSpecials = "float.specials"
+)
+
+// debeziumSchemaOptions contains the settings which determine the values in
+// the payload, so the schema matches them.
+type debeziumSchemaOptions struct {
+	// keyColumns are the configured key columns of the relation.
+	keyColumns []string
+	// defaults are the default value expressions by column name.
+	defaults map[string]string
+	// renames are the new names by column name.
+	renames map[string]string
+	// intervalComponents is true if intervals are written as their
+	// components, see types.IntervalFormatter.Components.
+	intervalComponents bool
+	// floatSpecials replaces the special values of floats, if set.
+	floatSpecials func(name string) any
+}
+
+// newDebeziumSchema builds the schema of the payload for the relation. The
+// configured key columns are marked as required, all other columns are
+// optional, since the relation message does not carry nullability
+// information. Column defaults are added as parameters of the fields, if
+// supplied. Fields of renamed columns get their new name.
+func newDebeziumSchema(rel *pglogrepl.RelationMessage, opts debeziumSchemaOptions) debeziumSchema {
+	fields := make([]debeziumSchema, len(rel.Columns))
+	for i, col := range rel.Columns {
+		field := debeziumField(col, opts)
+		field.Field = col.Name
+		if renamed, ok := opts.renames[col.Name]; ok {
+			field.Field = renamed
+		}
+		field.Optional = field.Optional || !slices.Contains(opts.keyColumns, col.Name)
+		if def, ok := opts.defaults[col.Name]; ok {
+			if field.Parameters == nil {
+				field.Parameters = make(map[string]string)
+			}
+			field.Parameters[debeziumParamColumnDefault] = def
+		}
+		fields[i] = field
+	}
+
+	return debeziumSchema{
+		Type:     "struct",
+		Optional: false,
+		Name:     fmt.Sprintf("%s.%s.Value", rel.Namespace, rel.RelationName),
+		Fields:   fields,
+	}
+}
+
+func (s debeziumSchema) marshal() (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal debezium schema: %w", err)
+	}
+	return string(b), nil
+}
+
+// debeziumField maps the type of a column to the Kafka Connect schema of the
+// values the connector writes for it, see types.Format.
+func debeziumField(col *pglogrepl.RelationMessageColumn, opts debeziumSchemaOptions) debeziumSchema {
+	switch col.DataType {
+	case pgtype.BoolOID:
+		return debeziumSchema{Type: "boolean"}
+	case pgtype.Int2OID:
+		return debeziumSchema{Type: "int16"}
+	case pgtype.Int4OID:
+		return debeziumSchema{Type: "int32"}
+	case pgtype.Int8OID:
+		return debeziumSchema{Type: "int64"}
+	case pgtype.Float4OID:
+		return debeziumFloat("float32", opts.floatSpecials)
+	case pgtype.Float8OID:
+		return debeziumFloat("float64", opts.floatSpecials)
+	case pgtype.NumericOID:
+		// numerics without a fraction are written as integers, which is
+		// only guaranteed for all values if the scale is 0
+		if numericScale(col.TypeModifier) == 0 {
+			return debeziumSchema{Type: "int64"}
+		}
+		return debeziumSchema{Type: "float64"}
+	case pgtype.ByteaOID:
+		return debeziumSchema{Type: "bytes"}
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		// the value is the decoded document, Kafka Connect has no type for
+		// arbitrary JSON values, only the keys of objects are described
+		return debeziumSchema{Type: "map", Name: "io.debezium.data.Json", Keys: &debeziumSchema{Type: "string"}}
+	case pgtype.UUIDOID:
+		// the value is the array of the 16 bytes of the UUID
+		return debeziumSchema{Type: "array", Name: "io.debezium.data.Uuid", Items: &debeziumSchema{Type: "int16"}}
+	case pgtype.IntervalOID:
+		if opts.intervalComponents {
+			return debeziumSchema{Type: "struct", Fields: []debeziumSchema{
+				{Type: "int32", Field: "months"},
+				{Type: "int32", Field: "days"},
+				{Type: "int64", Field: "microseconds"},
+			}}
+		}
+		return debeziumSchema{Type: "struct", Fields: []debeziumSchema{
+			{Type: "int64", Field: "Microseconds"},
+			{Type: "int32", Field: "Days"},
+			{Type: "int32", Field: "Months"},
+			{Type: "boolean", Field: "Valid"},
+		}}
+	case pgtype.DateOID, pgtype.TimestampOID, pgtype.TimestamptzOID:
+		return debeziumSchema{Type: "string", Name: "io.debezium.time.ZonedTimestamp"}
+	default:
+		return debeziumSchema{Type: "string"}
+	}
+}
+
+// debeziumFloat returns the schema of a float type. Special values are
+// replaced with null or strings if floatSpecials is set, which makes the field
+// optional or is marked with debeziumParamFloatSpecials.
+func debeziumFloat(typ string, floatSpecials func(name string) any) debeziumSchema {
+	s := debeziumSchema{Type: typ}
+	if floatSpecials == nil {
+		return s
+	}
+	switch floatSpecials("NaN").(type) {
+	case nil:
+		s.Optional = true
+	case string:
+		s.Parameters = map[string]string{debeziumParamFloatSpecials: "string"}
+	}
+	return s
+}
+
+// numericScale returns the scale of a numeric type with the type modifier, or
+// -1 if the numeric is unconstrained.
+func numericScale(typeModifier int32) int {
+	// the type modifier is the precision and scale, offset by the size of
+	// the varlena header
+	if typeModifier < 4 {
+		return -1
+	}
+	return int((typeModifier - 4) & 0xffff)
+}
+
+// schemaID derives the ID of a marshaled schema from its content, so the same
+// schema gets the same ID across restarts.
+func schemaID(schema string) string {
+	sum := sha256.Sum256([]byte(schema))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,132 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SetupConfig contains the role the connector connects with and the objects
+// prepared for it by Setup.
+type SetupConfig struct {
+	// Role is granted the privileges required by the connector.
+	Role string
+	// Tables are the tables read by the connector. The role is granted
+	// SELECT on them and USAGE on their schemas. Tables without a schema are
+	// assumed to be in the public schema.
+	Tables []string
+	// PublicationName is the publication created for Tables, if set.
+	PublicationName string
+	// SlotName is the logical replication slot created, if set. A slot
+	// created ahead of time does not export a snapshot to the connector, so
+	// the initial snapshot is not aligned with the start of the slot.
+	SlotName string
+}
+
+// Setup grants the role the privileges required by the connector, i.e.
+// REPLICATION, USAGE on the schemas of the tables and SELECT on the tables,
+// and creates the publication and replication slot if they are configured.
+// The connection has to belong to a superuser, it can be a regular or a
+// replication connection. Setup is idempotent, existing privileges and
+// objects are left as they are, so it can be run repeatedly.
+func Setup(ctx context.Context, conn *pgconn.PgConn, c SetupConfig) error {
+	if c.Role == "" {
+		return errors.New("setup: role is required")
+	}
+
+	logger := sdk.Logger(ctx)
+	role := pgx.Identifier{c.Role}.Sanitize()
+
+	if err := conn.Exec(ctx, "ALTER ROLE "+role+" WITH REPLICATION").Close(); err != nil {
+		return fmt.Errorf("failed to grant REPLICATION to role %q: %w", c.Role, err)
+	}
+	logger.Info().Str("role", c.Role).Msg("setup: granted REPLICATION")
+
+	var tables, schemas []string
+	for _, t := range c.Tables {
+		ident := pgx.Identifier(strings.Split(t, "."))
+		if len(ident) == 1 {
+			ident = pgx.Identifier{"public", t}
+		}
+		tables = append(tables, ident.Sanitize())
+		schema := pgx.Identifier{ident[0]}.Sanitize()
+		if !slices.Contains(schemas, schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+
+	for _, schema := range schemas {
+		if err := conn.Exec(ctx, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", schema, role)).Close(); err != nil {
+			return fmt.Errorf("failed to grant USAGE on schema %s to role %q: %w", schema, c.Role, err)
+		}
+		logger.Info().Str("role", c.Role).Str("schema", schema).Msg("setup: granted USAGE on schema")
+	}
+
+	if len(tables) > 0 {
+		if err := conn.Exec(ctx, fmt.Sprintf("GRANT SELECT ON %s TO %s", strings.Join(tables, ", "), role)).Close(); err != nil {
+			return fmt.Errorf("failed to grant SELECT on tables to role %q: %w", c.Role, err)
+		}
+		logger.Info().Str("role", c.Role).Strs("tables", tables).Msg("setup: granted SELECT on tables")
+	}
+
+	if c.PublicationName != "" {
+		if err := internal.CreatePublication(ctx, conn, c.PublicationName, internal.CreatePublicationOptions{
+			Tables:      c.Tables,
+			IfNotExists: true,
+		}); err != nil {
+			return fmt.Errorf("failed to create publication %q: %w", c.PublicationName, err)
+		}
+		logger.Info().Str("publication", c.PublicationName).Msg("setup: ensured publication exists")
+	}
+
+	if c.SlotName != "" {
+		if err := setupSlot(ctx, conn, c.SlotName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setupSlot creates the logical replication slot, an existing slot is skipped.
+func setupSlot(ctx context.Context, conn *pgconn.PgConn, name string) error {
+	exists, err := SlotExists(ctx, conn, name)
+	if err != nil {
+		return fmt.Errorf("failed to create replication slot %q: %w", name, err)
+	}
+	if exists {
+		sdk.Logger(ctx).Info().Str("slot", name).Msg("setup: replication slot exists, skipping")
+		return nil
+	}
+
+	// The function is used instead of the replication command, so the slot
+	// can also be created using a regular connection.
+	if err := conn.Exec(ctx, fmt.Sprintf(
+		"SELECT pg_create_logical_replication_slot('%s', 'pgoutput')", name,
+	)).Close(); err != nil {
+		return fmt.Errorf("failed to create replication slot %q: %w", name, err)
+	}
+	sdk.Logger(ctx).Info().Str("slot", name).Msg("setup: created replication slot")
+	return nil
+}
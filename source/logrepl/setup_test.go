@@ -0,0 +1,79 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/matryer/is"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+
+	table := test.SetupTestTable(ctx, t, conn)
+	role := test.RandomIdentifier(t)
+	_, err := conn.Exec(ctx, "CREATE ROLE "+role)
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), fmt.Sprintf("DROP OWNED BY %s; DROP ROLE %s", role, role))
+		is.NoErr(err)
+	})
+
+	c := SetupConfig{
+		Role:            role,
+		Tables:          []string{table},
+		PublicationName: role,
+		SlotName:        role,
+	}
+	t.Cleanup(func() {
+		is.NoErr(Cleanup(context.Background(), CleanupConfig{
+			URL:             test.RepmgrConnString,
+			SlotName:        c.SlotName,
+			PublicationName: c.PublicationName,
+		}))
+	})
+
+	// running setup again does not change anything
+	is.NoErr(Setup(ctx, conn.PgConn(), c))
+	is.NoErr(Setup(ctx, conn.PgConn(), c))
+
+	var replication, usage, selectable bool
+	is.NoErr(conn.QueryRow(ctx, "SELECT rolreplication FROM pg_roles WHERE rolname = $1", role).Scan(&replication))
+	is.NoErr(conn.QueryRow(ctx, "SELECT has_schema_privilege($1, 'public', 'USAGE')", role).Scan(&usage))
+	is.NoErr(conn.QueryRow(ctx, "SELECT has_table_privilege($1, $2, 'SELECT')", role, table).Scan(&selectable))
+	is.True(replication)
+	is.True(usage)
+	is.True(selectable)
+
+	exists, err := PublicationExists(ctx, conn.PgConn(), c.PublicationName)
+	is.NoErr(err)
+	is.True(exists)
+	exists, err = SlotExists(ctx, conn.PgConn(), c.SlotName)
+	is.NoErr(err)
+	is.True(exists)
+}
+
+func TestSetup_RoleRequired(t *testing.T) {
+	is := is.New(t)
+
+	err := Setup(context.Background(), nil, SetupConfig{Tables: []string{"table"}})
+	is.Equal(err.Error(), "setup: role is required")
+}
@@ -0,0 +1,138 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrSinkBlocked is returned if the sink does not accept a record in any
+	// of the attempts configured with CDCHandlerConfig.SendRetries.
+	ErrSinkBlocked = errors.New("sink did not accept record")
+	// ErrHandlerClosed is returned by CDCHandler once it was closed.
+	ErrHandlerClosed = errors.New("handler is closed")
+)
+
+// RecordSink receives the records emitted by CDCHandler.
+type RecordSink interface {
+	// Send delivers the record. It blocks until the record is delivered or
+	// the context is canceled, in which case the context error is returned.
+	Send(ctx context.Context, rec sdk.Record) error
+}
+
+// ChannelSink sends records to a channel.
+type ChannelSink chan<- sdk.Record
+
+func (s ChannelSink) Send(ctx context.Context, rec sdk.Record) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s <- rec:
+		return nil
+	}
+}
+
+// DiscardSink drops all records and only counts them. It can be used to check
+// if changes can be decoded without delivering the records anywhere.
+type DiscardSink struct {
+	count atomic.Uint64
+}
+
+func (s *DiscardSink) Send(context.Context, sdk.Record) error {
+	s.count.Add(1)
+	return nil
+}
+
+// Count returns the number of records received by the sink.
+func (s *DiscardSink) Count() uint64 {
+	return s.count.Load()
+}
+
+// retrySink gives up sending a record to a sink which does not accept it
+// after a bounded number of attempts. Each attempt waits twice as long as the
+// previous one, so a slow consumer gets time to catch up while a consumer
+// which stopped draining is detected.
+type retrySink struct {
+	sink    RecordSink
+	retries int
+	backoff time.Duration
+}
+
+func (s *retrySink) Send(ctx context.Context, rec sdk.Record) error {
+	wait := s.backoff
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, wait)
+		err := s.sink.Send(attemptCtx, rec)
+		cancel()
+		if err == nil || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		if attempt == s.retries {
+			return fmt.Errorf("%w after %d attempts", ErrSinkBlocked, attempt+1)
+		}
+
+		sdk.Logger(ctx).Warn().
+			Int("attempt", attempt+1).
+			Dur("waited", wait).
+			Msg("sink did not accept record, retrying")
+		wait *= 2
+	}
+}
+
+// rateLimitedSink caps the rate at which records are sent to a sink. Sending
+// blocks while the rate is exceeded, or until the context is canceled.
+type rateLimitedSink struct {
+	sink    RecordSink
+	limiter *rate.Limiter
+}
+
+func (s *rateLimitedSink) Send(ctx context.Context, rec sdk.Record) error {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return s.sink.Send(ctx, rec)
+}
+
+// closableSink aborts sending records once the closed context is canceled, so
+// a handler can be closed while a send is blocked on the sink.
+type closableSink struct {
+	sink   RecordSink
+	closed context.Context
+}
+
+func (s *closableSink) Send(ctx context.Context, rec sdk.Record) error {
+	if s.closed.Err() != nil {
+		return ErrHandlerClosed
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(s.closed, func() { cancel(ErrHandlerClosed) })
+	defer stop()
+
+	err := s.sink.Send(ctx, rec)
+	if err != nil && errors.Is(context.Cause(ctx), ErrHandlerClosed) {
+		return ErrHandlerClosed
+	}
+	return err
+}
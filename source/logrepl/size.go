@@ -0,0 +1,70 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// approxPayloadSize estimates the size of the payload serialized as JSON in
+// bytes. It walks the values without serializing them, so strings and bytes
+// are counted exactly and other values with a fixed estimate.
+func approxPayloadSize(p sdk.Change) int {
+	return approxDataSize(p.Before) + approxDataSize(p.After)
+}
+
+func approxDataSize(d sdk.Data) int {
+	switch d := d.(type) {
+	case nil:
+		return 0
+	case sdk.StructuredData:
+		return approxValueSize(map[string]any(d))
+	default:
+		return len(d.Bytes())
+	}
+}
+
+func approxValueSize(v any) int {
+	switch v := v.(type) {
+	case nil:
+		return 4 // null
+	case bool:
+		return 5
+	case string:
+		return len(v) + 2 // quotes
+	case []byte:
+		return (len(v)+2)/3*4 + 2 // base64 with quotes
+	case int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, uint:
+		return 8
+	case float32, float64:
+		return 12
+	case map[string]any:
+		size := 2 // braces
+		for k, e := range v {
+			size += len(k) + 4 + approxValueSize(e) // quotes, colon and comma
+		}
+		return size
+	case []any:
+		size := 2 // brackets
+		for _, e := range v {
+			size += approxValueSize(e) + 1 // comma
+		}
+		return size
+	default:
+		return len(fmt.Sprint(v))
+	}
+}
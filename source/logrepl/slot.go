@@ -0,0 +1,73 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
+)
+
+type AdvanceSlotConfig struct {
+	URL      string
+	SlotName string
+	// LSN is the position the slot is advanced to.
+	LSN pglogrepl.LSN
+}
+
+// AdvanceSlot moves the replication slot forward to the configured LSN, e.g. to
+// skip WAL that can't be processed. The slot must not be in use. Returns the
+// position the slot was advanced to. The LSN must not be behind the restart
+// LSN of the slot, since WAL before it is not retained anymore.
+func AdvanceSlot(ctx context.Context, c AdvanceSlotConfig) (pglogrepl.LSN, error) {
+	conn, err := pgx.Connect(ctx, c.URL)
+	if err != nil {
+		return 0, fmt.Errorf("could not establish connection: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	var restartLSN string
+	err = conn.QueryRow(
+		ctx,
+		"SELECT restart_lsn FROM pg_replication_slots WHERE slot_name = $1",
+		c.SlotName,
+	).Scan(&restartLSN)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get restart LSN of replication slot %q: %w", c.SlotName, err)
+	}
+
+	restart, err := pglogrepl.ParseLSN(restartLSN)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse restart LSN %q: %w", restartLSN, err)
+	}
+	if c.LSN < restart {
+		return 0, fmt.Errorf("cannot advance replication slot %q to %s, it is behind the restart LSN %s", c.SlotName, c.LSN, restart)
+	}
+
+	var endLSN string
+	err = conn.QueryRow(
+		ctx,
+		"SELECT end_lsn::text FROM pg_replication_slot_advance($1, $2::pg_lsn)",
+		c.SlotName,
+		c.LSN.String(),
+	).Scan(&endLSN)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance replication slot %q: %w", c.SlotName, err)
+	}
+
+	return pglogrepl.ParseLSN(endLSN)
+}
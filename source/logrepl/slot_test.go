@@ -0,0 +1,80 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/jackc/pglogrepl"
+	"github.com/matryer/is"
+)
+
+func TestAdvanceSlot(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	slotName := test.RandomIdentifier(t)
+	test.CreateReplicationSlot(t, conn, slotName)
+
+	// write some WAL, so there is something to skip
+	table := test.SetupTestTable(ctx, t, conn)
+	_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (id, column1) VALUES (6, 'bizz')`, table))
+	is.NoErr(err)
+
+	var currentLSN string
+	err = conn.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&currentLSN)
+	is.NoErr(err)
+	target, err := pglogrepl.ParseLSN(currentLSN)
+	is.NoErr(err)
+
+	got, err := AdvanceSlot(ctx, AdvanceSlotConfig{
+		URL:      test.RepmgrConnString,
+		SlotName: slotName,
+		LSN:      target,
+	})
+	is.NoErr(err)
+	is.Equal(got, target)
+
+	var confirmedLSN string
+	err = conn.QueryRow(
+		ctx,
+		"SELECT confirmed_flush_lsn::text FROM pg_replication_slots WHERE slot_name = $1",
+		slotName,
+	).Scan(&confirmedLSN)
+	is.NoErr(err)
+	is.Equal(confirmedLSN, target.String())
+}
+
+func TestAdvanceSlot_BehindRestartLSN(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	slotName := test.RandomIdentifier(t)
+	test.CreateReplicationSlot(t, conn, slotName)
+
+	_, err := AdvanceSlot(ctx, AdvanceSlotConfig{
+		URL:      test.RepmgrConnString,
+		SlotName: slotName,
+		LSN:      1,
+	})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "behind the restart LSN"))
+}
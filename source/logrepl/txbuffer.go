@@ -0,0 +1,148 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func init() {
+	// register all types that can end up in record data, so they can be
+	// spilled to disk
+	gob.Register(sdk.RawData{})
+	gob.Register(sdk.StructuredData{})
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register([16]uint8{})
+	gob.Register(net.HardwareAddr{})
+	gob.Register(netip.Prefix{})
+	gob.Register(pgtype.Bits{})
+	gob.Register(pgtype.Box{})
+	gob.Register(pgtype.Circle{})
+	gob.Register(pgtype.InfinityModifier(0))
+	gob.Register(pgtype.Interval{})
+	gob.Register(pgtype.Line{})
+	gob.Register(pgtype.Lseg{})
+	gob.Register(pgtype.Multirange[pgtype.Range[any]]{})
+	gob.Register(pgtype.Path{})
+	gob.Register(pgtype.Point{})
+	gob.Register(pgtype.Polygon{})
+	gob.Register(pgtype.Range[any]{})
+	gob.Register(pgtype.TID{})
+	gob.Register(pgtype.Time{})
+}
+
+// txBuffer holds the records of a transaction until it is committed. If
+// maxRecords is set, records beyond that number are spilled to a temporary
+// file in dir and read back when the buffer is drained.
+type txBuffer struct {
+	maxRecords int
+	dir        string
+
+	records []sdk.Record
+	// startLSN and endLSN are the LSNs of the first and last buffered record.
+	startLSN pglogrepl.LSN
+	endLSN   pglogrepl.LSN
+
+	file    *os.File
+	enc     *gob.Encoder
+	spilled int
+}
+
+// append adds the record with the LSN of its change to the buffer.
+func (b *txBuffer) append(rec sdk.Record, lsn pglogrepl.LSN) error {
+	if b.len() == 0 {
+		b.startLSN = lsn
+	}
+	b.endLSN = lsn
+
+	if b.maxRecords <= 0 || len(b.records) < b.maxRecords {
+		b.records = append(b.records, rec)
+		return nil
+	}
+
+	if b.file == nil {
+		f, err := os.CreateTemp(b.dir, "conduit-postgres-tx-*")
+		if err != nil {
+			return fmt.Errorf("failed to create transaction spill file: %w", err)
+		}
+		b.file = f
+		b.enc = gob.NewEncoder(f)
+	}
+
+	if err := b.enc.Encode(rec); err != nil {
+		return fmt.Errorf("failed to spill record to disk: %w", err)
+	}
+	b.spilled++
+	return nil
+}
+
+// len returns the number of buffered records, including spilled records.
+func (b *txBuffer) len() int {
+	return len(b.records) + b.spilled
+}
+
+// each calls fn for all buffered records in the order they were appended.
+func (b *txBuffer) each(fn func(sdk.Record) error) error {
+	for _, rec := range b.records {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+
+	if b.file == nil {
+		return nil
+	}
+
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read transaction spill file: %w", err)
+	}
+	dec := gob.NewDecoder(b.file)
+	for i := 0; i < b.spilled; i++ {
+		var rec sdk.Record
+		if err := dec.Decode(&rec); err != nil {
+			return fmt.Errorf("failed to read spilled record: %w", err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset empties the buffer and removes the spill file, if any.
+func (b *txBuffer) reset() error {
+	b.records = b.records[:0]
+	b.spilled = 0
+	b.startLSN, b.endLSN = 0, 0
+
+	if b.file == nil {
+		return nil
+	}
+
+	f := b.file
+	b.file, b.enc = nil, nil
+	return errors.Join(f.Close(), os.Remove(f.Name()))
+}
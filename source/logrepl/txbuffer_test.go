@@ -0,0 +1,144 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/matryer/is"
+)
+
+func TestTxBuffer_Spill(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	b := &txBuffer{maxRecords: 2, dir: dir}
+
+	var want []sdk.Record
+	for i := 0; i < 5; i++ {
+		rec := sdk.Util.Source.NewRecordUpdate(
+			sdk.Position(fmt.Sprintf("pos-%d", i)),
+			sdk.Metadata{"foo": "bar"},
+			sdk.StructuredData{"id": int64(i)},
+			nil,
+			sdk.StructuredData{
+				"id":       int64(i),
+				"int4":     int32(i),
+				"name":     "foo",
+				"null":     nil,
+				"json":     map[string]any{"foo": []any{"bar", 1.5}},
+				"cidr":     netip.MustParsePrefix("192.168.100.128/25"),
+				"interval": pgtype.Interval{Microseconds: 18000000, Valid: true},
+				"tstzrange": pgtype.Range[any]{
+					Lower:     "2024-01-01 00:00:00 +0000 UTC",
+					Upper:     "2024-01-02 00:00:00 +0000 UTC",
+					LowerType: pgtype.Inclusive,
+					UpperType: pgtype.Exclusive,
+					Valid:     true,
+				},
+				"tid":   pgtype.TID{BlockNumber: 1, OffsetNumber: 2, Valid: true},
+				"point": pgtype.Point{P: pgtype.Vec2{X: 1.5, Y: -2}, Valid: true},
+			},
+		)
+		is.NoErr(b.append(rec, pglogrepl.LSN(i+1)))
+		want = append(want, rec)
+	}
+	is.Equal(b.len(), 5)
+	is.Equal(len(b.records), 2)
+	is.Equal(b.startLSN, pglogrepl.LSN(1))
+	is.Equal(b.endLSN, pglogrepl.LSN(5))
+
+	files, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 1) // records were spilled
+
+	var got []sdk.Record
+	is.NoErr(b.each(func(rec sdk.Record) error {
+		got = append(got, rec)
+		return nil
+	}))
+	is.Equal("", cmp.Diff(want, got,
+		cmpopts.IgnoreUnexported(sdk.Record{}),
+		cmp.Comparer(func(x, y netip.Prefix) bool { return x == y }),
+	))
+
+	is.NoErr(b.reset())
+	is.Equal(b.len(), 0)
+
+	files, err = os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0) // spill file was removed
+}
+
+func TestCDCHandler_BufferTransactionsSpill(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	dir := t.TempDir()
+	out := make(chan sdk.Record, 10)
+	h := NewCDCHandler(internal.NewRelationSet(), out, CDCHandlerConfig{
+		TableKeys:          map[string]string{"table": "id"},
+		BufferTransactions: true,
+		TxSpillThreshold:   3,
+		TxSpillDir:         dir,
+	})
+
+	rel := testRelation(1, "table")
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 1}, 0))
+	is.NoErr(h.Handle(ctx, rel, 0))
+	for i := 1; i <= 10; i++ {
+		is.NoErr(h.Handle(ctx, testInsert(rel, fmt.Sprint(i), "foo"), pglogrepl.LSN(i)))
+	}
+	is.Equal(len(out), 0)
+
+	files, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 1)
+
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 11))
+	is.Equal(len(out), 10)
+	for i := 1; i <= 10; i++ {
+		rec := <-out
+		is.Equal(rec.Key, sdk.StructuredData{"id": int64(i)})
+	}
+
+	files, err = os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+
+	// an incomplete transaction is removed on close
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 2}, 12))
+	for i := 1; i <= 5; i++ {
+		is.NoErr(h.Handle(ctx, testInsert(rel, fmt.Sprint(i), "foo"), pglogrepl.LSN(12+i)))
+	}
+	files, err = os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 1)
+
+	is.NoErr(h.Close())
+	files, err = os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+}
@@ -17,38 +17,370 @@ func (Config) Parameters() map[string]sdk.Parameter {
 				sdk.ValidationInclusion{List: []string{"auto", "logrepl"}},
 			},
 		},
+		"columnRenames.*": {
+			Default:     "",
+			Description: "columnRenames maps columns in the form \"table.column\" to the name they get in records, e.g.: \"columnRenames.orders.created_at\": \"createdAt\". Tables can be qualified with their schema, e.g. \"columnRenames.sales.orders.created_at\".",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"floatSpecials": {
+			Default:     "string",
+			Description: "floatSpecials determines how the special values NaN, Infinity and -Infinity of float4 and float8 columns are written in payloads, as strings, as null or as floats, which can't be encoded as JSON.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"string", "null", "float"}},
+			},
+		},
+		"intervalMode": {
+			Default:     "raw",
+			Description: "intervalMode determines how interval values are written in payloads, either as decoded or as their months, days and microseconds.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"raw", "components"}},
+			},
+		},
+		"keyColumns.*": {
+			Default:     "",
+			Description: "keyColumns maps table names to the column that should be used as the record key, e.g.: \"keyColumns.orders\": \"order_no\". The columns of a composite key are separated by a comma. Tables without an entry use their primary key.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"keyHash": {
+			Default:     "false",
+			Description: "keyHash determines if records should contain a stable hash of their key in the metadata field postgres.keyHash, e.g. for sinks sharding records by a fixed-width value.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"keyIndexes.*": {
+			Default:     "",
+			Description: "keyIndexes maps table names to a unique index whose columns should be used as the record key, e.g.: \"keyIndexes.orders\": \"orders_order_no_key\". The index can't be partial or contain expressions.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.approxSize": {
+			Default:     "false",
+			Description: "logrepl.approxSize determines if the approximate size of the payload serialized as JSON is added to the metadata field postgres.approxSize of each CDC record.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
 		"logrepl.autoCleanup": {
 			Default:     "true",
 			Description: "logrepl.autoCleanup determines if the replication slot and publication should be removed when the connector is deleted.",
 			Type:        sdk.ParameterTypeBool,
 			Validations: []sdk.Validation{},
 		},
+		"logrepl.bufferTransactions": {
+			Default:     "false",
+			Description: "logrepl.bufferTransactions determines if the records of a transaction should be held back until the transaction is committed, which guarantees that records are emitted in commit order.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.coalesceUpdates": {
+			Default:     "0s",
+			Description: "logrepl.coalesceUpdates is the window for which updates are held back, so that only the latest update per key is emitted. Updates are not coalesced if set to 0.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.columnDefaults": {
+			Default:     "false",
+			Description: "logrepl.columnDefaults determines if the default value expressions of columns should be included in the Debezium-style schema. Requires LogreplDebeziumSchema or LogreplSchemaRecords to be enabled.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.commitMarkers": {
+			Default:     "false",
+			Description: "logrepl.commitMarkers determines if a record marking the commit of each transaction should be emitted after its changes. Commit markers have no key and payload and contain the metadata fields postgres.commitLSN and postgres.commitTime.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.commitTime": {
+			Default:     "false",
+			Description: "logrepl.commitTime determines if the commit time of the transaction is added to the metadata field postgres.commitTime of each CDC record.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.debeziumSchema": {
+			Default:     "false",
+			Description: "logrepl.debeziumSchema determines if a Debezium-style schema describing the payload should be attached to each record in metadata.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.defaultSchema": {
+			Default:     "",
+			Description: "logrepl.defaultSchema is reported in the metadata field postgres.namespace for tables whose schema is empty or pg_catalog, for which Postgres does not report a clear schema.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.dropNoopUpdates": {
+			Default:     "false",
+			Description: "logrepl.dropNoopUpdates determines if updates which did not change any value should be dropped. Requires tables with REPLICA IDENTITY FULL, updates of other tables are always emitted.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.explicitInsertBefore": {
+			Default:     "false",
+			Description: "logrepl.explicitInsertBefore determines if inserts should contain an explicit null before image, so that all CDC records have the same payload structure as updates.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.extraPublications": {
+			Default:     "",
+			Description: "logrepl.extraPublications is a list of existing publications which are streamed together with the publication in logrepl.publicationName. Only changes in tables listed in tables are emitted.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.generatedColumns": {
+			Default:     "false",
+			Description: "logrepl.generatedColumns determines if generated columns should be detected and listed in the metadata of CDC records, so sinks know not to write them back.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.keepaliveCount": {
+			Default:     "0",
+			Description: "logrepl.keepaliveCount is the number of unanswered TCP keepalive probes after which a replication connection is considered dead. Only supported on Linux, the system default is used if set to 0.",
+			Type:        sdk.ParameterTypeInt,
+			Validations: []sdk.Validation{
+				sdk.ValidationGreaterThan{Value: -1},
+			},
+		},
+		"logrepl.keepaliveIdle": {
+			Default:     "0s",
+			Description: "logrepl.keepaliveIdle is the time a replication connection has to be idle before TCP keepalive probes are sent. The system default is used if set to 0.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.keepaliveInterval": {
+			Default:     "0s",
+			Description: "logrepl.keepaliveInterval is the time between TCP keepalive probes on replication connections. The system default is used if set to 0.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.keylessDeletes": {
+			Default:     "fail",
+			Description: "logrepl.keylessDeletes determines what happens with deletes which don't contain the old tuple, so the key of the deleted row is unknown. They either fail, are skipped with a warning or are emitted without a key.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"fail", "skip", "tombstone"}},
+			},
+		},
+		"logrepl.maxRecordsPerSecond": {
+			Default:     "0",
+			Description: "logrepl.maxRecordsPerSecond caps the number of CDC records emitted per second across all tables, to protect downstream systems. If 0, the rate is not limited.",
+			Type:        sdk.ParameterTypeInt,
+			Validations: []sdk.Validation{
+				sdk.ValidationGreaterThan{Value: -1},
+			},
+		},
+		"logrepl.metadataPrefix": {
+			Default:     "postgres.",
+			Description: "logrepl.metadataPrefix is the prefix of Postgres specific metadata keys in CDC records and of the key hash in snapshot records, e.g. \"pg.\" produces keys like \"pg.skippedColumns\".",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.nullKeySentinel": {
+			Default:     "__null__",
+			Description: "logrepl.nullKeySentinel is written to keys instead of NULL values, if logrepl.nullKeys is set to sentinel.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.nullKeys": {
+			Default:     "fail",
+			Description: "logrepl.nullKeys determines how NULL values in key columns of CDC records are handled, which are possible if the key column is not the primary key. The record either fails, gets the value of logrepl.nullKeySentinel or an explicit null in the key.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"fail", "sentinel", "null"}},
+			},
+		},
+		"logrepl.partialBeforeImage": {
+			Default:     "include",
+			Description: "logrepl.partialBeforeImage determines what happens with before images of updates which only contain some of the old values, e.g. only the key columns. They are either included and flagged in the metadata field postgres.partialBeforeImage, or dropped.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"include", "drop"}},
+			},
+		},
+		"logrepl.prevLSN": {
+			Default:     "false",
+			Description: "logrepl.prevLSN determines if the LSN of the previously emitted record is added to the metadata field postgres.prevLSN of each CDC record, so gaps can be detected.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.publicationMetadata": {
+			Default:     "false",
+			Description: "logrepl.publicationMetadata determines if the name of the publication a table is streamed from is added to the metadata field postgres.publication of each CDC record. Tables in multiple publications are attributed to the first one, in the order of publicationName and extraPublications.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
 		"logrepl.publicationName": {
 			Default:     "conduitpub",
 			Description: "logrepl.publicationName determines the publication name in case the connector uses logical replication to listen to changes (see CDCMode).",
 			Type:        sdk.ParameterTypeString,
 			Validations: []sdk.Validation{},
 		},
+		"logrepl.quarantineChanges": {
+			Default:     "false",
+			Description: "logrepl.quarantineChanges determines if changes which can't be decoded should be logged with the error and skipped, instead of stopping the connector.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.receivedAt": {
+			Default:     "false",
+			Description: "logrepl.receivedAt determines if the time the connector received the change is added to the metadata field postgres.receivedAt of each CDC record.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.relationChanges": {
+			Default:     "replace",
+			Description: "logrepl.relationChanges determines what happens if the column layout of a table changes while its relation is cached, e.g. after reconnecting to an altered table. The relation is either replaced after emitting pending changes or the connector fails.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"replace", "fail"}},
+			},
+		},
+		"logrepl.relationID": {
+			Default:     "false",
+			Description: "logrepl.relationID determines if the OID of the table is added to the metadata field postgres.relationID of each CDC record, so records can be correlated with pg_class.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.replayedChanges": {
+			Default:     "keep",
+			Description: "logrepl.replayedChanges determines what happens with changes which were already emitted before a restart. Postgres resends the transaction of the last position and transactions committed before it, changes up to the last position are either kept, dropped or marked with the metadata field postgres.replayed. Positions written by older versions of the connector don't contain the commit LSN, no changes are detected as replayed after resuming from them.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"keep", "drop", "mark"}},
+			},
+		},
+		"logrepl.requireBeforeImage": {
+			Default:     "false",
+			Description: "logrepl.requireBeforeImage determines if updates without the old values of all columns should stop the connector, instead of being emitted without a before image. Requires tables with REPLICA IDENTITY FULL.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.schemaRecords": {
+			Default:     "false",
+			Description: "logrepl.schemaRecords determines if the Debezium-style schema should be emitted in a separate record whenever the layout of a table is first seen or changes. CDC records then only reference the schema by its ID in the metadata field postgres.schemaId, instead of containing it. Schema records are emitted in the collection \"_schemas\", with the table in the metadata field postgres.table.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.sendRetries": {
+			Default:     "0",
+			Description: "logrepl.sendRetries is the number of times handing a record over to Conduit is retried while records are not consumed, before the connector fails. The wait starts with LogreplSendRetryBackoff and doubles with each attempt. If 0, the connector waits for as long as it takes.",
+			Type:        sdk.ParameterTypeInt,
+			Validations: []sdk.Validation{
+				sdk.ValidationGreaterThan{Value: -1},
+			},
+		},
+		"logrepl.sendRetryBackoff": {
+			Default:     "1s",
+			Description: "logrepl.sendRetryBackoff is the time the first attempt to hand a record over to Conduit waits, see LogreplSendRetries.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.skipDroppedTables": {
+			Default:     "false",
+			Description: "logrepl.skipDroppedTables determines if changes which can't be decoded because their table was dropped in the meantime should be skipped, instead of stopping the connector.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.skipTransactions": {
+			Default:     "",
+			Description: "logrepl.skipTransactions is a list of transaction IDs (XIDs) whose changes are dropped instead of being emitted, e.g. to get past a transaction which can't be decoded.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
 		"logrepl.slotName": {
 			Default:     "conduitslot",
 			Description: "logrepl.slotName determines the replication slot name in case the connector uses logical replication to listen to changes (see CDCMode).",
 			Type:        sdk.ParameterTypeString,
 			Validations: []sdk.Validation{},
 		},
+		"logrepl.startupTimeout": {
+			Default:     "0s",
+			Description: "logrepl.startupTimeout bounds the time it takes to set up logical replication and start streaming changes. There is no timeout if set to 0.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.statementTimeout": {
+			Default:     "0s",
+			Description: "logrepl.statementTimeout is the statement_timeout of the connections used to create and drop the publication and replication slot, so that statements waiting for a lock held by another session fail instead of blocking. There is no timeout if set to 0.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.statusInterval": {
+			Default:     "10s",
+			Description: "logrepl.statusInterval is the time between standby status updates sent to Postgres. It is lowered to half of the wal_sender_timeout of the server if it's not shorter than the timeout.",
+			Type:        sdk.ParameterTypeDuration,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.transactionSpillDir": {
+			Default:     "",
+			Description: "logrepl.transactionSpillDir is the directory used for spilled transaction records. Defaults to the directory for temporary files of the system.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"logrepl.transactionSpillThreshold": {
+			Default:     "0",
+			Description: "logrepl.transactionSpillThreshold is the number of records of a buffered transaction kept in memory, further records are spilled to disk until the transaction is committed. If 0, all records are kept in memory.",
+			Type:        sdk.ParameterTypeInt,
+			Validations: []sdk.Validation{
+				sdk.ValidationGreaterThan{Value: -1},
+			},
+		},
+		"logrepl.unsupportedTypes": {
+			Default:     "raw",
+			Description: "logrepl.unsupportedTypes determines how values of types unknown to the connector are handled: \"fail\" stops the connector, \"raw\" passes the value through as a string and \"skip\" leaves the column out of the payload.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{
+				sdk.ValidationInclusion{List: []string{"fail", "raw", "skip"}},
+			},
+		},
+		"logrepl.warnExcludedColumns": {
+			Default:     "false",
+			Description: "logrepl.warnExcludedColumns determines if a warning should be logged for columns which are not replicated, e.g. columns added to a table after the publication was created with a column list. The columns are listed in the metadata field postgres.excludedColumns of CDC records.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
 		"snapshot.fetchSize": {
 			Default:     "50000",
 			Description: "Snapshot fetcher size determines the number of rows to retrieve at a time.",
 			Type:        sdk.ParameterTypeInt,
 			Validations: []sdk.Validation{},
 		},
+		"snapshot.parallelism": {
+			Default:     "0",
+			Description: "snapshot.parallelism is the maximum number of tables read concurrently in the snapshot. All tables are read from the same snapshot. 0 reads all tables at once.",
+			Type:        sdk.ParameterTypeInt,
+			Validations: []sdk.Validation{
+				sdk.ValidationGreaterThan{Value: -1},
+			},
+		},
+		"snapshot.sequences": {
+			Default:     "false",
+			Description: "snapshot.sequences emits the latest values of sequences owned by the tables (e.g. of serial columns) as records before the snapshot rows.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
 		"snapshotMode": {
 			Default:     "initial",
 			Description: "snapshotMode is whether the plugin will take a snapshot of the entire table before starting cdc mode.",
 			Type:        sdk.ParameterTypeString,
 			Validations: []sdk.Validation{
-				sdk.ValidationInclusion{List: []string{"initial", "never"}},
+				sdk.ValidationInclusion{List: []string{"initial", "never", "only"}},
 			},
 		},
+		"staticMetadata.*": {
+			Default:     "",
+			Description: "staticMetadata is added to the metadata of every record, e.g.: \"staticMetadata.environment\": \"production\".",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"staticMetadataOverwrite": {
+			Default:     "false",
+			Description: "staticMetadataOverwrite determines if StaticMetadata takes precedence over metadata set by the connector with the same key.",
+			Type:        sdk.ParameterTypeBool,
+			Validations: []sdk.Validation{},
+		},
 		"table": {
 			Default:     "",
 			Description: "Deprecated: use `tables` instead.",
@@ -61,6 +393,18 @@ func (Config) Parameters() map[string]sdk.Parameter {
 			Type:        sdk.ParameterTypeString,
 			Validations: []sdk.Validation{},
 		},
+		"tls.channelBinding": {
+			Default:     "",
+			Description: "tls.channelBinding overrides the channel_binding parameter of the URL, which controls SCRAM channel binding on TLS connections. One of \"disable\", \"prefer\" or \"require\", the URL is used as it is if empty.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
+		"tls.serverName": {
+			Default:     "",
+			Description: "tls.serverName overrides the server name sent in the TLS handshake (SNI) and used to verify the certificate of the server, which some providers use to route connections. Defaults to the host in the URL, it's only used if the URL enables TLS.",
+			Type:        sdk.ParameterTypeString,
+			Validations: []sdk.Validation{},
+		},
 		"url": {
 			Default:     "",
 			Description: "url is the connection string for the Postgres database.",
@@ -15,6 +15,7 @@
 package position
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 
@@ -24,6 +25,9 @@ import (
 
 //go:generate stringer -type=Type -trimprefix Type
 
+// Type is the phase of the connector a position was produced in. The values
+// are in the order of the phases, so positions of an earlier phase sort before
+// positions of a later phase, see Compare. New types have to keep this order.
 type Type int
 
 const (
@@ -36,12 +40,23 @@ type Position struct {
 	Type      Type              `json:"type"`
 	Snapshots SnapshotPositions `json:"snapshots,omitempty"`
 	LastLSN   string            `json:"last_lsn,omitempty"`
+	// LastCommitLSN is the commit LSN of the transaction of the change at
+	// LastLSN. Changes are emitted in commit order, so both LSNs together
+	// identify how far the stream was emitted.
+	LastCommitLSN string `json:"last_commit_lsn,omitempty"`
 }
 
+// SnapshotPositions contains the progress of the snapshot by table. Tables
+// which weren't read yet are not in the map.
 type SnapshotPositions map[string]SnapshotPosition
 
+// SnapshotPosition is the progress of the snapshot of a single table. A
+// restarted snapshot continues with the rows after LastRead, up to and
+// including SnapshotEnd.
 type SnapshotPosition struct {
-	LastRead    int64 `json:"last_read"`
+	// LastRead is the key of the last row read from the table.
+	LastRead int64 `json:"last_read"`
+	// SnapshotEnd is the largest key in the table when the snapshot started.
 	SnapshotEnd int64 `json:"snapshot_end"`
 }
 
@@ -80,3 +95,90 @@ func (p Position) LSN() (pglogrepl.LSN, error) {
 
 	return lsn, nil
 }
+
+// CommitLSN returns the last commit LSN in the position.
+func (p Position) CommitLSN() (pglogrepl.LSN, error) {
+	if p.LastCommitLSN == "" {
+		return 0, nil
+	}
+	return pglogrepl.ParseLSN(p.LastCommitLSN)
+}
+
+// Compare returns -1 if a sorts before b, 1 if a sorts after b and 0 if both
+// are equal or can't be ordered. Positions are ordered by phase first, so all
+// snapshot positions sort before all CDC positions. CDC positions are ordered
+// by LSN. Snapshot positions are ordered by the progress of the snapshot, a
+// position is before another one if no table was read further and at least
+// one table was read less far. Positions of the same snapshot always increase
+// that way.
+func Compare(a, b Position) (int, error) {
+	if a.Type != b.Type {
+		return cmp.Compare(a.Type, b.Type), nil
+	}
+
+	switch a.Type {
+	case TypeCDC:
+		aLSN, err := a.LSN()
+		if err != nil {
+			return 0, err
+		}
+		bLSN, err := b.LSN()
+		if err != nil {
+			return 0, err
+		}
+		return cmp.Compare(aLSN, bLSN), nil
+	case TypeSnapshot:
+		return compareSnapshots(a.Snapshots, b.Snapshots), nil
+	default:
+		return 0, nil
+	}
+}
+
+// compareSnapshots compares the progress of two snapshots. Tables which are
+// missing in a snapshot were not read at all.
+func compareSnapshots(a, b SnapshotPositions) int {
+	var before, after bool
+	for table, pa := range a {
+		pb, ok := b[table]
+		switch {
+		case !ok || pa.LastRead > pb.LastRead:
+			after = true
+		case pa.LastRead < pb.LastRead:
+			before = true
+		}
+	}
+	for table := range b {
+		if _, ok := a[table]; !ok {
+			before = true
+		}
+	}
+
+	switch {
+	case before && !after:
+		return -1
+	case after && !before:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Codec converts positions to SDK positions and back. It can be used to embed
+// additional state in SDK positions, as long as Decode returns the position
+// passed to Encode.
+type Codec interface {
+	Encode(Position) sdk.Position
+	Decode(sdk.Position) (Position, error)
+}
+
+// JSONCodec is the default Codec, it encodes positions as JSON, see
+// Position.ToSDKPosition and ParseSDKPosition.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(p Position) sdk.Position {
+	return p.ToSDKPosition()
+}
+
+func (JSONCodec) Decode(sdkPos sdk.Position) (Position, error) {
+	return ParseSDKPosition(sdkPos)
+}
@@ -15,9 +15,11 @@
 package position
 
 import (
+	"fmt"
 	"testing"
 
 	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
 	"github.com/matryer/is"
 )
 
@@ -53,6 +55,21 @@ func Test_PositionLSN(t *testing.T) {
 	is.Equal(uint64(lsn), uint64(17506309608))
 }
 
+func Test_PositionCommitLSN(t *testing.T) {
+	is := is.New(t)
+
+	lsn, err := Position{LastLSN: "4/137515E8"}.CommitLSN()
+	is.NoErr(err)
+	is.Equal(lsn, pglogrepl.LSN(0))
+
+	lsn, err = Position{LastCommitLSN: "4/137515F0"}.CommitLSN()
+	is.NoErr(err)
+	is.Equal(uint64(lsn), uint64(17506309616))
+
+	_, err = Position{LastCommitLSN: "invalid"}.CommitLSN()
+	is.True(err != nil)
+}
+
 func Test_ParseSDKPosition(t *testing.T) {
 	is := is.New(t)
 
@@ -77,3 +94,64 @@ func Test_ParseSDKPosition(t *testing.T) {
 	is.True(invalidErr != nil)
 	is.Equal(invalidErr.Error(), "invalid position: unexpected end of JSON input")
 }
+
+func Test_JSONCodec(t *testing.T) {
+	is := is.New(t)
+
+	p := Position{
+		Type:    TypeCDC,
+		LastLSN: "4/137515E8",
+	}
+
+	var codec Codec = JSONCodec{}
+	sdkPos := codec.Encode(p)
+	is.Equal(sdkPos, p.ToSDKPosition())
+
+	got, err := codec.Decode(sdkPos)
+	is.NoErr(err)
+	is.Equal(got, p)
+}
+
+func Test_Compare(t *testing.T) {
+	snapshot := func(lastRead ...int64) Position {
+		p := Position{Type: TypeSnapshot, Snapshots: SnapshotPositions{}}
+		for i, lr := range lastRead {
+			p.Snapshots[fmt.Sprintf("table%d", i)] = SnapshotPosition{LastRead: lr, SnapshotEnd: 100}
+		}
+		return p
+	}
+	cdc := func(lsn string) Position {
+		return Position{Type: TypeCDC, LastLSN: lsn}
+	}
+
+	tests := []struct {
+		name string
+		a, b Position
+		want int
+	}{
+		{name: "initial before snapshot", a: Position{}, b: snapshot(1), want: -1},
+		{name: "snapshot before cdc", a: snapshot(100, 100), b: cdc("0/1"), want: -1},
+		{name: "cdc after snapshot", a: cdc("0/1"), b: snapshot(1), want: 1},
+		{name: "cdc by lsn", a: cdc("0/16B3748"), b: cdc("0/16B3778"), want: -1},
+		{name: "cdc equal", a: cdc("0/16B3748"), b: cdc("0/16B3748"), want: 0},
+		{name: "snapshot progress", a: snapshot(1, 5), b: snapshot(2, 5), want: -1},
+		{name: "snapshot new table", a: snapshot(5), b: snapshot(5, 1), want: -1},
+		{name: "snapshot ahead", a: snapshot(3, 5), b: snapshot(2, 5), want: 1},
+		{name: "snapshot diverged", a: snapshot(3, 4), b: snapshot(2, 5), want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := Compare(tc.a, tc.b)
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+
+	t.Run("invalid lsn", func(t *testing.T) {
+		is := is.New(t)
+		_, err := Compare(cdc("invalid"), cdc("0/1"))
+		is.True(err != nil)
+	})
+}
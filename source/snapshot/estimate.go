@@ -0,0 +1,74 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RowEstimate is the estimated number of rows a snapshot of a table reads.
+type RowEstimate struct {
+	Table string
+	// Rows is the number of rows in the table. It is -1 if the table has no
+	// statistics yet, i.e. it was never vacuumed or analyzed, and the rows
+	// were not counted. This is the same on all Postgres versions, even
+	// though versions before 14 report 0 rows for such tables.
+	Rows int64
+	// Exact is true if the rows were counted instead of estimated.
+	Exact bool
+}
+
+// EstimateRows returns the number of rows per table, estimated from the planner
+// statistics in pg_class.reltuples. The estimate is as recent as the last
+// vacuum or analyze of the table. If exact is true, the rows are counted
+// instead, which scans each table and can take a while for large tables.
+func EstimateRows(ctx context.Context, db *pgxpool.Pool, tables []string, exact bool) ([]RowEstimate, error) {
+	estimates := make([]RowEstimate, 0, len(tables))
+	for _, table := range tables {
+		e := RowEstimate{Table: table, Exact: exact}
+		ident := pgx.Identifier(strings.Split(table, ".")).Sanitize()
+		if exact {
+			if err := db.QueryRow(ctx, "SELECT count(*) FROM "+ident).Scan(&e.Rows); err != nil {
+				return nil, fmt.Errorf("failed to count rows of table %q: %w", table, err)
+			}
+		} else {
+			// reltuples is -1 on Postgres 14+ and 0 on older versions for
+			// tables without statistics, the latter is told apart from an
+			// empty table by the table never being vacuumed or analyzed
+			err := db.QueryRow(
+				ctx,
+				`SELECT CASE
+					WHEN c.reltuples < 0 THEN -1
+					WHEN c.reltuples = 0 AND s.last_vacuum IS NULL AND s.last_autovacuum IS NULL
+						AND s.last_analyze IS NULL AND s.last_autoanalyze IS NULL THEN -1
+					ELSE c.reltuples::bigint
+				END
+				FROM pg_class c LEFT JOIN pg_stat_all_tables s ON s.relid = c.oid
+				WHERE c.oid = to_regclass($1)`,
+				ident,
+			).Scan(&e.Rows)
+			if err != nil {
+				return nil, fmt.Errorf("failed to estimate rows of table %q: %w", table, err)
+			}
+		}
+		estimates = append(estimates, e)
+	}
+	return estimates, nil
+}
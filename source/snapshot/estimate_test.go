@@ -0,0 +1,113 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/test"
+	"github.com/matryer/is"
+)
+
+func Test_EstimateRows(t *testing.T) {
+	var (
+		is    = is.New(t)
+		ctx   = context.Background()
+		pool  = test.ConnectPool(ctx, t, test.RegularConnString)
+		table = test.SetupTestTable(ctx, t, pool)
+	)
+
+	_, err := pool.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s (id, column1) SELECT g, 'foo' FROM generate_series(5, 1000) g", table,
+	))
+	is.NoErr(err)
+	_, err = pool.Exec(ctx, "ANALYZE "+table)
+	is.NoErr(err)
+
+	got, err := EstimateRows(ctx, pool, []string{table}, false)
+	is.NoErr(err)
+	is.Equal(len(got), 1)
+	is.Equal(got[0].Table, table)
+	is.True(!got[0].Exact)
+	// the statistics of small tables are based on all rows, allow some
+	// leeway anyway
+	is.True(got[0].Rows > 900 && got[0].Rows < 1100)
+
+	// rows inserted after the analyze are only seen by exact counts
+	_, err = pool.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s (id, column1) SELECT g, 'foo' FROM generate_series(1001, 1010) g", table,
+	))
+	is.NoErr(err)
+
+	got, err = EstimateRows(ctx, pool, []string{table}, true)
+	is.NoErr(err)
+	is.Equal(got, []RowEstimate{{Table: table, Rows: 1010, Exact: true}})
+}
+
+func Test_EstimateRows_NoStatistics(t *testing.T) {
+	var (
+		is    = is.New(t)
+		ctx   = context.Background()
+		pool  = test.ConnectPool(ctx, t, test.RegularConnString)
+		table = test.SetupTestTable(ctx, t, pool)
+	)
+
+	// the table was never vacuumed or analyzed, on all Postgres versions
+	_, err := pool.Exec(ctx, "CREATE TABLE "+table+"_empty (id bigint)")
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := pool.Exec(ctx, "DROP TABLE "+table+"_empty")
+		is.NoErr(err)
+	})
+
+	got, err := EstimateRows(ctx, pool, []string{table + "_empty"}, false)
+	is.NoErr(err)
+	is.Equal(got[0].Rows, int64(-1))
+}
+
+func Test_EstimateRows_QuotedTable(t *testing.T) {
+	var (
+		is   = is.New(t)
+		ctx  = context.Background()
+		pool = test.ConnectPool(ctx, t, test.RegularConnString)
+	)
+
+	// the name is quoted, it would be folded to lower case otherwise
+	_, err := pool.Exec(ctx, `CREATE TABLE public."EstimateRows" (id bigint)`)
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := pool.Exec(ctx, `DROP TABLE public."EstimateRows"`)
+		is.NoErr(err)
+	})
+	_, err = pool.Exec(ctx, `INSERT INTO public."EstimateRows" SELECT generate_series(1, 3)`)
+	is.NoErr(err)
+
+	got, err := EstimateRows(ctx, pool, []string{"public.EstimateRows"}, true)
+	is.NoErr(err)
+	is.Equal(got, []RowEstimate{{Table: "public.EstimateRows", Rows: 3, Exact: true}})
+}
+
+func Test_EstimateRows_MissingTable(t *testing.T) {
+	var (
+		is   = is.New(t)
+		ctx  = context.Background()
+		pool = test.ConnectPool(ctx, t, test.RegularConnString)
+	)
+
+	_, err := EstimateRows(ctx, pool, []string{"missing_table"}, false)
+	is.True(err != nil)
+}
@@ -27,6 +27,7 @@ import (
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -39,11 +40,21 @@ var supportedKeyTypes = []string{
 }
 
 type FetchConfig struct {
-	Table        string
-	Key          string
+	Table string
+	Key   string
+	// Renames maps columns to the names they get in records.
+	Renames      map[string]string
 	TXSnapshotID string
 	FetchSize    int
 	Position     position.Position
+	// IntervalComponents writes intervals in payloads as their months, days
+	// and microseconds.
+	IntervalComponents bool
+	// FloatSpecials replaces the special values NaN, Infinity and -Infinity
+	// of floats in payloads, if set.
+	FloatSpecials func(name string) any
+	// WithKeyHash sets FetchData.KeyHash.
+	WithKeyHash bool
 }
 
 var (
@@ -72,11 +83,28 @@ func (c FetchConfig) Validate() error {
 	return errors.Join(errs...)
 }
 
+const (
+	// DefaultMetadataPrefix is the prefix of Postgres specific metadata keys,
+	// unless it is replaced with Config.MetadataPrefix.
+	DefaultMetadataPrefix = "postgres."
+	// MetadataKeyHash is the metadata key containing the hash of the record
+	// key, see Config.WithKeyHash.
+	MetadataKeyHash = DefaultMetadataPrefix + "keyHash"
+	// MetadataDatabase is the metadata key containing the name of the
+	// database, like in CDC records.
+	MetadataDatabase = DefaultMetadataPrefix + "database"
+	// MetadataSystemIdentifier is the metadata key containing the system
+	// identifier of the cluster, like in CDC records.
+	MetadataSystemIdentifier = DefaultMetadataPrefix + "systemIdentifier"
+)
+
 type FetchData struct {
 	Key      sdk.StructuredData
 	Payload  sdk.StructuredData
 	Position position.SnapshotPosition
 	Table    string
+	// KeyHash is the hash of the key, if FetchConfig.WithKeyHash is set.
+	KeyHash string
 }
 
 type FetchWorker struct {
@@ -87,6 +115,9 @@ type FetchWorker struct {
 	snapshotEnd int64
 	lastRead    int64
 	cursorName  string
+	// fullScan is set if the key can't be used to paginate the table. The
+	// table is then read with a single cursor, from the start after a restart.
+	fullScan bool
 }
 
 func NewFetchWorker(db *pgxpool.Pool, out chan<- FetchData, c FetchConfig) *FetchWorker {
@@ -137,9 +168,11 @@ func (f *FetchWorker) Validate(ctx context.Context) error {
 		return fmt.Errorf("failed to validate table: %w", err)
 	}
 
-	if err := f.validateKey(ctx, f.conf.Table, f.conf.Key, tx); err != nil {
+	paginate, err := f.validateKey(ctx, f.conf.Table, f.conf.Key, tx)
+	if err != nil {
 		return fmt.Errorf("failed to validate key: %w", err)
 	}
+	f.fullScan = !paginate
 
 	return nil
 }
@@ -166,7 +199,13 @@ func (f *FetchWorker) Run(ctx context.Context) error {
 		return err
 	}
 
-	if err := f.updateSnapshotEnd(ctx, tx); err != nil {
+	if f.fullScan {
+		closeCursor, err := f.createCursor(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+		defer closeCursor()
+	} else if err := f.updateSnapshotEnd(ctx, tx); err != nil {
 		return fmt.Errorf("failed to update fetch limit: %w", err)
 	}
 
@@ -175,14 +214,9 @@ func (f *FetchWorker) Run(ctx context.Context) error {
 		Str("tx.snapshot", f.conf.TXSnapshotID).
 		Int64("startAt", f.lastRead).
 		Int64("snapshotEnd", f.snapshotEnd).
+		Bool("fullScan", f.fullScan).
 		Msgf("starting fetcher %s", f.cursorName)
 
-	closeCursor, err := f.createCursor(ctx, tx)
-	if err != nil {
-		return fmt.Errorf("failed to create cursor: %w", err)
-	}
-	defer closeCursor()
-
 	var nfetched int
 
 	for {
@@ -212,15 +246,10 @@ func (f *FetchWorker) Run(ctx context.Context) error {
 	return nil
 }
 
+// createCursor declares the cursor used to read tables without a key that can
+// be used to paginate them.
 func (f *FetchWorker) createCursor(ctx context.Context, tx pgx.Tx) (func(), error) {
-	// This query will scan the table for rows based on the conditions.
-	selectQuery := fmt.Sprintf(
-		"SELECT * FROM %s WHERE %s > %d AND %s <= %d ORDER BY %s",
-		f.conf.Table,
-		f.conf.Key, f.lastRead, // range start
-		f.conf.Key, f.snapshotEnd, // range end,
-		f.conf.Key, // order by
-	)
+	selectQuery := "SELECT * FROM " + f.conf.Table
 
 	cursorQuery := fmt.Sprintf("DECLARE %s CURSOR FOR(%s)", f.cursorName, selectQuery)
 
@@ -253,8 +282,25 @@ func (f *FetchWorker) updateSnapshotEnd(ctx context.Context, tx pgx.Tx) error {
 	return nil
 }
 
+// fetchQuery returns the query for the next batch of rows. Tables are paginated
+// by their key, each page starts after the last key read.
+func (f *FetchWorker) fetchQuery() string {
+	if f.fullScan {
+		return fmt.Sprintf("FETCH %d FROM %s", f.conf.FetchSize, f.cursorName)
+	}
+
+	return fmt.Sprintf(
+		"SELECT * FROM %s WHERE %s > %d AND %s <= %d ORDER BY %s LIMIT %d",
+		f.conf.Table,
+		f.conf.Key, f.lastRead, // range start
+		f.conf.Key, f.snapshotEnd, // range end
+		f.conf.Key,       // order by
+		f.conf.FetchSize, // page size
+	)
+}
+
 func (f *FetchWorker) fetch(ctx context.Context, tx pgx.Tx) (int, error) {
-	rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM %s", f.conf.FetchSize, f.cursorName))
+	rows, err := tx.Query(ctx, f.fetchQuery())
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch rows: %w", err)
 	}
@@ -272,6 +318,9 @@ func (f *FetchWorker) fetch(ctx context.Context, tx pgx.Tx) (int, error) {
 		if err != nil {
 			return 0, fmt.Errorf("failed to get values: %w", err)
 		}
+		if err := scanArrays(rows, values); err != nil {
+			return 0, fmt.Errorf("failed to get values: %w", err)
+		}
 
 		data, err := f.buildFetchData(fields, values)
 		if err != nil {
@@ -282,6 +331,7 @@ func (f *FetchWorker) fetch(ctx context.Context, tx pgx.Tx) (int, error) {
 			return nread, fmt.Errorf("failed to send record: %w", err)
 		}
 
+		f.lastRead = data.Position.LastRead
 		nread++
 	}
 	if rows.Err() != nil {
@@ -291,6 +341,33 @@ func (f *FetchWorker) fetch(ctx context.Context, tx pgx.Tx) (int, error) {
 	return nread, nil
 }
 
+// scanArrays replaces the values of array columns with pgtype.Array[any].
+// Rows.Values flattens multidimensional arrays, the dimensions are needed to
+// format them as nested slices like in CDC records.
+func scanArrays(rows pgx.Rows, values []any) error {
+	m := rows.Conn().TypeMap()
+	raw := rows.RawValues()
+	for i, fd := range rows.FieldDescriptions() {
+		if raw[i] == nil {
+			continue
+		}
+		dt, ok := m.TypeForOID(fd.DataTypeOID)
+		if !ok {
+			continue
+		}
+		if _, ok := dt.Codec.(*pgtype.ArrayCodec); !ok {
+			continue
+		}
+
+		var arr pgtype.Array[any]
+		if err := m.Scan(fd.DataTypeOID, fd.Format, raw[i], &arr); err != nil {
+			return fmt.Errorf("failed to scan array %q: %w", fd.Name, err)
+		}
+		values[i] = arr
+	}
+	return nil
+}
+
 func (f *FetchWorker) send(ctx context.Context, d FetchData) error {
 	select {
 	case <-ctx.Done():
@@ -311,15 +388,29 @@ func (f *FetchWorker) buildFetchData(fields []string, values []any) (FetchData,
 		return FetchData{}, fmt.Errorf("failed to encode record data: %w", err)
 	}
 
+	var keyHash string
+	if f.conf.WithKeyHash {
+		if keyHash, err = types.HashKey(key); err != nil {
+			return FetchData{}, fmt.Errorf("failed to hash key: %w", err)
+		}
+	}
+
 	return FetchData{
 		Key:      key,
 		Payload:  payload,
 		Position: pos,
 		Table:    f.conf.Table,
+		KeyHash:  keyHash,
 	}, nil
 }
 
 func (f *FetchWorker) buildSnapshotPosition(fields []string, values []any) (position.SnapshotPosition, error) {
+	if f.fullScan {
+		// there is no progress to track, the table is read again if the
+		// snapshot is restarted
+		return position.SnapshotPosition{}, nil
+	}
+
 	for i, name := range fields {
 		if name == f.conf.Key {
 			// Always coerce snapshot position to bigint, pk may be any type of integer.
@@ -342,24 +433,48 @@ func (f *FetchWorker) buildRecordData(fields []string, values []any) (sdk.Struct
 		payload = make(sdk.StructuredData)
 	)
 
+	keyColumns := strings.Split(f.conf.Key, ",")
 	for i, name := range fields {
 		v, err := types.Format(values[i])
 		if err != nil {
 			return key, payload, fmt.Errorf("failed to format payload field %q: %w", name, err)
 		}
-		payload[name] = v
-	}
+		if f.conf.IntervalComponents {
+			v = types.Interval.WithComponents(v)
+		}
+		if f.conf.FloatSpecials != nil {
+			v = types.Float.ReplaceSpecials(v, f.conf.FloatSpecials)
+		}
+		payload[f.columnName(name)] = v
 
-	k, err := types.Format(payload[f.conf.Key])
-	if err != nil {
-		return key, payload, fmt.Errorf("failed to format key %q: %w", f.conf.Key, err)
+		if slices.Contains(keyColumns, name) {
+			// keys are formatted the same way as in CDC records
+			k, err := types.FormatKey(values[i])
+			if err != nil {
+				return key, payload, fmt.Errorf("failed to format key %q: %w", name, err)
+			}
+			key[f.columnName(name)] = k
+		}
 	}
 
-	key[f.conf.Key] = k
+	for _, col := range keyColumns {
+		if _, ok := key[f.columnName(col)]; !ok {
+			key[f.columnName(col)] = nil
+		}
+	}
 
 	return key, payload, nil
 }
 
+// columnName returns the name of the column in records, i.e. the new name if
+// the column is renamed.
+func (f *FetchWorker) columnName(column string) string {
+	if renamed, ok := f.conf.Renames[column]; ok {
+		return renamed
+	}
+	return column
+}
+
 func (f *FetchWorker) withSnapshot(ctx context.Context, tx pgx.Tx) error {
 	if f.conf.TXSnapshotID == "" {
 		sdk.Logger(ctx).Warn().
@@ -377,7 +492,21 @@ func (f *FetchWorker) withSnapshot(ctx context.Context, tx pgx.Tx) error {
 	return nil
 }
 
-func (*FetchWorker) validateKey(ctx context.Context, table, key string, tx pgx.Tx) error {
+// validateKey checks that the key exists and returns true if it can be used to
+// paginate the table, which requires a single integer column with unique values,
+// i.e. the primary key or a column with a unique, non-partial index which can't
+// be NULL. Pages start after the last key read, so rows sharing a key value at
+// the boundary of a page would be skipped otherwise.
+//
+// Composite keys are read with a single cursor, as snapshot positions only
+// hold a single integer key.
+func (*FetchWorker) validateKey(ctx context.Context, table, key string, tx pgx.Tx) (bool, error) {
+	if strings.Contains(key, ",") {
+		sdk.Logger(ctx).Warn().
+			Msgf("composite key %q can't be used to paginate table %q, reading it with a single cursor", key, table)
+		return false, nil
+	}
+
 	var dataType string
 
 	if err := tx.QueryRow(
@@ -387,35 +516,41 @@ func (*FetchWorker) validateKey(ctx context.Context, table, key string, tx pgx.T
 		key, table,
 	).Scan(&dataType); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return fmt.Errorf("key %q not present on table %q", key, table)
+			return false, fmt.Errorf("key %q not present on table %q", key, table)
 		}
-		return fmt.Errorf("unable to check key %q on table %q: %w", key, table, err)
+		return false, fmt.Errorf("unable to check key %q on table %q: %w", key, table, err)
 	}
 
 	if !slices.Contains(supportedKeyTypes, dataType) {
-		return fmt.Errorf("key %q of type %q is unsupported", key, dataType)
+		sdk.Logger(ctx).Warn().
+			Msgf("key %q of type %q can't be used to paginate table %q, reading it with a single cursor", key, dataType, table)
+		return false, nil
 	}
 
-	var isPK bool
+	var isUnique bool
 
-	// As per https://wiki.postgresql.org/wiki/Retrieve_primary_key_columns
+	// As per https://wiki.postgresql.org/wiki/Retrieve_primary_key_columns,
+	// extended to unique indexes on the column alone
 	if err := tx.QueryRow(
 		ctx,
 		`SELECT EXISTS(SELECT a.attname FROM pg_index i
-			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
-			WHERE i.indrelid = $1::regclass AND a.attname = $2 AND i.indisprimary)`,
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+			WHERE i.indrelid = $1::regclass AND a.attname = $2
+			  AND i.indnkeyatts = 1
+			  AND (i.indisprimary OR (i.indisunique AND a.attnotnull))
+			  AND i.indpred IS NULL AND i.indexprs IS NULL)`,
 		table, key,
-	).Scan(&isPK); err != nil {
-		return fmt.Errorf("unable to determine key %q constraints: %w", key, err)
+	).Scan(&isUnique); err != nil {
+		return false, fmt.Errorf("unable to determine key %q constraints: %w", key, err)
 	}
 
-	if !isPK {
+	if !isUnique {
 		sdk.Logger(ctx).Warn().
-			Err(fmt.Errorf("column %q is not a primary key", key)).
-			Msg("this may cause unexpected behavior if the key is not unique")
+			Msgf("key %q is not the primary key or a unique, non-nullable column of table %q, reading it with a single cursor", key, table)
+		return false, nil
 	}
 
-	return nil
+	return true, nil
 }
 
 func (*FetchWorker) validateTable(ctx context.Context, table string, tx pgx.Tx) error {
@@ -18,15 +18,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/source/position"
+	"github.com/conduitio/conduit-connector-postgres/source/types"
 	"github.com/conduitio/conduit-connector-postgres/test"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/google/go-cmp/cmp"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/matryer/is"
 	"gopkg.in/tomb.v2"
@@ -162,8 +165,22 @@ func Test_FetcherValidate(t *testing.T) {
 		}
 
 		err := f.Validate(ctx)
-		is.True(err != nil)
-		is.True(strings.Contains(err.Error(), `failed to validate key: key "column3" of type "boolean" is unsupported`))
+		is.NoErr(err) // no error, the table is read with a single cursor
+		is.True(f.fullScan)
+	})
+
+	t.Run("composite key", func(t *testing.T) {
+		is := is.New(t)
+		f := FetchWorker{
+			db: pool,
+			conf: FetchConfig{
+				Table: table,
+				Key:   "id,column1",
+			},
+		}
+
+		is.NoErr(f.Validate(ctx))
+		is.True(f.fullScan)
 	})
 
 	t.Run("key is not pk", func(t *testing.T) {
@@ -177,7 +194,46 @@ func Test_FetcherValidate(t *testing.T) {
 		}
 
 		err := f.Validate(ctx)
-		is.NoErr(err) // no error, only a warning
+		is.NoErr(err) // no error, the table is read with a single cursor
+		is.True(f.fullScan)
+	})
+
+	t.Run("key with unique index", func(t *testing.T) {
+		is := is.New(t)
+
+		unique := test.RandomIdentifier(t)
+		_, err := pool.Exec(ctx, fmt.Sprintf(
+			"CREATE TABLE %s (id bigint, uid bigint NOT NULL, nullable bigint, partial bigint NOT NULL)", unique,
+		))
+		is.NoErr(err)
+		t.Cleanup(func() {
+			_, err := pool.Exec(context.Background(), "DROP TABLE "+unique)
+			is.NoErr(err)
+		})
+		for _, stmt := range []string{
+			"CREATE UNIQUE INDEX ON %s (uid)",
+			"CREATE UNIQUE INDEX ON %s (nullable)",
+			"CREATE UNIQUE INDEX ON %s (partial) WHERE partial > 0",
+		} {
+			_, err = pool.Exec(ctx, fmt.Sprintf(stmt, unique))
+			is.NoErr(err)
+		}
+
+		for key, wantFullScan := range map[string]bool{
+			"uid":      false,
+			"nullable": true,
+			"partial":  true,
+		} {
+			f := FetchWorker{
+				db: pool,
+				conf: FetchConfig{
+					Table: unique,
+					Key:   key,
+				},
+			}
+			is.NoErr(f.Validate(ctx))
+			is.Equal(f.fullScan, wantFullScan)
+		}
 	})
 
 	t.Run("missing key", func(t *testing.T) {
@@ -316,6 +372,146 @@ func Test_FetcherRun_Resume(t *testing.T) {
 	is.Equal(dd[0].Table, table)
 }
 
+func Test_FetcherRun_Pages(t *testing.T) {
+	var (
+		pool  = test.ConnectPool(context.Background(), t, test.RegularConnString)
+		table = test.SetupTestTable(context.Background(), t, pool)
+		is    = is.New(t)
+		out   = make(chan FetchData)
+		ctx   = context.Background()
+		tt    = &tomb.Tomb{}
+	)
+
+	_, err := pool.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s (column1) SELECT 'row' || g FROM generate_series(5, 1000) g",
+		table,
+	))
+	is.NoErr(err)
+
+	f := NewFetchWorker(pool, out, FetchConfig{
+		Table:     table,
+		Key:       "id",
+		FetchSize: 64,
+	})
+
+	tt.Go(func() error {
+		ctx = tt.Context(ctx)
+		defer close(out)
+
+		if err := f.Validate(ctx); err != nil {
+			return err
+		}
+		return f.Run(ctx)
+	})
+
+	var dd []FetchData
+	for d := range out {
+		dd = append(dd, d)
+	}
+
+	is.NoErr(tt.Err())
+	is.Equal(len(dd), 1000)
+
+	// rows are read in order of the key across pages
+	for i, d := range dd {
+		is.Equal(d.Key, sdk.StructuredData{"id": int64(i + 1)})
+		is.Equal(d.Position, position.SnapshotPosition{
+			LastRead:    int64(i + 1),
+			SnapshotEnd: 1000,
+		})
+	}
+	is.Equal(f.lastRead, int64(1000))
+}
+
+func Test_FetcherRun_FullScan(t *testing.T) {
+	var (
+		pool  = test.ConnectPool(context.Background(), t, test.RegularConnString)
+		table = test.SetupTestTable(context.Background(), t, pool)
+		is    = is.New(t)
+		out   = make(chan FetchData)
+		ctx   = context.Background()
+		tt    = &tomb.Tomb{}
+	)
+
+	// the boolean key can't be used to paginate the table
+	f := NewFetchWorker(pool, out, FetchConfig{
+		Table:     table,
+		Key:       "column3",
+		FetchSize: 3,
+	})
+
+	tt.Go(func() error {
+		ctx = tt.Context(ctx)
+		defer close(out)
+
+		if err := f.Validate(ctx); err != nil {
+			return err
+		}
+		return f.Run(ctx)
+	})
+
+	var dd []FetchData
+	for d := range out {
+		dd = append(dd, d)
+	}
+
+	is.NoErr(tt.Err())
+	is.True(f.fullScan)
+	is.Equal(len(dd), 4)
+	for _, d := range dd {
+		is.Equal(d.Position, position.SnapshotPosition{})
+	}
+}
+
+func Test_FetcherRun_MultidimensionalArray(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		pool  = test.ConnectPool(ctx, t, test.RegularConnString)
+		table = test.RandomIdentifier(t)
+		is    = is.New(t)
+		out   = make(chan FetchData)
+		tt    = &tomb.Tomb{}
+	)
+
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s (id bigint PRIMARY KEY, matrix numeric[][])`, table))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := pool.Exec(context.Background(), "DROP TABLE "+table)
+		is.NoErr(err)
+	})
+	_, err = pool.Exec(ctx, fmt.Sprintf(`INSERT INTO %s VALUES (1, '{{1.5,2},{3,4.5}}')`, table))
+	is.NoErr(err)
+
+	f := NewFetchWorker(pool, out, FetchConfig{
+		Table:     table,
+		Key:       "id",
+		FetchSize: 2,
+	})
+
+	tt.Go(func() error {
+		ctx = tt.Context(ctx)
+		defer close(out)
+
+		if err := f.Validate(ctx); err != nil {
+			return err
+		}
+		return f.Run(ctx)
+	})
+
+	var dd []FetchData
+	for d := range out {
+		dd = append(dd, d)
+	}
+
+	is.NoErr(tt.Err())
+	is.Equal(len(dd), 1)
+	// the dimensions are kept, like in CDC records
+	is.Equal(dd[0].Payload["matrix"], []any{
+		[]any{1.5, int64(2)},
+		[]any{int64(3), 4.5},
+	})
+}
+
 func Test_withSnapshot(t *testing.T) {
 	var (
 		is   = is.New(t)
@@ -422,6 +618,123 @@ func Test_FetchWorker_buildRecordData(t *testing.T) {
 	is.Equal(key["id"], 1)
 }
 
+func Test_FetchWorker_buildRecordDataRenames(t *testing.T) {
+	is := is.New(t)
+
+	key, payload, err := (&FetchWorker{
+		conf: FetchConfig{
+			Table:   "mytable",
+			Key:     "id",
+			Renames: map[string]string{"id": "ID", "created_at": "createdAt"},
+		},
+	}).buildRecordData([]string{"id", "created_at", "name"}, []any{1, "2024", "foo"})
+
+	is.NoErr(err)
+	is.Equal(key, sdk.StructuredData{"ID": 1})
+	is.Equal(payload, sdk.StructuredData{"ID": 1, "createdAt": "2024", "name": "foo"})
+}
+
+func Test_FetchWorker_buildRecordDataIntervalComponents(t *testing.T) {
+	is := is.New(t)
+
+	key, payload, err := (&FetchWorker{
+		conf: FetchConfig{
+			Table:              "mytable",
+			Key:                "id",
+			IntervalComponents: true,
+		},
+	}).buildRecordData(
+		[]string{"id", "duration"},
+		[]any{pgtype.Interval{Days: 1, Valid: true}, pgtype.Interval{Months: 2, Microseconds: 3, Valid: true}},
+	)
+
+	is.NoErr(err)
+	is.Equal(key, sdk.StructuredData{"id": "P1D"})
+	is.Equal(payload, sdk.StructuredData{
+		"id":       map[string]any{"months": int32(0), "days": int32(1), "microseconds": int64(0)},
+		"duration": map[string]any{"months": int32(2), "days": int32(0), "microseconds": int64(3)},
+	})
+}
+
+func Test_FetchWorker_buildRecordDataFloatSpecials(t *testing.T) {
+	is := is.New(t)
+
+	_, payload, err := (&FetchWorker{
+		conf: FetchConfig{
+			Table:         "mytable",
+			Key:           "id",
+			FloatSpecials: func(name string) any { return name },
+		},
+	}).buildRecordData(
+		[]string{"id", "nan", "inf", "ninf", "regular"},
+		[]any{int64(1), math.NaN(), float32(math.Inf(1)), math.Inf(-1), 1.5},
+	)
+
+	is.NoErr(err)
+	is.Equal(payload, sdk.StructuredData{
+		"id":      int64(1),
+		"nan":     "NaN",
+		"inf":     "Infinity",
+		"ninf":    "-Infinity",
+		"regular": 1.5,
+	})
+}
+
+func Test_FetchWorker_buildFetchDataKeyHash(t *testing.T) {
+	is := is.New(t)
+
+	f := &FetchWorker{
+		conf: FetchConfig{
+			Table:       "mytable",
+			Key:         "id,name",
+			WithKeyHash: true,
+		},
+		fullScan: true,
+	}
+	d, err := f.buildFetchData([]string{"name", "id"}, []any{"foo", int64(1)})
+	is.NoErr(err)
+
+	// the hash does not depend on the order of the columns
+	want, err := types.HashKey(map[string]any{"id": int64(1), "name": "foo"})
+	is.NoErr(err)
+	is.Equal(d.KeyHash, want)
+}
+
+func Test_FetchWorker_buildRecordDataCompositeKey(t *testing.T) {
+	is := is.New(t)
+
+	key, payload, err := (&FetchWorker{
+		conf: FetchConfig{
+			Table:   "mytable",
+			Key:     "id,region,missing",
+			Renames: map[string]string{"region": "Region"},
+		},
+	}).buildRecordData([]string{"id", "region", "name"}, []any{1, "eu", "foo"})
+
+	is.NoErr(err)
+	is.Equal(key, sdk.StructuredData{"id": 1, "Region": "eu", "missing": nil})
+	is.Equal(payload, sdk.StructuredData{"id": 1, "Region": "eu", "name": "foo"})
+}
+
+func Test_FetchWorker_fetchQuery(t *testing.T) {
+	is := is.New(t)
+
+	f := &FetchWorker{
+		lastRead:    10,
+		snapshotEnd: 15,
+		cursorName:  "cursor123",
+		conf: FetchConfig{
+			Table:     "mytable",
+			Key:       "id",
+			FetchSize: 100,
+		},
+	}
+	is.Equal(f.fetchQuery(), "SELECT * FROM mytable WHERE id > 10 AND id <= 15 ORDER BY id LIMIT 100")
+
+	f.fullScan = true
+	is.Equal(f.fetchQuery(), "FETCH 100 FROM cursor123")
+}
+
 func Test_FetchWorker_updateSnapshotEnd(t *testing.T) {
 	var (
 		is    = is.New(t)
@@ -491,9 +804,10 @@ func Test_FetchWorker_createCursor(t *testing.T) {
 		lastRead:    10,
 		snapshotEnd: 15,
 		cursorName:  "cursor123",
+		fullScan:    true,
 		conf: FetchConfig{
 			Table: table,
-			Key:   "id",
+			Key:   "column3",
 		},
 	}
 
@@ -513,7 +827,7 @@ func Test_FetchWorker_createCursor(t *testing.T) {
 	)
 	is.Equal(
 		cursorDef,
-		fmt.Sprintf("DECLARE cursor123 CURSOR FOR(SELECT * FROM %s WHERE id > 10 AND id <= 15 ORDER BY id)", table),
+		fmt.Sprintf("DECLARE cursor123 CURSOR FOR(SELECT * FROM %s)", table),
 	)
 
 	is.NoErr(tx.Rollback(ctx))
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/conduitio/conduit-commons/csync"
 	"github.com/conduitio/conduit-connector-postgres/source/position"
@@ -29,11 +30,41 @@ import (
 var ErrIteratorDone = errors.New("snapshot complete")
 
 type Config struct {
-	Position     sdk.Position
-	Tables       []string
-	TableKeys    map[string]string
-	TXSnapshotID string
-	FetchSize    int
+	Position  sdk.Position
+	Tables    []string
+	TableKeys map[string]string
+	// ColumnRenames maps table names to the new names of their columns by
+	// the original name.
+	ColumnRenames map[string]map[string]string
+	// IntervalComponents writes intervals in payloads as their months, days
+	// and microseconds.
+	IntervalComponents bool
+	// FloatSpecials replaces the special values NaN, Infinity and -Infinity
+	// of floats in payloads, if set. It's called with the name of the value.
+	FloatSpecials func(name string) any
+	// WithKeyHash adds a hash of the key to each record in MetadataKeyHash,
+	// see types.HashKey.
+	WithKeyHash bool
+	// MetadataPrefix replaces DefaultMetadataPrefix in MetadataKeyHash, like
+	// the prefix of metadata keys in CDC records. Defaults to
+	// DefaultMetadataPrefix.
+	MetadataPrefix string
+	TXSnapshotID   string
+	FetchSize      int
+	// PositionCodec encodes and decodes the positions of records. Defaults to
+	// position.JSONCodec.
+	PositionCodec position.Codec
+	// WithSequences emits the current values of the sequences owned by the
+	// tables before the rows, when a snapshot is started from scratch.
+	WithSequences bool
+	// Parallelism limits the number of tables read concurrently. 0 reads all
+	// tables at once.
+	Parallelism int
+	// StaticMetadata is added to the metadata of every record returned by
+	// StandaloneIterator. Existing keys are only replaced if
+	// OverwriteMetadata is set.
+	StaticMetadata    map[string]string
+	OverwriteMetadata bool
 }
 
 type Iterator struct {
@@ -46,11 +77,21 @@ type Iterator struct {
 
 	lastPosition position.Position
 
+	// sequences contains the sequence values which were not returned yet.
+	sequences []SequenceValue
+
 	data chan FetchData
 }
 
 func NewIterator(ctx context.Context, db *pgxpool.Pool, c Config) (*Iterator, error) {
-	p, err := position.ParseSDKPosition(c.Position)
+	if c.PositionCodec == nil {
+		c.PositionCodec = position.JSONCodec{}
+	}
+	if c.MetadataPrefix == "" {
+		c.MetadataPrefix = DefaultMetadataPrefix
+	}
+
+	p, err := c.PositionCodec.Decode(c.Position)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse position: %w", err)
 	}
@@ -68,6 +109,13 @@ func NewIterator(ctx context.Context, db *pgxpool.Pool, c Config) (*Iterator, er
 		lastPosition: p,
 	}
 
+	if c.WithSequences && p.Type == position.TypeInitial {
+		i.sequences, err = FetchSequenceValues(ctx, db, c.Tables)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err := i.initFetchers(ctx); err != nil {
 		return nil, fmt.Errorf("failed to initialize table fetchers: %w", err)
 	}
@@ -78,6 +126,16 @@ func NewIterator(ctx context.Context, db *pgxpool.Pool, c Config) (*Iterator, er
 }
 
 func (i *Iterator) Next(ctx context.Context) (sdk.Record, error) {
+	if len(i.sequences) > 0 {
+		s := i.sequences[0]
+		i.sequences = i.sequences[1:]
+		i.acks.Add(1)
+		// the position does not contain progress of any table yet, the
+		// sequences are not emitted again if the snapshot is restarted
+		i.lastPosition.Type = position.TypeSnapshot
+		return s.record(i.conf.PositionCodec.Encode(i.lastPosition)), nil
+	}
+
 	select {
 	case <-ctx.Done():
 		return sdk.Record{}, fmt.Errorf("iterator stopped: %w", ctx.Err())
@@ -115,9 +173,12 @@ func (i *Iterator) buildRecord(d FetchData) sdk.Record {
 	i.lastPosition.Type = position.TypeSnapshot
 	i.lastPosition.Snapshots[d.Table] = d.Position
 
-	pos := i.lastPosition.ToSDKPosition()
+	pos := i.conf.PositionCodec.Encode(i.lastPosition)
 	metadata := make(sdk.Metadata)
 	metadata["postgres.table"] = d.Table
+	if d.KeyHash != "" {
+		metadata[i.conf.MetadataPrefix+strings.TrimPrefix(MetadataKeyHash, DefaultMetadataPrefix)] = d.KeyHash
+	}
 
 	return sdk.Util.Source.NewRecordSnapshot(pos, metadata, d.Key, d.Payload)
 }
@@ -129,11 +190,15 @@ func (i *Iterator) initFetchers(ctx context.Context) error {
 
 	for j, t := range i.conf.Tables {
 		w := NewFetchWorker(i.db, i.data, FetchConfig{
-			Table:        t,
-			Key:          i.conf.TableKeys[t],
-			TXSnapshotID: i.conf.TXSnapshotID,
-			Position:     i.lastPosition,
-			FetchSize:    i.conf.FetchSize,
+			Table:              t,
+			Key:                i.conf.TableKeys[t],
+			Renames:            i.conf.ColumnRenames[t],
+			IntervalComponents: i.conf.IntervalComponents,
+			FloatSpecials:      i.conf.FloatSpecials,
+			WithKeyHash:        i.conf.WithKeyHash,
+			TXSnapshotID:       i.conf.TXSnapshotID,
+			Position:           i.lastPosition,
+			FetchSize:          i.conf.FetchSize,
 		})
 
 		if err := w.Validate(ctx); err != nil {
@@ -147,10 +212,25 @@ func (i *Iterator) initFetchers(ctx context.Context) error {
 }
 
 func (i *Iterator) startWorkers() {
+	// workers waiting for a slot don't hold a connection, the snapshot stays
+	// the same for all of them
+	var slots chan struct{}
+	if i.conf.Parallelism > 0 {
+		slots = make(chan struct{}, i.conf.Parallelism)
+	}
+
 	for j := range i.workers {
 		f := i.workers[j]
 		i.t.Go(func() error {
 			ctx := i.t.Context(nil) //nolint:staticcheck // This is the correct usage of tomb.Context
+			if slots != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case slots <- struct{}{}:
+				}
+				defer func() { <-slots }()
+			}
 			if err := f.Run(ctx); err != nil {
 				return fmt.Errorf("fetcher for table %q exited: %w", f.conf.Table, err)
 			}
@@ -148,3 +148,146 @@ func Test_Iterator_Next(t *testing.T) {
 		is.True(errors.Is(err, context.Canceled))
 	})
 }
+
+func Test_Iterator_Sequences(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		pool  = test.ConnectPool(ctx, t, test.RegularConnString)
+		table = test.SetupTestTable(ctx, t, pool)
+		is    = is.New(t)
+	)
+
+	i, err := NewIterator(ctx, pool, Config{
+		Position: position.Position{}.ToSDKPosition(),
+		Tables:   []string{table},
+		TableKeys: map[string]string{
+			table: "id",
+		},
+		WithSequences: true,
+	})
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(i.Teardown(ctx))
+	}()
+
+	seq := "public." + table + "_id_seq"
+
+	r, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(r.Operation, sdk.OperationSnapshot)
+	is.Equal(r.Metadata[MetadataSequence], seq)
+	is.Equal(r.Metadata["postgres.table"], table)
+	is.Equal(r.Key, sdk.StructuredData{"sequence": seq})
+	is.Equal(r.Payload.After, sdk.StructuredData{
+		"sequence":   seq,
+		"table":      table,
+		"column":     "id",
+		"last_value": int64(4),
+	})
+
+	// the rows follow the sequence values
+	for j := 1; j <= 4; j++ {
+		r, err := i.Next(ctx)
+		is.NoErr(err)
+		is.Equal(r.Metadata[MetadataSequence], "")
+	}
+	for j := 1; j <= 5; j++ {
+		is.NoErr(i.Ack(ctx, nil))
+	}
+
+	_, err = i.Next(ctx)
+	is.Equal(err, ErrIteratorDone)
+}
+
+func Test_Iterator_Resume(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		pool    = test.ConnectPool(ctx, t, test.RegularConnString)
+		partial = test.SetupTestTable(ctx, t, pool)
+		done    = test.SetupTestTable(ctx, t, pool)
+		fresh   = test.SetupTestTable(ctx, t, pool)
+		is      = is.New(t)
+	)
+
+	// the snapshot was stopped in the middle of the first table, after the
+	// second table was read completely and before the third table was started
+	start := position.Position{
+		Type: position.TypeSnapshot,
+		Snapshots: position.SnapshotPositions{
+			partial: {LastRead: 2, SnapshotEnd: 4},
+			done:    {LastRead: 4, SnapshotEnd: 4},
+		},
+	}
+
+	i, err := NewIterator(ctx, pool, Config{
+		Position: start.ToSDKPosition(),
+		Tables:   []string{partial, done, fresh},
+		TableKeys: map[string]string{
+			partial: "id",
+			done:    "id",
+			fresh:   "id",
+		},
+	})
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(i.Teardown(ctx))
+	}()
+
+	got := make(map[string][]int64)
+	var last sdk.Position
+	for j := 1; j <= 6; j++ {
+		r, err := i.Next(ctx)
+		is.NoErr(err)
+		table := r.Metadata["postgres.table"]
+		got[table] = append(got[table], r.Key.(sdk.StructuredData)["id"].(int64))
+		last = r.Position
+	}
+	for j := 1; j <= 6; j++ {
+		is.NoErr(i.Ack(ctx, nil))
+	}
+
+	_, err = i.Next(ctx)
+	is.Equal(err, ErrIteratorDone)
+
+	is.Equal(got, map[string][]int64{
+		partial: {3, 4},
+		fresh:   {1, 2, 3, 4},
+	})
+
+	// the progress of all tables is kept in the position
+	p, err := position.ParseSDKPosition(last)
+	is.NoErr(err)
+	is.Equal(p.Type, position.TypeSnapshot)
+	is.Equal(p.Snapshots, position.SnapshotPositions{
+		partial: {LastRead: 4, SnapshotEnd: 4},
+		done:    {LastRead: 4, SnapshotEnd: 4},
+		fresh:   {LastRead: 4, SnapshotEnd: 4},
+	})
+}
+
+func Test_Iterator_buildRecordKeyHash(t *testing.T) {
+	is := is.New(t)
+
+	for prefix, want := range map[string]string{
+		DefaultMetadataPrefix: "postgres.keyHash",
+		"pg.":                 "pg.keyHash",
+	} {
+		i := &Iterator{
+			conf: Config{
+				PositionCodec:  position.JSONCodec{},
+				MetadataPrefix: prefix,
+			},
+			lastPosition: position.Position{Snapshots: make(position.SnapshotPositions)},
+		}
+		rec := i.buildRecord(FetchData{
+			Key:     sdk.StructuredData{"id": int64(1)},
+			Table:   "mytable",
+			KeyHash: "0123456789abcdef",
+		})
+		is.Equal(rec.Metadata[want], "0123456789abcdef")
+		if want != MetadataKeyHash {
+			_, ok := rec.Metadata[MetadataKeyHash]
+			is.True(!ok)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MetadataSequence is the metadata key containing the name of the sequence in
+// sequence records, see Config.WithSequences.
+const MetadataSequence = "postgres.sequence"
+
+// SequenceValue is the current value of a sequence owned by a table column,
+// i.e. the sequence of a serial or identity column.
+type SequenceValue struct {
+	Table    string
+	Column   string
+	Sequence string
+	// LastValue is the last value returned by the sequence, nil if the
+	// sequence was never used.
+	LastValue *int64
+}
+
+// FetchSequenceValues returns the current values of the sequences owned by
+// columns of the tables. Sequences are not transactional, so the values are
+// the latest values and not the ones at the time of a transaction snapshot.
+func FetchSequenceValues(ctx context.Context, db *pgxpool.Pool, tables []string) ([]SequenceValue, error) {
+	var values []SequenceValue
+	for _, table := range tables {
+		rows, err := db.Query(ctx, `
+			SELECT a.attname, quote_ident(ps.schemaname) || '.' || quote_ident(ps.sequencename), ps.last_value
+			FROM pg_depend d
+			JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+			JOIN pg_namespace n ON n.oid = s.relnamespace
+			JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+			JOIN pg_sequences ps ON ps.schemaname = n.nspname AND ps.sequencename = s.relname
+			WHERE d.classid = 'pg_class'::regclass
+			  AND d.refclassid = 'pg_class'::regclass
+			  AND d.deptype IN ('a', 'i')
+			  AND d.refobjid = to_regclass($1)
+			ORDER BY a.attnum`,
+			table,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query sequences of table %q: %w", table, err)
+		}
+
+		tableValues, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SequenceValue, error) {
+			v := SequenceValue{Table: table}
+			err := row.Scan(&v.Column, &v.Sequence, &v.LastValue)
+			return v, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sequences of table %q: %w", table, err)
+		}
+		values = append(values, tableValues...)
+	}
+	return values, nil
+}
+
+// record builds the record carrying the sequence value, keyed by the name of
+// the sequence.
+func (s SequenceValue) record(pos sdk.Position) sdk.Record {
+	metadata := sdk.Metadata{
+		"postgres.table": s.Table,
+		MetadataSequence: s.Sequence,
+	}
+	var lastValue any
+	if s.LastValue != nil {
+		lastValue = *s.LastValue
+	}
+
+	return sdk.Util.Source.NewRecordSnapshot(
+		pos,
+		metadata,
+		sdk.StructuredData{"sequence": s.Sequence},
+		sdk.StructuredData{
+			"sequence":   s.Sequence,
+			"table":      s.Table,
+			"column":     s.Column,
+			"last_value": lastValue,
+		},
+	)
+}
@@ -0,0 +1,149 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StandaloneIterator reads a consistent snapshot of the tables without logical
+// replication, i.e. without creating a replication slot or publication. The
+// snapshot is exported from a transaction, which is kept open until all rows
+// were read. Once the snapshot is complete, Next returns sdk.ErrBackoffRetry.
+// Records contain the same source and static metadata as snapshot records of
+// the combined iterator.
+type StandaloneIterator struct {
+	*Iterator
+
+	conn *pgxpool.Conn
+	tx   pgx.Tx
+	done bool
+
+	// sourceMetadata contains the database and system identifier, which the
+	// CDC iterator gets from the replication connection otherwise.
+	sourceMetadata map[string]string
+}
+
+// NewStandaloneIterator exports a snapshot and starts reading the tables in
+// it. The TXSnapshotID in the config is replaced with the exported snapshot.
+func NewStandaloneIterator(ctx context.Context, db *pgxpool.Pool, c Config) (*StandaloneIterator, error) {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	i := &StandaloneIterator{conn: conn}
+
+	i.tx, err = conn.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	if err := i.tx.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&c.TXSnapshotID); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to export snapshot: %w", err), i.release(ctx))
+	}
+
+	var database, systemID string
+	if err := i.tx.QueryRow(
+		ctx,
+		"SELECT current_database(), system_identifier::text FROM pg_control_system()",
+	).Scan(&database, &systemID); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to query system identifier: %w", err), i.release(ctx))
+	}
+	prefix := c.MetadataPrefix
+	if prefix == "" {
+		prefix = DefaultMetadataPrefix
+	}
+	i.sourceMetadata = map[string]string{
+		prefix + strings.TrimPrefix(MetadataDatabase, DefaultMetadataPrefix):         database,
+		prefix + strings.TrimPrefix(MetadataSystemIdentifier, DefaultMetadataPrefix): systemID,
+	}
+
+	i.Iterator, err = NewIterator(ctx, db, c)
+	if err != nil {
+		return nil, errors.Join(err, i.release(ctx))
+	}
+	return i, nil
+}
+
+func (i *StandaloneIterator) Next(ctx context.Context) (sdk.Record, error) {
+	if i.done {
+		return sdk.Record{}, sdk.ErrBackoffRetry
+	}
+
+	rec, err := i.Iterator.Next(ctx)
+	if err == nil {
+		i.addMetadata(rec)
+		return rec, nil
+	}
+	if !errors.Is(err, ErrIteratorDone) {
+		return rec, err
+	}
+
+	i.done = true
+	sdk.Logger(ctx).Info().Msg("Snapshot completed, changes are not read in snapshot only mode")
+	if err := i.release(ctx); err != nil {
+		return sdk.Record{}, fmt.Errorf("failed to release exported snapshot: %w", err)
+	}
+	return sdk.Record{}, sdk.ErrBackoffRetry
+}
+
+// addMetadata adds the source metadata and the static metadata to the record.
+// Existing keys are only replaced by static metadata if OverwriteMetadata is
+// set.
+func (i *StandaloneIterator) addMetadata(rec sdk.Record) {
+	for k, v := range i.sourceMetadata {
+		rec.Metadata[k] = v
+	}
+	for k, v := range i.conf.StaticMetadata {
+		if _, ok := rec.Metadata[k]; ok && !i.conf.OverwriteMetadata {
+			continue
+		}
+		rec.Metadata[k] = v
+	}
+}
+
+func (i *StandaloneIterator) Teardown(ctx context.Context) error {
+	var errs []error
+	if i.Iterator != nil {
+		errs = append(errs, i.Iterator.Teardown(ctx))
+	}
+	errs = append(errs, i.release(ctx))
+	return errors.Join(errs...)
+}
+
+// release ends the transaction the snapshot was exported from and returns the
+// connection to the pool.
+func (i *StandaloneIterator) release(ctx context.Context) error {
+	if i.conn == nil {
+		return nil
+	}
+
+	// nothing was written, rolling back is the same as committing
+	err := i.tx.Rollback(ctx)
+	i.conn.Release()
+	i.conn, i.tx = nil, nil
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/source/position"
+	"github.com/conduitio/conduit-connector-postgres/test"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func Test_StandaloneIterator(t *testing.T) {
+	var (
+		is    = is.New(t)
+		ctx   = context.Background()
+		pool  = test.ConnectPool(ctx, t, test.RegularConnString)
+		table = test.SetupTestTable(ctx, t, pool)
+	)
+
+	countSlotsAndPubs := func() (int, int) {
+		var slots, pubs int
+		is.NoErr(pool.QueryRow(ctx, "SELECT count(*) FROM pg_replication_slots").Scan(&slots))
+		is.NoErr(pool.QueryRow(ctx, "SELECT count(*) FROM pg_publication").Scan(&pubs))
+		return slots, pubs
+	}
+	slotsBefore, pubsBefore := countSlotsAndPubs()
+
+	i, err := NewStandaloneIterator(ctx, pool, Config{
+		Position: position.Position{}.ToSDKPosition(),
+		Tables:   []string{table},
+		TableKeys: map[string]string{
+			table: "id",
+		},
+		StaticMetadata: map[string]string{
+			"env":            "test",
+			MetadataDatabase: "overwritten",
+		},
+	})
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(i.Teardown(ctx))
+	}()
+
+	var database string
+	is.NoErr(pool.QueryRow(ctx, "SELECT current_database()").Scan(&database))
+
+	for j := 1; j <= 4; j++ {
+		r, err := i.Next(ctx)
+		is.NoErr(err)
+		is.Equal(r.Operation, sdk.OperationSnapshot)
+		is.Equal(r.Metadata["env"], "test")
+		// static metadata doesn't replace source metadata without overwrite
+		is.Equal(r.Metadata[MetadataDatabase], database)
+		is.True(r.Metadata[MetadataSystemIdentifier] != "")
+		is.NoErr(i.Ack(ctx, r.Position))
+	}
+
+	// the snapshot is complete, no more records are produced
+	for j := 1; j <= 2; j++ {
+		_, err = i.Next(ctx)
+		is.Equal(err, sdk.ErrBackoffRetry)
+	}
+
+	slotsAfter, pubsAfter := countSlotsAndPubs()
+	is.Equal(slotsAfter, slotsBefore)
+	is.Equal(pubsAfter, pubsBefore)
+}
+
+func Test_StandaloneIterator_Parallelism(t *testing.T) {
+	var (
+		is     = is.New(t)
+		ctx    = context.Background()
+		pool   = test.ConnectPool(ctx, t, test.RegularConnString)
+		tables = []string{
+			test.SetupTestTable(ctx, t, pool),
+			test.SetupTestTable(ctx, t, pool),
+			test.SetupTestTable(ctx, t, pool),
+		}
+	)
+
+	keys := make(map[string]string)
+	for _, table := range tables {
+		keys[table] = "id"
+	}
+
+	i, err := NewStandaloneIterator(ctx, pool, Config{
+		Position:    position.Position{}.ToSDKPosition(),
+		Tables:      tables,
+		TableKeys:   keys,
+		Parallelism: 2,
+	})
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(i.Teardown(ctx))
+	}()
+
+	// rows inserted after the snapshot was exported are not part of it, also
+	// in tables which are read after the others
+	for _, table := range tables {
+		_, err := pool.Exec(ctx, fmt.Sprintf("INSERT INTO %s (column1) VALUES ('new')", table))
+		is.NoErr(err)
+	}
+
+	got := make(map[string]int)
+	for {
+		r, err := i.Next(ctx)
+		if errors.Is(err, sdk.ErrBackoffRetry) {
+			break
+		}
+		is.NoErr(err)
+		got[r.Metadata["postgres.table"]]++
+		is.NoErr(i.Ack(ctx, r.Position))
+	}
+
+	for _, table := range tables {
+		is.Equal(got[table], 4)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ArrayFormatter struct{}
+
+// Format coerces the elements of `pgtype.Array` and returns them as a slice.
+// Multidimensional arrays are returned as nested slices, e.g. `{{1,2},{3,4}}`
+// becomes `[[1,2],[3,4]]`.
+func (ArrayFormatter) Format(a pgtype.Array[any]) (any, error) {
+	if !a.Valid {
+		return nil, nil
+	}
+
+	elems, err := ArrayFormatter{}.formatElements(a.Elements)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(a.Dims) <= 1 {
+		return elems, nil
+	}
+
+	n := 1
+	for _, d := range a.Dims {
+		n *= int(d.Length)
+	}
+	if n != len(elems) {
+		return nil, fmt.Errorf("array dimensions %v do not match %d elements", a.Dims, len(elems))
+	}
+
+	return reshape(elems, a.Dims), nil
+}
+
+// formatElements coerces all elements of a one-dimensional array.
+func (ArrayFormatter) formatElements(elems []any) ([]any, error) {
+	out := make([]any, len(elems))
+	for i, e := range elems {
+		v, err := Format(e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format array element %d: %w", i, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// reshape splits the flat elements into nested slices based on the dimensions.
+func reshape(elems []any, dims []pgtype.ArrayDimension) []any {
+	if len(dims) == 1 {
+		return elems
+	}
+
+	n := int(dims[0].Length)
+	size := len(elems) / n
+	out := make([]any, n)
+	for i := range out {
+		out[i] = reshape(elems[i*size:(i+1)*size], dims[1:])
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// extensionTypes contains codecs for types defined by extensions. The OIDs of
+// these types differ between databases, so they are looked up at runtime.
+var extensionTypes = map[string]pgtype.Codec{
+	// citext values are decoded like text
+	"citext": pgtype.TextCodec{},
+}
+
+// LoadExtensionTypes looks up the OIDs of supported extension types in the
+// database and registers codecs for them and their array types. Types of
+// extensions which are not installed are skipped. The connection can be a
+// regular or a replication connection.
+func LoadExtensionTypes(ctx context.Context, conn *pgconn.PgConn, m *pgtype.Map) error {
+	// replication connections only support the simple query protocol, the
+	// names are inlined, they are plain identifiers
+	names := make([]string, 0, len(extensionTypes))
+	for name := range extensionTypes {
+		names = append(names, "'"+name+"'")
+	}
+
+	results, err := conn.Exec(
+		ctx,
+		"SELECT typname, oid, typarray FROM pg_type WHERE typname IN ("+strings.Join(names, ", ")+")",
+	).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to look up extension types: %w", err)
+	}
+
+	for _, row := range results[0].Rows {
+		name := string(row[0])
+		oid, err := strconv.ParseUint(string(row[1]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid OID for type %q: %w", name, err)
+		}
+		arrayOID, err := strconv.ParseUint(string(row[2]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid array OID for type %q: %w", name, err)
+		}
+		registerExtensionType(m, name, uint32(oid), uint32(arrayOID))
+	}
+	return nil
+}
+
+// registerExtensionType registers the codec of the extension type with the
+// supplied OIDs. The array type is skipped if arrayOID is 0.
+func registerExtensionType(m *pgtype.Map, name string, oid, arrayOID uint32) {
+	t := &pgtype.Type{Name: name, OID: oid, Codec: extensionTypes[name]}
+	m.RegisterType(t)
+	if arrayOID != 0 {
+		m.RegisterType(&pgtype.Type{Name: "_" + name, OID: arrayOID, Codec: &pgtype.ArrayCodec{ElementType: t}})
+	}
+}
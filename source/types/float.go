@@ -0,0 +1,69 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "math"
+
+type FloatFormatter struct{}
+
+// Special returns the name Postgres uses for the special value of the float,
+// i.e. "NaN", "Infinity" or "-Infinity". The second return value is false for
+// regular values.
+func (FloatFormatter) Special(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "Infinity", true
+	case math.IsInf(f, -1):
+		return "-Infinity", true
+	default:
+		return "", false
+	}
+}
+
+// ReplaceSpecials replaces the special values of float4 and float8 values in a
+// formatted value with the result of replace, which is called with the name
+// of the special value. JSON has no representation for these values. Floats in
+// arrays and composite values are replaced as well, other values are returned
+// unchanged.
+func (f FloatFormatter) ReplaceSpecials(v any, replace func(name string) any) any {
+	switch t := v.(type) {
+	case float64:
+		if name, ok := f.Special(t); ok {
+			return replace(name)
+		}
+		return t
+	case float32:
+		if name, ok := f.Special(float64(t)); ok {
+			return replace(name)
+		}
+		return t
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = f.ReplaceSpecials(e, replace)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = f.ReplaceSpecials(e, replace)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	microsecondsPerSecond = 1000000
+	microsecondsPerDay    = 24 * 60 * 60 * microsecondsPerSecond
+	// daysPerMonth is the number of days Postgres assumes in a month when
+	// comparing intervals.
+	daysPerMonth = 30
+)
+
+type IntervalFormatter struct{}
+
+// Key returns a normalized ISO 8601 representation of the interval. The
+// interval is normalized the same way Postgres compares intervals (a month has
+// 30 days, a day 24 hours), so intervals which are equal in Postgres produce
+// the same key, e.g. "1 day" and "24 hours" both produce "P1D".
+func (IntervalFormatter) Key(iv pgtype.Interval) (any, error) {
+	if !iv.Valid {
+		return nil, nil
+	}
+
+	total := big.NewInt(int64(iv.Months))
+	total.Mul(total, big.NewInt(daysPerMonth))
+	total.Add(total, big.NewInt(int64(iv.Days)))
+	total.Mul(total, big.NewInt(microsecondsPerDay))
+	total.Add(total, big.NewInt(iv.Microseconds))
+
+	var sb strings.Builder
+	if total.Sign() < 0 {
+		sb.WriteByte('-')
+		total.Neg(total)
+	}
+	sb.WriteByte('P')
+
+	months, rem := new(big.Int).QuoRem(total, big.NewInt(daysPerMonth*microsecondsPerDay), new(big.Int))
+	// the remainder is smaller than a month, it fits into an int64
+	micros := rem.Int64()
+	days := micros / microsecondsPerDay
+	micros %= microsecondsPerDay
+
+	if y := new(big.Int).Quo(months, big.NewInt(12)); y.Sign() > 0 {
+		fmt.Fprintf(&sb, "%sY", y)
+	}
+	if m := new(big.Int).Rem(months, big.NewInt(12)); m.Sign() > 0 {
+		fmt.Fprintf(&sb, "%sM", m)
+	}
+	if days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+	}
+
+	// a zero interval is written as PT0S
+	if micros > 0 || (months.Sign() == 0 && days == 0) {
+		sb.WriteByte('T')
+		hours := micros / (60 * 60 * microsecondsPerSecond)
+		micros %= 60 * 60 * microsecondsPerSecond
+		minutes := micros / (60 * microsecondsPerSecond)
+		micros %= 60 * microsecondsPerSecond
+
+		if hours > 0 {
+			fmt.Fprintf(&sb, "%dH", hours)
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&sb, "%dM", minutes)
+		}
+		if micros > 0 || hours == 0 && minutes == 0 {
+			seconds := fmt.Sprintf("%d.%06d", micros/microsecondsPerSecond, micros%microsecondsPerSecond)
+			fmt.Fprintf(&sb, "%sS", strings.TrimSuffix(strings.TrimRight(seconds, "0"), "."))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// Components returns the months, days and microseconds of the interval as a
+// structured value. Postgres stores the three parts separately, as a month
+// does not have a fixed number of days and a day not a fixed number of
+// microseconds, so keeping them apart allows exact arithmetic downstream.
+// Returns nil for a null interval.
+func (IntervalFormatter) Components(iv pgtype.Interval) any {
+	if !iv.Valid {
+		return nil
+	}
+	return map[string]any{
+		"months":       iv.Months,
+		"days":         iv.Days,
+		"microseconds": iv.Microseconds,
+	}
+}
+
+// WithComponents replaces intervals in a formatted value with their
+// components, see Components. Intervals in arrays and composite values are
+// replaced as well, other values are returned unchanged.
+func (f IntervalFormatter) WithComponents(v any) any {
+	switch t := v.(type) {
+	case pgtype.Interval:
+		return f.Components(t)
+	case *pgtype.Interval:
+		return f.Components(*t)
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = f.WithComponents(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = f.WithComponents(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
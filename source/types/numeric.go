@@ -15,6 +15,9 @@
 package types
 
 import (
+	"math/big"
+	"strings"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -54,3 +57,46 @@ func (NumericFormatter) Format(num pgtype.Numeric) (any, error) {
 
 	return v, nil
 }
+
+// Key returns the canonical string representation of the numeric, without
+// trailing zeros in the fraction, so that equal numbers always produce the same
+// key regardless of their scale, e.g. 1.50 and 1.5 both produce "1.5".
+func (NumericFormatter) Key(num pgtype.Numeric) (any, error) {
+	switch {
+	case !num.Valid:
+		return nil, nil
+	case num.NaN:
+		return "NaN", nil
+	case num.InfinityModifier == pgtype.Infinity:
+		return "Infinity", nil
+	case num.InfinityModifier == pgtype.NegativeInfinity:
+		return "-Infinity", nil
+	case num.Int == nil || num.Int.Sign() == 0:
+		return "0", nil
+	}
+
+	// strip trailing zeros from the digits
+	digits, exp := new(big.Int).Set(num.Int), int(num.Exp)
+	ten, rem := big.NewInt(10), new(big.Int)
+	for {
+		q, r := new(big.Int).QuoRem(digits, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		digits, exp = q, exp+1
+	}
+
+	s := digits.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	if exp >= 0 {
+		return sign + s + strings.Repeat("0", exp), nil
+	}
+	if n := -exp; len(s) <= n {
+		s = strings.Repeat("0", n-len(s)+1) + s
+	}
+	return sign + s[:len(s)+exp] + "." + s[len(s)+exp:], nil
+}
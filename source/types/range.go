@@ -0,0 +1,44 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type RangeFormatter struct{}
+
+// Format coerces the bounds of `pgtype.Range` like scalar values of the
+// element type, e.g. the bounds of a `tstzrange` are normalized to UTC like
+// `timestamptz` values. The bound types are kept.
+func (RangeFormatter) Format(r pgtype.Range[any]) (any, error) {
+	if !r.Valid {
+		return nil, nil
+	}
+
+	lower, err := Format(r.Lower)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format lower range bound: %w", err)
+	}
+	upper, err := Format(r.Upper)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format upper range bound: %w", err)
+	}
+
+	r.Lower, r.Upper = lower, upper
+	return r, nil
+}
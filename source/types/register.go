@@ -0,0 +1,202 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OIDs of built-in types which are not registered in pgx by default.
+const (
+	Int2VectorOID   = 22
+	OIDVectorOID    = 30
+	TxidSnapshotOID = 2970
+	PgLSNOID        = 3220
+	JSONPathOID     = 4072
+	PgSnapshotOID   = 5038
+	XID8OID         = 5069
+)
+
+// RegisterTypes registers codecs for built-in types which pgx does not know
+// about, so that they are decoded into a meaningful value instead of raw data.
+func RegisterTypes(m *pgtype.Map) {
+	// pg_lsn is returned in its canonical text form, e.g. "16/B374D848"
+	m.RegisterType(&pgtype.Type{Name: "pg_lsn", OID: PgLSNOID, Codec: &pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}})
+	// jsonpath is returned in its canonical text form, e.g. `$."foo"[*]`, so
+	// it can be written back as is
+	m.RegisterType(&pgtype.Type{Name: "jsonpath", OID: JSONPathOID, Codec: &pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}})
+	// snapshots are returned in their canonical text form xmin:xmax:xip_list,
+	// e.g. "10:20:10,14,15"
+	m.RegisterType(&pgtype.Type{Name: "pg_snapshot", OID: PgSnapshotOID, Codec: &pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}})
+	m.RegisterType(&pgtype.Type{Name: "txid_snapshot", OID: TxidSnapshotOID, Codec: &pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}})
+	m.RegisterType(&pgtype.Type{Name: "name", OID: pgtype.NameOID, Codec: nameCodec{&pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}}})
+	m.RegisterType(&pgtype.Type{Name: "xid8", OID: XID8OID, Codec: uint64Codec{&pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}}})
+	m.RegisterType(&pgtype.Type{Name: "timetz", OID: pgtype.TimetzOID, Codec: timetzCodec{&pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}}})
+	m.RegisterType(&pgtype.Type{Name: "macaddr8", OID: pgtype.Macaddr8OID, Codec: macaddr8Codec{&pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}}})
+	m.RegisterType(&pgtype.Type{Name: "int2vector", OID: Int2VectorOID, Codec: int2vectorCodec{&pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}}})
+	m.RegisterType(&pgtype.Type{Name: "oidvector", OID: OIDVectorOID, Codec: oidvectorCodec{&pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}}})
+
+	// geometric types are returned in their canonical text form, e.g.
+	// "(1,2)" for a point, so they can be written back as is
+	for name, oid := range map[string]uint32{
+		"point":   pgtype.PointOID,
+		"line":    pgtype.LineOID,
+		"lseg":    pgtype.LsegOID,
+		"box":     pgtype.BoxOID,
+		"path":    pgtype.PathOID,
+		"polygon": pgtype.PolygonOID,
+		"circle":  pgtype.CircleOID,
+	} {
+		m.RegisterType(&pgtype.Type{Name: name, OID: oid, Codec: &pgtype.TextFormatOnlyCodec{Codec: pgtype.TextCodec{}}})
+	}
+}
+
+// uint64Codec decodes unsigned 64-bit integer types (e.g. xid8) into uint64.
+// Values are always transferred in text format.
+type uint64Codec struct {
+	*pgtype.TextFormatOnlyCodec
+}
+
+func (uint64Codec) DecodeValue(_ *pgtype.Map, _ uint32, _ int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return strconv.ParseUint(string(src), 10, 64)
+}
+
+// nameCodec decodes identifiers of the type name into a string. Names are
+// stored in a fixed size buffer of 64 bytes, trailing null bytes are removed
+// in case they are part of the value. Values are always transferred in text
+// format.
+type nameCodec struct {
+	*pgtype.TextFormatOnlyCodec
+}
+
+func (nameCodec) DecodeValue(_ *pgtype.Map, _ uint32, _ int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return strings.TrimRight(string(src), "\x00"), nil
+}
+
+// timetzCodec decodes time with time zone values into a string retaining the
+// offset, e.g. "12:34:56+02:00". Values are always transferred in text format.
+type timetzCodec struct {
+	*pgtype.TextFormatOnlyCodec
+}
+
+func (timetzCodec) DecodeValue(_ *pgtype.Map, _ uint32, _ int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return formatTimetz(string(src))
+}
+
+// macaddr8Codec decodes EUI-64 MAC addresses into a string of 8 colon-separated
+// octets, e.g. "08:00:2b:01:02:03:04:05". Values are always transferred in
+// text format.
+type macaddr8Codec struct {
+	*pgtype.TextFormatOnlyCodec
+}
+
+func (macaddr8Codec) DecodeValue(_ *pgtype.Map, _ uint32, _ int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	addr, err := net.ParseMAC(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("invalid macaddr8 %q: %w", src, err)
+	}
+	if len(addr) != 8 {
+		return nil, fmt.Errorf("invalid macaddr8 %q: expected 8 octets, got %d", src, len(addr))
+	}
+	return addr.String(), nil
+}
+
+// int2vectorCodec decodes int2vector values, e.g. "1 3", into []int16. Values
+// are always transferred in text format.
+type int2vectorCodec struct {
+	*pgtype.TextFormatOnlyCodec
+}
+
+func (int2vectorCodec) DecodeValue(_ *pgtype.Map, _ uint32, _ int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return parseVector("int2vector", src, func(s string) (int16, error) {
+		v, err := strconv.ParseInt(s, 10, 16)
+		return int16(v), err
+	})
+}
+
+// oidvectorCodec decodes oidvector values, e.g. "23 25", into []uint32.
+// Values are always transferred in text format.
+type oidvectorCodec struct {
+	*pgtype.TextFormatOnlyCodec
+}
+
+func (oidvectorCodec) DecodeValue(_ *pgtype.Map, _ uint32, _ int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return parseVector("oidvector", src, func(s string) (uint32, error) {
+		v, err := strconv.ParseUint(s, 10, 32)
+		return uint32(v), err
+	})
+}
+
+// parseVector parses the space separated elements of a vector type.
+func parseVector[T any](typ string, src []byte, parse func(string) (T, error)) ([]T, error) {
+	fields := strings.Fields(string(src))
+	out := make([]T, len(fields))
+	for i, f := range fields {
+		v, err := parse(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", typ, src, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// formatTimetz normalizes the offset of a timetz in the Postgres text format
+// (e.g. "12:34:56+02" or "12:34:56.789-03:30") to the form "±hh:mm", seconds
+// of the offset are kept if present.
+func formatTimetz(s string) (string, error) {
+	i := strings.LastIndexAny(s, "+-")
+	if i <= 0 {
+		return "", fmt.Errorf("invalid timetz %q: missing offset", s)
+	}
+
+	t, offset := s[:i], strings.Split(s[i+1:], ":")
+	if len(offset) > 3 {
+		return "", fmt.Errorf("invalid timetz %q: invalid offset", s)
+	}
+	for _, part := range offset {
+		if len(part) != 2 {
+			return "", fmt.Errorf("invalid timetz %q: invalid offset", s)
+		}
+	}
+	if len(offset) == 1 {
+		offset = append(offset, "00")
+	}
+
+	return t + s[i:i+1] + strings.Join(offset, ":"), nil
+}
@@ -15,7 +15,10 @@
 package types
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type TimeFormatter struct{}
@@ -24,3 +27,25 @@ type TimeFormatter struct{}
 func (n TimeFormatter) Format(t time.Time) (any, error) {
 	return t.UTC().String(), nil
 }
+
+// FormatTimeOfDay formats a time without time zone as a string in the form
+// "HH:MM:SS.ffffff", always with six fractional digits. Midnight at the end of
+// the day is formatted as "24:00:00.000000", like Postgres does.
+func (n TimeFormatter) FormatTimeOfDay(t pgtype.Time) (any, error) {
+	if !t.Valid {
+		return nil, nil
+	}
+	const maxMicroseconds = 24 * 60 * 60 * 1000000
+	if t.Microseconds < 0 || t.Microseconds > maxMicroseconds {
+		return nil, fmt.Errorf("time of day out of range: %d microseconds", t.Microseconds)
+	}
+
+	us := t.Microseconds
+	return fmt.Sprintf(
+		"%02d:%02d:%02d.%06d",
+		us/(60*60*1000000),
+		us/(60*1000000)%60,
+		us/1000000%60,
+		us%1000000,
+	), nil
+}
@@ -15,16 +15,28 @@
 package types
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 var (
-	Numeric = NumericFormatter{}
-	Time    = TimeFormatter{}
+	Array    = ArrayFormatter{}
+	Float    = FloatFormatter{}
+	Interval = IntervalFormatter{}
+	Numeric  = NumericFormatter{}
+	Range    = RangeFormatter{}
+	Time     = TimeFormatter{}
 )
 
+// Format converts a decoded value into the type used in records. Integers are
+// left untouched, so int2, int4 and int8 values are always returned as int16,
+// int32 and int64, in CDC as well as in snapshot records.
 func Format(v any) (any, error) {
 	switch t := v.(type) {
 	case pgtype.Numeric:
@@ -35,7 +47,112 @@ func Format(v any) (any, error) {
 		return Time.Format(t)
 	case *time.Time:
 		return Time.Format(*t)
+	case pgtype.Time:
+		return Time.FormatTimeOfDay(t)
+	case *pgtype.Time:
+		return Time.FormatTimeOfDay(*t)
+	case pgtype.Array[any]:
+		return Array.Format(t)
+	case []any:
+		return Array.formatElements(t)
+	case pgtype.Range[any]:
+		return Range.Format(t)
+	case *pgtype.Range[any]:
+		return Range.Format(*t)
+	case map[string]any:
+		return formatComposite(t)
 	default: // supported type
 		return t, nil
 	}
 }
+
+// FormatKey converts a decoded value into the type used in record keys. Unlike
+// Format, numerics and intervals are converted into a canonical string, so
+// that equal values always produce the same key. Other values are formatted
+// like in Format.
+func FormatKey(v any) (any, error) {
+	switch t := v.(type) {
+	case pgtype.Numeric:
+		return Numeric.Key(t)
+	case *pgtype.Numeric:
+		return Numeric.Key(*t)
+	case pgtype.Interval:
+		return Interval.Key(t)
+	case *pgtype.Interval:
+		return Interval.Key(*t)
+	default:
+		return Format(v)
+	}
+}
+
+// HashKey returns the 64-bit xxHash of the formatted record key as 16
+// hexadecimal characters, so sinks can shard records by a fixed-width value.
+// The key is hashed in a canonical encoding, see writeCanonical, so the hash
+// is stable across runs and independent of map iteration order.
+func HashKey(key map[string]any) (string, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, key); err != nil {
+		return "", fmt.Errorf("failed to encode key: %w", err)
+	}
+	return fmt.Sprintf("%016x", xxhash.Sum64(buf.Bytes())), nil
+}
+
+// writeCanonical writes the JSON encoding of the value, with the keys of maps
+// ordered by name. JSON has no representation for the special float values,
+// NaN, Infinity and -Infinity are written as these bare words instead, which
+// can't be confused with strings or regular numbers.
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case float64:
+		if name, ok := Float.Special(t); ok {
+			buf.WriteString(name)
+			return nil
+		}
+	case float32:
+		if name, ok := Float.Special(float64(t)); ok {
+			buf.WriteString(name)
+			return nil
+		}
+	case map[string]any:
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		buf.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, name); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, t[name]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
@@ -15,9 +15,13 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/matryer/is"
 )
@@ -62,6 +66,64 @@ func Test_Format(t *testing.T) {
 				"2009-11-10 23:00:00 +0000 UTC", nil,
 			},
 		},
+		{
+			name: "pgtype.Array",
+			input: []any{
+				pgtype.Array[any]{
+					Elements: []any{true, false, nil},
+					Dims:     []pgtype.ArrayDimension{{Length: 3, LowerBound: 1}},
+					Valid:    true,
+				},
+				pgtype.Array[any]{
+					Elements: []any{pgxNumeric(t, "1.5"), pgxNumeric(t, "2"), pgxNumeric(t, "3"), pgxNumeric(t, "4")},
+					Dims:     []pgtype.ArrayDimension{{Length: 2, LowerBound: 1}, {Length: 2, LowerBound: 1}},
+					Valid:    true,
+				},
+				[]any{pgxNumeric(t, "5")},
+				pgtype.Array[any]{},
+			},
+			expect: []any{
+				[]any{true, false, nil},
+				[]any{[]any{float64(1.5), int64(2)}, []any{int64(3), int64(4)}},
+				[]any{int64(5)},
+				nil,
+			},
+		},
+		{
+			name: "pgtype.Range",
+			input: []any{
+				pgtype.Range[any]{
+					Lower:     time.Date(2009, 11, 10, 23, 0, 0, 0, time.FixedZone("", 2*60*60)),
+					Upper:     time.Date(2009, 11, 11, 1, 30, 0, 0, time.FixedZone("", -5*60*60)),
+					LowerType: pgtype.Inclusive,
+					UpperType: pgtype.Exclusive,
+					Valid:     true,
+				},
+				pgtype.Range[any]{
+					Lower:     pgxNumeric(t, "1.5"),
+					LowerType: pgtype.Inclusive,
+					UpperType: pgtype.Unbounded,
+					Valid:     true,
+				},
+				pgtype.Range[any]{},
+			},
+			expect: []any{
+				pgtype.Range[any]{
+					Lower:     "2009-11-10 21:00:00 +0000 UTC",
+					Upper:     "2009-11-11 06:30:00 +0000 UTC",
+					LowerType: pgtype.Inclusive,
+					UpperType: pgtype.Exclusive,
+					Valid:     true,
+				},
+				pgtype.Range[any]{
+					Lower:     float64(1.5),
+					LowerType: pgtype.Inclusive,
+					UpperType: pgtype.Unbounded,
+					Valid:     true,
+				},
+				nil,
+			},
+		},
 	}
 	_ = time.Now()
 
@@ -78,6 +140,456 @@ func Test_Format(t *testing.T) {
 	}
 }
 
+func Test_FormatTimeOfDay(t *testing.T) {
+	m := pgtype.NewMap()
+	RegisterTypes(m)
+
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{input: "00:00:00", want: "00:00:00.000000"},
+		{input: "04:05:06", want: "04:05:06.000000"},
+		{input: "04:05:06.789", want: "04:05:06.789000"},
+		{input: "23:59:59.999999", want: "23:59:59.999999"},
+		{input: "24:00:00", want: "24:00:00.000000"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			is := is.New(t)
+
+			typ, ok := m.TypeForOID(pgtype.TimeOID)
+			is.True(ok)
+			v, err := typ.Codec.DecodeValue(m, pgtype.TimeOID, pgtype.TextFormatCode, []byte(tc.input))
+			is.NoErr(err)
+
+			got, err := Format(v)
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+
+			key, err := FormatKey(v)
+			is.NoErr(err)
+			is.Equal(key, tc.want)
+		})
+	}
+
+	t.Run("null", func(t *testing.T) {
+		is := is.New(t)
+		got, err := Format(pgtype.Time{})
+		is.NoErr(err)
+		is.Equal(got, nil)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		is := is.New(t)
+		_, err := Format(pgtype.Time{Microseconds: 24*60*60*1000000 + 1, Valid: true})
+		is.True(err != nil)
+	})
+}
+
+func Test_FormatKey(t *testing.T) {
+	hour := int64(60 * 60 * microsecondsPerSecond)
+
+	tests := []struct {
+		name  string
+		input any
+		want  any
+	}{
+		{name: "int", input: int64(42), want: int64(42)},
+		{name: "int negative", input: int64(-42), want: int64(-42)},
+		{name: "int min", input: int64(math.MinInt64), want: int64(math.MinInt64)},
+		{name: "int max", input: int64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{name: "string", input: "foo", want: "foo"},
+		{name: "numeric integer", input: pgxNumeric(t, "1200"), want: "1200"},
+		{name: "numeric trailing zeros", input: pgxNumeric(t, "1.50"), want: "1.5"},
+		{name: "numeric without trailing zeros", input: pgxNumeric(t, "1.5"), want: "1.5"},
+		{name: "numeric fraction", input: pgxNumeric(t, "-0.0010"), want: "-0.001"},
+		{name: "numeric zero", input: pgxNumeric(t, "0.00"), want: "0"},
+		{name: "numeric large", input: pgxNumeric(t, "123456789012345678901234567890.123"), want: "123456789012345678901234567890.123"},
+		{name: "numeric NaN", input: pgxNumeric(t, "NaN"), want: "NaN"},
+		{name: "numeric null", input: pgtype.Numeric{}, want: nil},
+		{name: "interval day", input: pgtype.Interval{Days: 1, Valid: true}, want: "P1D"},
+		{name: "interval 24 hours", input: pgtype.Interval{Microseconds: 24 * hour, Valid: true}, want: "P1D"},
+		{name: "interval 30 days", input: pgtype.Interval{Days: 30, Valid: true}, want: "P1M"},
+		{
+			name:  "interval all parts",
+			input: pgtype.Interval{Months: 14, Days: 3, Microseconds: 4*hour + 5*60*microsecondsPerSecond + 6789000, Valid: true},
+			want:  "P1Y2M3DT4H5M6.789S",
+		},
+		{name: "interval mixed signs", input: pgtype.Interval{Days: 1, Microseconds: -hour, Valid: true}, want: "PT23H"},
+		{name: "interval negative", input: pgtype.Interval{Days: -1, Valid: true}, want: "-P1D"},
+		{name: "interval zero", input: pgtype.Interval{Valid: true}, want: "PT0S"},
+		{name: "interval null", input: pgtype.Interval{}, want: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			got, err := FormatKey(tc.input)
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func Test_HashKey(t *testing.T) {
+	is := is.New(t)
+
+	hash := func(key map[string]any) string {
+		h, err := HashKey(key)
+		is.NoErr(err)
+		is.Equal(len(h), 16)
+		return h
+	}
+
+	// build equal keys in a different order, so they are unlikely to be
+	// iterated in the same order
+	k1 := map[string]any{}
+	k2 := map[string]any{}
+	cols := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for i, col := range cols {
+		k1[col] = int64(i)
+		k2[cols[len(cols)-1-i]] = int64(len(cols) - 1 - i)
+	}
+	is.Equal(hash(k1), hash(k2))
+	is.Equal(hash(map[string]any{"id": int64(1)}), hash(map[string]any{"id": int64(1)}))
+
+	// keys differing in values, types or column names hash differently
+	h := hash(map[string]any{"id": int64(1)})
+	is.True(h != hash(map[string]any{"id": int64(2)}))
+	is.True(h != hash(map[string]any{"id": "1"}))
+	is.True(h != hash(map[string]any{"key": int64(1)}))
+	is.True(hash(map[string]any{"a": "1", "b": "2"}) != hash(map[string]any{"a": "2", "b": "1"}))
+
+	// keys with special floats can be hashed and don't collide with strings
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		h := hash(map[string]any{"f": f})
+		is.Equal(h, hash(map[string]any{"f": f}))
+		is.True(h != hash(map[string]any{"f": Float.ReplaceSpecials(f, func(name string) any { return name })}))
+		is.Equal(hash(map[string]any{"f": []any{f}}), hash(map[string]any{"f": []any{f}}))
+	}
+	is.True(hash(map[string]any{"f": math.Inf(1)}) != hash(map[string]any{"f": math.Inf(-1)}))
+	is.Equal(hash(map[string]any{"f": float32(math.NaN())}), hash(map[string]any{"f": math.NaN()}))
+
+	// regular keys are hashed in their JSON encoding
+	b, err := json.Marshal(map[string]any{"id": int64(1), "name": "foo", "tags": []any{"a", 1.5}})
+	is.NoErr(err)
+	is.Equal(hash(map[string]any{"id": int64(1), "name": "foo", "tags": []any{"a", 1.5}}), fmt.Sprintf("%016x", xxhash.Sum64(b)))
+}
+
+func Test_FloatReplaceSpecials(t *testing.T) {
+	replace := func(name string) any { return "special " + name }
+
+	tests := []struct {
+		name  string
+		input any
+		want  any
+	}{
+		{name: "float8 NaN", input: math.NaN(), want: "special NaN"},
+		{name: "float8 Infinity", input: math.Inf(1), want: "special Infinity"},
+		{name: "float8 -Infinity", input: math.Inf(-1), want: "special -Infinity"},
+		{name: "float4 NaN", input: float32(math.NaN()), want: "special NaN"},
+		{name: "float4 -Infinity", input: float32(math.Inf(-1)), want: "special -Infinity"},
+		{name: "regular float", input: 1.5, want: 1.5},
+		{
+			name:  "array",
+			input: []any{1.5, math.Inf(1), nil},
+			want:  []any{1.5, "special Infinity", nil},
+		},
+		{
+			name:  "composite",
+			input: map[string]any{"name": "foo", "price": math.NaN()},
+			want:  map[string]any{"name": "foo", "price": "special NaN"},
+		},
+		{name: "other value", input: "NaN", want: "NaN"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Float.ReplaceSpecials(tc.input, replace), tc.want)
+		})
+	}
+}
+
+func Test_IntervalWithComponents(t *testing.T) {
+	hour := int64(60 * 60 * microsecondsPerSecond)
+	components := func(months, days int32, micros int64) map[string]any {
+		return map[string]any{"months": months, "days": days, "microseconds": micros}
+	}
+
+	tests := []struct {
+		name  string
+		input any
+		want  any
+	}{
+		{
+			name:  "interval",
+			input: pgtype.Interval{Months: 14, Days: 3, Microseconds: 4 * hour, Valid: true},
+			want:  components(14, 3, 4*hour),
+		},
+		{
+			name:  "interval pointer",
+			input: &pgtype.Interval{Days: -1, Microseconds: hour, Valid: true},
+			want:  components(0, -1, hour),
+		},
+		{name: "interval null", input: pgtype.Interval{}, want: nil},
+		{
+			name:  "array",
+			input: []any{pgtype.Interval{Months: 1, Valid: true}, pgtype.Interval{}},
+			want:  []any{components(1, 0, 0), nil},
+		},
+		{
+			name:  "composite",
+			input: map[string]any{"name": "foo", "duration": pgtype.Interval{Days: 2, Valid: true}},
+			want:  map[string]any{"name": "foo", "duration": components(0, 2, 0)},
+		},
+		{name: "other value", input: "1 day", want: "1 day"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Interval.WithComponents(tc.input), tc.want)
+		})
+	}
+}
+
+func Test_RegisterTypes(t *testing.T) {
+	m := pgtype.NewMap()
+	RegisterTypes(m)
+
+	tests := []struct {
+		name   string
+		oid    uint32
+		input  []byte
+		expect any
+	}{
+		{
+			name:   "pg_lsn",
+			oid:    PgLSNOID,
+			input:  []byte("16/B374D848"),
+			expect: "16/B374D848",
+		},
+		{
+			name:   "jsonpath",
+			oid:    JSONPathOID,
+			input:  []byte(`$."foo"[*]?(@ > 1)`),
+			expect: `$."foo"[*]?(@ > 1)`,
+		},
+		{
+			name:   "pg_snapshot",
+			oid:    PgSnapshotOID,
+			input:  []byte("10:20:10,14,15"),
+			expect: "10:20:10,14,15",
+		},
+		{
+			name:   "txid_snapshot",
+			oid:    TxidSnapshotOID,
+			input:  []byte("100:100:"),
+			expect: "100:100:",
+		},
+		{
+			name:   "xid",
+			oid:    pgtype.XIDOID,
+			input:  []byte("4294967295"),
+			expect: uint32(4294967295),
+		},
+		{
+			name:   "xid8",
+			oid:    XID8OID,
+			input:  []byte("18446744073709551615"),
+			expect: uint64(18446744073709551615),
+		},
+		{
+			name:   "xid8 null",
+			oid:    XID8OID,
+			input:  nil,
+			expect: nil,
+		},
+		{
+			name:   "name",
+			oid:    pgtype.NameOID,
+			input:  []byte("pg_class"),
+			expect: "pg_class",
+		},
+		{
+			name:   "name with trailing null bytes",
+			oid:    pgtype.NameOID,
+			input:  append([]byte("pg_class"), make([]byte, 56)...),
+			expect: "pg_class",
+		},
+		{
+			name:   "name null",
+			oid:    pgtype.NameOID,
+			input:  nil,
+			expect: nil,
+		},
+		{
+			name:   "timetz",
+			oid:    pgtype.TimetzOID,
+			input:  []byte("12:34:56+02"),
+			expect: "12:34:56+02:00",
+		},
+		{
+			name:   "timetz negative offset with minutes",
+			oid:    pgtype.TimetzOID,
+			input:  []byte("12:34:56.789-03:30"),
+			expect: "12:34:56.789-03:30",
+		},
+		{
+			name:   "macaddr8",
+			oid:    pgtype.Macaddr8OID,
+			input:  []byte("08:00:2B:01:02:03:04:05"),
+			expect: "08:00:2b:01:02:03:04:05",
+		},
+		{
+			name:   "macaddr8 null",
+			oid:    pgtype.Macaddr8OID,
+			input:  nil,
+			expect: nil,
+		},
+		{
+			name:   "int2vector",
+			oid:    Int2VectorOID,
+			input:  []byte("1 3 -2"),
+			expect: []int16{1, 3, -2},
+		},
+		{
+			name:   "oidvector",
+			oid:    OIDVectorOID,
+			input:  []byte("23 25 4294967295"),
+			expect: []uint32{23, 25, 4294967295},
+		},
+		{
+			name:   "oidvector empty",
+			oid:    OIDVectorOID,
+			input:  []byte(""),
+			expect: []uint32{},
+		},
+		{
+			name:   "oidvector null",
+			oid:    OIDVectorOID,
+			input:  nil,
+			expect: nil,
+		},
+		{
+			name:   "point",
+			oid:    pgtype.PointOID,
+			input:  []byte("(1.5,-2)"),
+			expect: "(1.5,-2)",
+		},
+		{
+			name:   "polygon",
+			oid:    pgtype.PolygonOID,
+			input:  []byte("((0,0),(1,1),(1,0))"),
+			expect: "((0,0),(1,1),(1,0))",
+		},
+		{
+			name:   "polygon null",
+			oid:    pgtype.PolygonOID,
+			input:  nil,
+			expect: nil,
+		},
+		{
+			name:   "timetz null",
+			oid:    pgtype.TimetzOID,
+			input:  nil,
+			expect: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			typ, ok := m.TypeForOID(tc.oid)
+			is.True(ok)
+
+			v, err := typ.Codec.DecodeValue(m, tc.oid, pgtype.TextFormatCode, tc.input)
+			is.NoErr(err)
+			is.Equal(v, tc.expect)
+		})
+	}
+}
+
+func Test_registerExtensionType(t *testing.T) {
+	is := is.New(t)
+
+	const citextOID, citextArrayOID = 100001, 100002
+
+	m := pgtype.NewMap()
+	registerExtensionType(m, "citext", citextOID, citextArrayOID)
+
+	typ, ok := m.TypeForOID(citextOID)
+	is.True(ok)
+	v, err := typ.Codec.DecodeValue(m, citextOID, pgtype.TextFormatCode, []byte("Foo Bar"))
+	is.NoErr(err)
+	is.Equal(v, "Foo Bar")
+
+	typ, ok = m.TypeForOID(citextArrayOID)
+	is.True(ok)
+	v, err = typ.Codec.DecodeValue(m, citextArrayOID, pgtype.TextFormatCode, []byte("{Foo,BAR}"))
+	is.NoErr(err)
+	is.Equal(v, []any{"Foo", "BAR"})
+}
+
+func Test_registerUserTypes(t *testing.T) {
+	is := is.New(t)
+
+	const (
+		moodOID, moodArrayOID           = 100011, 100012
+		itemOID, itemArrayOID           = 100013, 100014
+		orderLineOID, orderLineArrayOID = 100015, 100016
+	)
+
+	m := pgtype.NewMap()
+	RegisterTypes(m)
+	registerUserTypes(m, []*userType{
+		// registered after item, which it contains
+		{name: "order_line", oid: orderLineOID, arrayOID: orderLineArrayOID, typtype: 'c', fields: []compositeField{
+			{name: "items", oid: itemArrayOID},
+			{name: "note", oid: 999999}, // unknown type, decoded as text
+		}},
+		{name: "item", oid: itemOID, arrayOID: itemArrayOID, typtype: 'c', fields: []compositeField{
+			{name: "id", oid: pgtype.UUIDOID},
+			{name: "mood", oid: moodOID},
+			{name: "price", oid: pgtype.NumericOID},
+		}},
+		{name: "mood", oid: moodOID, arrayOID: moodArrayOID, typtype: 'e'},
+	})
+
+	decode := func(oid uint32, src string) any {
+		var arr pgtype.Array[any]
+		is.NoErr(m.PlanScan(oid, pgtype.TextFormatCode, &arr).Scan([]byte(src), &arr))
+		v, err := Format(arr)
+		is.NoErr(err)
+		return v
+	}
+	id := [16]uint8{0xbd, 0x94, 0xee, 0x0b, 0x56, 0x4f, 0x40, 0x88, 0xbf, 0x4e, 0x8d, 0x5e, 0x62, 0x6c, 0xaf, 0x66}
+
+	is.Equal(decode(pgtype.UUIDArrayOID, "{bd94ee0b-564f-4088-bf4e-8d5e626caf66,NULL}"), []any{id, nil})
+	is.Equal(decode(moodArrayOID, "{happy,sad}"), []any{"happy", "sad"})
+	is.Equal(
+		decode(itemArrayOID, `{"(bd94ee0b-564f-4088-bf4e-8d5e626caf66,happy,1.5)","(bd94ee0b-564f-4088-bf4e-8d5e626caf66,sad,2)"}`),
+		[]any{
+			map[string]any{"id": id, "mood": "happy", "price": float64(1.5)},
+			map[string]any{"id": id, "mood": "sad", "price": int64(2)},
+		},
+	)
+	is.Equal(
+		decode(orderLineArrayOID, `{"(\"{\"\"(bd94ee0b-564f-4088-bf4e-8d5e626caf66,happy,1.5)\"\"}\",foo)"}`),
+		[]any{
+			map[string]any{
+				"items": []any{map[string]any{"id": id, "mood": "happy", "price": float64(1.5)}},
+				"note":  "foo",
+			},
+		},
+	)
+}
+
 // as per https://github.com/jackc/pgx/blob/master/pgtype/numeric_test.go#L66
 func pgxNumeric(t *testing.T, num string) pgtype.Numeric {
 	is := is.New(t)
@@ -0,0 +1,192 @@
+// Copyright © 2024 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// userType is an enum or composite type created in the database.
+type userType struct {
+	name     string
+	oid      uint32
+	arrayOID uint32
+	// typtype is 'e' for enums and 'c' for composites.
+	typtype byte
+	fields  []compositeField
+}
+
+type compositeField struct {
+	name string
+	oid  uint32
+}
+
+// LoadUserTypes looks up enum and composite types created in the database and
+// registers codecs for them and their array types, so that values of these
+// types are decoded into strings and maps instead of raw data, also when they
+// are elements of arrays or fields of other composites.
+func LoadUserTypes(ctx context.Context, conn *pgconn.PgConn, m *pgtype.Map) error {
+	res := conn.Exec(ctx, `
+		SELECT t.oid, t.typname, t.typtype, t.typarray
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		LEFT JOIN pg_class c ON c.oid = t.typrelid
+		WHERE (t.typtype = 'e' OR (t.typtype = 'c' AND c.relkind = 'c'))
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema');
+		SELECT t.oid, a.attname, a.atttypid
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_class c ON c.oid = t.typrelid AND c.relkind = 'c'
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		WHERE t.typtype = 'c'
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY t.oid, a.attnum`,
+	)
+	results, err := res.ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to look up user defined types: %w", err)
+	}
+	if len(results) != 2 {
+		return fmt.Errorf("failed to look up user defined types: expected 2 results, got %d", len(results))
+	}
+
+	byOID := make(map[uint32]*userType)
+	var userTypes []*userType
+	for _, row := range results[0].Rows {
+		oid, err := parseOID(row[0])
+		if err != nil {
+			return err
+		}
+		arrayOID, err := parseOID(row[3])
+		if err != nil {
+			return err
+		}
+		t := &userType{name: string(row[1]), oid: oid, arrayOID: arrayOID, typtype: row[2][0]}
+		byOID[oid] = t
+		userTypes = append(userTypes, t)
+	}
+	for _, row := range results[1].Rows {
+		oid, err := parseOID(row[0])
+		if err != nil {
+			return err
+		}
+		fieldOID, err := parseOID(row[2])
+		if err != nil {
+			return err
+		}
+		if t, ok := byOID[oid]; ok {
+			t.fields = append(t.fields, compositeField{name: string(row[1]), oid: fieldOID})
+		}
+	}
+
+	registerUserTypes(m, userTypes)
+	return nil
+}
+
+// registerUserTypes registers codecs for the types and their array types.
+// Composites are registered after the types of their fields, fields of types
+// without a codec are decoded as text.
+func registerUserTypes(m *pgtype.Map, userTypes []*userType) {
+	pending := make([]*userType, 0, len(userTypes))
+	for _, t := range userTypes {
+		if t.typtype == 'e' {
+			registerUserType(m, t, &pgtype.EnumCodec{})
+			continue
+		}
+		pending = append(pending, t)
+	}
+
+	// composites can contain other composites, register them in dependency
+	// order, as long as there are composites with all field types known
+	for len(pending) > 0 {
+		var next []*userType
+		for _, t := range pending {
+			if !fieldTypesKnown(t, pending) {
+				next = append(next, t)
+				continue
+			}
+			registerComposite(m, t)
+		}
+		if len(next) == len(pending) {
+			// cyclic or unknown field types, fall back to text for those
+			for _, t := range next {
+				registerComposite(m, t)
+			}
+			return
+		}
+		pending = next
+	}
+}
+
+// fieldTypesKnown returns false if a field of the composite has a type which
+// is still pending registration.
+func fieldTypesKnown(t *userType, pending []*userType) bool {
+	for _, f := range t.fields {
+		for _, p := range pending {
+			if p != t && (f.oid == p.oid || f.oid == p.arrayOID) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func registerComposite(m *pgtype.Map, t *userType) {
+	textType, _ := m.TypeForOID(pgtype.TextOID)
+	fields := make([]pgtype.CompositeCodecField, len(t.fields))
+	for i, f := range t.fields {
+		ft, ok := m.TypeForOID(f.oid)
+		if !ok {
+			ft = textType
+		}
+		fields[i] = pgtype.CompositeCodecField{Name: f.name, Type: ft}
+	}
+	registerUserType(m, t, &pgtype.CompositeCodec{Fields: fields})
+}
+
+// registerUserType registers the codec for the type and its array type.
+func registerUserType(m *pgtype.Map, t *userType, codec pgtype.Codec) {
+	pt := &pgtype.Type{Name: t.name, OID: t.oid, Codec: codec}
+	m.RegisterType(pt)
+	if t.arrayOID != 0 {
+		m.RegisterType(&pgtype.Type{Name: "_" + t.name, OID: t.arrayOID, Codec: &pgtype.ArrayCodec{ElementType: pt}})
+	}
+}
+
+// formatComposite coerces the fields of a decoded composite value.
+func formatComposite(c map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(c))
+	for k, v := range c {
+		f, err := Format(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format composite field %q: %w", k, err)
+		}
+		out[k] = f
+	}
+	return out, nil
+}
+
+func parseOID(src []byte) (uint32, error) {
+	oid, err := strconv.ParseUint(string(src), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid OID %q: %w", src, err)
+	}
+	return uint32(oid), nil
+}
@@ -16,6 +16,8 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl"
@@ -58,3 +60,232 @@ func TestSource_Open(t *testing.T) {
 		is.NoErr(s.Teardown(ctx))
 	}()
 }
+
+func TestSource_Open_KeyColumns(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	tableName := test.SetupTestTable(ctx, t, conn)
+	slotName := "conduitslot2"
+	publicationName := "conduitpub2"
+
+	s := &Source{tableKeys: make(map[string]string)}
+	err := s.Configure(
+		ctx,
+		map[string]string{
+			"url":                     test.RepmgrConnString,
+			"tables":                  tableName,
+			"snapshotMode":            "initial",
+			"cdcMode":                 "logrepl",
+			"keyColumns." + tableName: "column2",
+			"logrepl.slotName":        slotName,
+			"logrepl.publicationName": publicationName,
+		},
+	)
+	is.NoErr(err)
+
+	err = s.Open(ctx, nil)
+	is.NoErr(err)
+
+	defer func() {
+		is.NoErr(logrepl.Cleanup(context.Background(), logrepl.CleanupConfig{
+			URL:             test.RepmgrConnString,
+			SlotName:        slotName,
+			PublicationName: publicationName,
+		}))
+		is.NoErr(s.Teardown(ctx))
+	}()
+
+	is.Equal(s.tableKeys[tableName], "column2")
+}
+
+func TestSource_Open_IdentityColumnKey(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	slotName := "conduitslot9"
+	publicationName := "conduitpub9"
+
+	// table without a primary key
+	tableName := test.RandomIdentifier(t)
+	_, err := conn.Exec(ctx, fmt.Sprintf(
+		"CREATE TABLE %s (name text, seq int GENERATED ALWAYS AS IDENTITY)",
+		tableName,
+	))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP TABLE "+tableName)
+		is.NoErr(err)
+	})
+
+	s := &Source{tableKeys: make(map[string]string)}
+	err = s.Configure(
+		ctx,
+		map[string]string{
+			"url":                     test.RepmgrConnString,
+			"tables":                  tableName,
+			"snapshotMode":            "initial",
+			"cdcMode":                 "logrepl",
+			"logrepl.slotName":        slotName,
+			"logrepl.publicationName": publicationName,
+		},
+	)
+	is.NoErr(err)
+
+	err = s.Open(ctx, nil)
+	is.NoErr(err)
+
+	defer func() {
+		is.NoErr(logrepl.Cleanup(context.Background(), logrepl.CleanupConfig{
+			URL:             test.RepmgrConnString,
+			SlotName:        slotName,
+			PublicationName: publicationName,
+		}))
+		is.NoErr(s.Teardown(ctx))
+	}()
+
+	is.Equal(s.tableKeys[tableName], "seq")
+}
+
+func TestSource_Open_KeyIndexes(t *testing.T) {
+	ctx := context.Background()
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	tableName := test.SetupTestTable(ctx, t, conn)
+
+	// secondary unique index next to the primary key
+	for _, query := range []string{
+		"CREATE UNIQUE INDEX %[1]s_column2_key ON %[1]s (column2)",
+		"CREATE UNIQUE INDEX %[1]s_column1_partial ON %[1]s (column1) WHERE column3",
+		"CREATE INDEX %[1]s_column1_idx ON %[1]s (column1)",
+		"CREATE UNIQUE INDEX %[1]s_column1_column2_key ON %[1]s (column1, column2)",
+		"CREATE UNIQUE INDEX %[1]s_lower_key ON %[1]s (id, lower(column1))",
+	} {
+		_, err := conn.Exec(ctx, fmt.Sprintf(query, tableName))
+		is.New(t).NoErr(err)
+	}
+
+	tests := []struct {
+		index   string
+		wantKey string
+		wantErr string
+	}{
+		{index: tableName + "_column2_key", wantKey: "column2"},
+		{index: tableName + "_column1_column2_key", wantKey: "column1,column2"},
+		{index: tableName + "_lower_key", wantErr: "is on an expression"},
+		{index: tableName + "_column1_partial", wantErr: "is partial"},
+		{index: tableName + "_column1_idx", wantErr: "is not unique"},
+		{index: "missing", wantErr: "does not exist"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.index, func(t *testing.T) {
+			is := is.New(t)
+			slotName := "conduitslot10"
+			publicationName := "conduitpub10"
+
+			s := &Source{tableKeys: make(map[string]string)}
+			err := s.Configure(
+				ctx,
+				map[string]string{
+					"url":                     test.RepmgrConnString,
+					"tables":                  tableName,
+					"snapshotMode":            "never",
+					"cdcMode":                 "logrepl",
+					"keyIndexes." + tableName: tc.index,
+					"logrepl.slotName":        slotName,
+					"logrepl.publicationName": publicationName,
+				},
+			)
+			is.NoErr(err)
+
+			err = s.Open(ctx, nil)
+			defer func() {
+				is.NoErr(s.Teardown(ctx))
+			}()
+			if tc.wantErr != "" {
+				is.True(err != nil)
+				is.True(strings.Contains(err.Error(), tc.wantErr))
+				return
+			}
+			is.NoErr(err)
+			defer func() {
+				is.NoErr(logrepl.Cleanup(context.Background(), logrepl.CleanupConfig{
+					URL:             test.RepmgrConnString,
+					SlotName:        slotName,
+					PublicationName: publicationName,
+				}))
+			}()
+
+			is.Equal(s.tableKeys[tableName], tc.wantKey)
+		})
+	}
+}
+
+func TestSource_Open_KeyColumnsMissing(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	tableName := test.SetupTestTable(ctx, t, conn)
+
+	s := &Source{tableKeys: make(map[string]string)}
+	err := s.Configure(
+		ctx,
+		map[string]string{
+			"url":                     test.RepmgrConnString,
+			"tables":                  tableName,
+			"keyColumns." + tableName: "missing",
+		},
+	)
+	is.NoErr(err)
+
+	err = s.Open(ctx, nil)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `column "missing" does not exist`))
+	is.NoErr(s.Teardown(ctx))
+}
+
+func TestSource_Open_CompositeKeyColumnsMissing(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	tableName := test.SetupTestTable(ctx, t, conn)
+
+	s := &Source{tableKeys: make(map[string]string)}
+	err := s.Configure(
+		ctx,
+		map[string]string{
+			"url":                     test.RepmgrConnString,
+			"tables":                  tableName,
+			"keyColumns." + tableName: "id,missing",
+		},
+	)
+	is.NoErr(err)
+
+	err = s.Open(ctx, nil)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `column "missing" does not exist`))
+	is.NoErr(s.Teardown(ctx))
+}
+
+func TestSource_Open_KeyColumnsUndetectedTable(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	conn := test.ConnectSimple(ctx, t, test.RepmgrConnString)
+	_ = test.SetupTestTable(ctx, t, conn)
+
+	s := &Source{tableKeys: make(map[string]string)}
+	err := s.Configure(
+		ctx,
+		map[string]string{
+			"url":                      test.RepmgrConnString,
+			"tables":                   "*",
+			"keyColumns.missing_table": "id",
+		},
+	)
+	is.NoErr(err)
+
+	err = s.Open(ctx, nil)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `table "missing_table" is not in "tables"`))
+	is.NoErr(s.Teardown(ctx))
+}